@@ -0,0 +1,76 @@
+// Package audit records who changed what in the append-only audit_events table.
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Event is one audited action
+type Event struct {
+	// ActorID is the user who acted, 0 for the system
+	ActorID int
+	// UserID is the user whose data the action concerns, 0 for none
+	UserID int
+	// Action names what happened, e.g. "user.disable"
+	Action     string
+	EntityType string
+	EntityID   string
+	// Before and After are the entity's state around the change, marshalled to
+	// JSON. Either is nil when the entity did not exist on that side.
+	Before interface{}
+	After  interface{}
+	// IPAddress is the client the action came from
+	IPAddress string
+	// RequestID ties the event to the request's log lines
+	RequestID string
+}
+
+// maxRequestIDLength matches the request_id column. Clients may send their
+// own request IDs, so longer ones are cut.
+const maxRequestIDLength = 64
+
+// Execer is satisfied by *sql.DB and *sql.Tx, so an event can be written in
+// the same transaction as the change it describes
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Record writes an event
+func Record(ctx context.Context, db Execer, event Event) error {
+	before, err := marshal(event.Before)
+	if err != nil {
+		return fmt.Errorf("marshalling audit before state: %w", err)
+	}
+	after, err := marshal(event.After)
+	if err != nil {
+		return fmt.Errorf("marshalling audit after state: %w", err)
+	}
+
+	requestID := event.RequestID
+	if len(requestID) > maxRequestIDLength {
+		requestID = strings.ToValidUTF8(requestID[:maxRequestIDLength], "")
+	}
+
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO audit_events (actor_id, user_id, action, entity_type, entity_id, before, after, ip_address, request_id)
+		VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, $4, $5, $6, $7, $8, $9)`,
+		event.ActorID, event.UserID, event.Action, event.EntityType, event.EntityID, before, after, event.IPAddress, requestID,
+	)
+	return err
+}
+
+// marshal encodes a state as JSON, keeping nil as SQL NULL
+func marshal(state interface{}) (interface{}, error) {
+	if state == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
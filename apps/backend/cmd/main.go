@@ -1,11 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -13,52 +12,59 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 
+	"github.com/kevinlucasklein/zero-balance/config"
 	"github.com/kevinlucasklein/zero-balance/database"
+	"github.com/kevinlucasklein/zero-balance/lockout"
+	"github.com/kevinlucasklein/zero-balance/mailer"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/middleware/ratelimit"
+	"github.com/kevinlucasklein/zero-balance/oidc"
 	"github.com/kevinlucasklein/zero-balance/routes"
+	"github.com/kevinlucasklein/zero-balance/utils"
 )
 
 func main() {
-	// Load environment variables from .env file manually
-	loadEnvFile()
-
-	// Check if debug mode is enabled
-	debugMode := getEnvAsBool("DEBUG", false)
-
-	// Print environment information
 	fmt.Println("Starting ZeroBalance API...")
 
-	// Print environment variables in debug mode
-	if debugMode {
-		fmt.Println("Environment variables:")
-		fmt.Printf("PORT: %s\n", getEnvOrDefault("PORT", "8080"))
-		fmt.Printf("DB_HOST: %s\n", getEnvOrDefault("DB_HOST", "localhost"))
-		fmt.Printf("DB_PORT: %s\n", getEnvOrDefault("DB_PORT", "5432"))
-		fmt.Printf("DB_USER: %s\n", getEnvOrDefault("DB_USER", ""))
-		fmt.Printf("DB_NAME: %s\n", getEnvOrDefault("DB_NAME", ""))
-		fmt.Printf("DB_SSL_MODE: %s\n", getEnvOrDefault("DB_SSL_MODE", "disable"))
-
-		// Check for Railway-specific PostgreSQL environment variables
-		fmt.Println("Railway PostgreSQL environment variables:")
-		fmt.Printf("PGHOST: %s\n", getEnvOrDefault("PGHOST", ""))
-		fmt.Printf("PGPORT: %s\n", getEnvOrDefault("PGPORT", ""))
-		fmt.Printf("PGUSER: %s\n", getEnvOrDefault("PGUSER", ""))
-		fmt.Printf("PGDATABASE: %s\n", getEnvOrDefault("PGDATABASE", ""))
-		fmt.Printf("PGSSLMODE: %s\n", getEnvOrDefault("PGSSLMODE", ""))
+	// Read the configuration from its defaults, config file, .env file and
+	// the environment, and stop before doing anything if it is invalid
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	cfg.Print(os.Stdout)
+
+	// Load the keys access tokens are signed with
+	if err := utils.LoadSigningKeys(cfg.Tokens); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	if utils.UsingDefaultSecret() {
+		if cfg.IsProduction() {
+			log.Fatal("Refusing to start in production with the default JWT secret, set JWT_SECRET or JWT_PRIVATE_KEY_FILE")
+		}
+		log.Println("WARNING: Signing tokens with the default JWT secret, set JWT_SECRET or JWT_PRIVATE_KEY_FILE")
 	}
 
 	// Initialize database with error handling
 	fmt.Println("Initializing database connection...")
-	err := initDatabaseWithRetry(5)
+	// Deploys that run "zb migrate up" as a step of their own turn off MIGRATE_ON_START
+	db, err := initDatabaseWithRetry(cfg.Database, cfg.Server.MigrateOnStart, 5)
 	if err != nil {
-		log.Printf("WARNING: Failed to initialize database: %v", err)
-		log.Println("Continuing without database connection")
-	} else {
-		fmt.Println("Database initialized successfully")
+		// Without the database no API route works, so let the platform
+		// restart the server instead of serving a routeless app
+		log.Fatalf("Failed to initialize database: %v", err)
 	}
+	fmt.Println("Database initialized successfully")
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
+		// Behind a load balancer, read the client IP from the header it sets
+		// (e.g. X-Forwarded-For) so per-IP limits apply to clients, not the proxy
+		ProxyHeader:        cfg.Server.ProxyHeader,
+		EnableIPValidation: true,
+
 		// Add error handling
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			// Log the error
@@ -72,16 +78,23 @@ func main() {
 	})
 
 	// Add middleware
-	app.Use(recover.New()) // Recover from panics
-	app.Use(logger.New())  // Log requests
+	app.Use(recover.New())   // Recover from panics
+	app.Use(requestid.New()) // Tag each request with an X-Request-ID
+	app.Use(logger.New(logger.Config{
+		// Log requests with their ID, which audit events record too
+		Format: "${time} | ${status} | ${latency} | ${ip} | ${method} | ${path} | ${respHeader:X-Request-ID} | ${error}\n",
+	}))
 
 	// Add CORS middleware
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: getCorsOrigins(),
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowOrigins: getCorsOrigins(cfg),
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-Request-ID",
 		AllowMethods: "GET, POST, PUT, DELETE",
 	}))
 
+	// Cancel the queries of requests that run longer than DB_QUERY_TIMEOUT
+	app.Use(middleware.QueryTimeout(cfg.Database.QueryTimeout))
+
 	// Root endpoint for health checks
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
@@ -93,77 +106,101 @@ func main() {
 
 	// Add a debug endpoint
 	app.Get("/debug", func(c *fiber.Ctx) error {
-		dbStatus := "not connected"
-		if database.DB != nil {
-			if err := database.DB.Ping(); err == nil {
-				dbStatus = "connected"
-			} else {
-				dbStatus = fmt.Sprintf("error: %v", err)
-			}
+		dbStatus := "connected"
+		if err := db.Ping(c.UserContext()); err != nil {
+			dbStatus = fmt.Sprintf("error: %v", err)
 		}
 
-		return c.JSON(fiber.Map{
+		response := fiber.Map{
 			"status":    "ok",
 			"db_status": dbStatus,
-			"env":       getEnvironmentVariables(),
-		})
+		}
+		// Show the effective configuration, with secrets redacted, in debug mode
+		if cfg.Debug {
+			response["config"] = cfg.Redacted()
+		}
+		return c.JSON(response)
 	})
 
-	// Register routes if database is connected
-	if database.DB != nil {
-		// Register authentication routes
-		routes.RegisterAuthRoutes(app, database.DB)
+	// Cap each client's requests across the whole API, keyed by IP as this
+	// runs before authentication. The health checks above are exempt.
+	limits := ratelimit.NewStore(cfg.Server.RateLimitStore, db.DB)
+	app.Use(ratelimit.New(limits, "global", ratelimit.Limit{Burst: 300, Per: time.Minute}))
 
-		// Register profile routes
-		routes.RegisterProfileRoutes(app, database.DB)
-	} else {
-		log.Println("WARNING: Skipping routes registration due to missing database connection")
-	}
+	// Publish the token verification keys
+	routes.RegisterJWKSRoutes(app)
 
-	// Get port from environment variable or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	// Reject MFA pending tokens issued before a user's last password change
+	utils.SetTokenVersionLookup(db.TokenVersion)
 
-	// Start the server
-	fmt.Printf("Starting server on port %s...\n", port)
-	log.Fatal(app.Listen(":" + port))
-}
+	// Reject access tokens of sessions that have been logged out, or issued
+	// before the user's last password change
+	middleware.SetSessionLookup(db.SessionState)
 
-// Helper function to get environment variable with default value
-func getEnvOrDefault(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return defaultValue
-}
+	// Rate limit each route group separately, by user when signed in and by IP otherwise
+	authLimit := ratelimit.New(limits, "auth", ratelimit.Limit{Burst: 10, Per: time.Minute})
+	profileLimit := ratelimit.New(limits, "profile", ratelimit.Limit{Burst: 60, Per: time.Minute})
+	plannerLimit := ratelimit.New(limits, "planner", ratelimit.Limit{Burst: 20, Per: time.Minute})
 
-// Helper function to get environment variable as boolean
-func getEnvAsBool(key string, defaultValue bool) bool {
-	valStr := os.Getenv(key)
-	if valStr == "" {
-		return defaultValue
-	}
+	// Register authentication routes
+	mail := mailer.New(cfg.Mail)
+	routes.SetAppURL(cfg.Server.AppURL)
+	routes.RegisterAuthRoutes(app, db.DB, mail, lockout.NewStore(cfg.Server.LockoutStore, db.DB), authLimit)
 
-	val, err := strconv.ParseBool(valStr)
-	if err != nil {
-		return defaultValue
-	}
+	// Register sign-in with external identity providers
+	routes.RegisterOIDCRoutes(app, db.DB, oidc.Providers(cfg.OIDC), authLimit)
+
+	// Register profile routes
+	routes.RegisterProfileRoutes(app, db.DB, profileLimit)
+
+	// Register debt routes
+	routes.RegisterDebtRoutes(app, db.DB)
 
-	return val
+	// Register income routes
+	routes.RegisterIncomeRoutes(app, db.DB)
+
+	// Register payoff planner routes
+	routes.RegisterPlanRoutes(app, db.DB, plannerLimit)
+
+	// Register scheduled payment routes
+	routes.RegisterScheduleRoutes(app, db.DB, plannerLimit)
+
+	// Register exchange rate routes
+	routes.RegisterExchangeRateRoutes(app, db.DB)
+
+	// Register audit history routes
+	routes.RegisterAuditRoutes(app, db.DB)
+
+	// Register admin routes
+	routes.RegisterAdminRoutes(app, db.DB, mail)
+
+	// Start the server
+	fmt.Printf("Starting server on port %s...\n", cfg.Server.Port)
+	log.Fatal(app.Listen(":" + cfg.Server.Port))
 }
 
 // Initialize database with retry
-func initDatabaseWithRetry(maxRetries int) error {
+func initDatabaseWithRetry(cfg database.Config, migrate bool, maxRetries int) (*database.Store, error) {
 	var err error
 	for i := 0; i < maxRetries; i++ {
-		// Try to initialize database with migrations
-		err = database.InitDB()
+		// Try to initialize database, with migrations unless they run separately
+		var db *database.Store
+		if migrate {
+			db, err = database.InitDB(context.Background(), cfg)
+		} else {
+			db, err = database.ConnectDB(context.Background(), cfg)
+		}
 
-		// If successful, return nil
+		// If successful, return the connection pool
 		if err == nil {
-			return nil
+			if !migrate {
+				// An edited migration will not fix itself, so there is no retrying
+				if err := checkMigrations(db); err != nil {
+					db.Close()
+					return nil, err
+				}
+			}
+			return db, nil
 		}
 
 		// Log error and retry
@@ -175,38 +212,45 @@ func initDatabaseWithRetry(maxRetries int) error {
 		}
 	}
 
-	return err
+	return nil, err
 }
 
-// Get all environment variables for debugging
-func getEnvironmentVariables() map[string]string {
-	env := make(map[string]string)
-	for _, e := range os.Environ() {
-		pair := make([]string, 2)
-		for i := 0; i < len(e); i++ {
-			if e[i] == '=' {
-				pair[0] = e[:i]
-				pair[1] = e[i+1:]
-				break
-			}
-		}
-
-		// Skip sensitive environment variables
-		if pair[0] == "DB_PASS" || pair[0] == "DB_PASSWORD" || pair[0] == "PGPASSWORD" {
-			env[pair[0]] = "[REDACTED]"
-		} else {
-			env[pair[0]] = pair[1]
+// checkMigrations logs the migrations this build expects that have not been
+// applied, and fails when an applied one was edited since, as the schema may
+// not be what this build expects. Applied migrations it does not know are
+// fine, a newer build may have applied them during a rolling deploy.
+func checkMigrations(db *database.Store) error {
+	m, err := db.Migrator()
+	if err != nil {
+		log.Printf("WARNING: Failed to check migrations: %v", err)
+		return nil
+	}
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		log.Printf("WARNING: Failed to check migrations: %v", err)
+		return nil
+	}
+	var edited []string
+	for _, s := range statuses {
+		switch s.State {
+		case database.StatePending:
+			log.Printf("WARNING: Migration %d (%s) has not been applied, run \"zb migrate up\"", s.Version, s.Name)
+		case database.StateEdited:
+			edited = append(edited, fmt.Sprintf("%d (%s)", s.Version, s.Name))
 		}
 	}
-	return env
+	if len(edited) > 0 {
+		return fmt.Errorf("%w: %s", database.ErrChecksumMismatch, strings.Join(edited, ", "))
+	}
+	return nil
 }
 
 // Helper function to get CORS origins based on environment
-func getCorsOrigins() string {
+func getCorsOrigins(cfg *config.Config) string {
 	// Check if we're in production
-	if os.Getenv("ENVIRONMENT") == "production" || os.Getenv("RAILWAY_ENVIRONMENT_NAME") == "production" {
+	if cfg.IsProduction() {
 		// Use specific origins in production
-		origins := getEnvOrDefault("CORS_ORIGINS", "https://zero-balance.vercel.app")
+		origins := cfg.Server.CORSOrigins
 		fmt.Printf("Running in production mode. CORS origins: %s\n", origins)
 
 		// If there are multiple origins, return them as-is (Fiber will handle comma-separated lists)
@@ -218,69 +262,3 @@ func getCorsOrigins() string {
 	fmt.Println("Running in development mode. CORS origins: *")
 	return "*"
 }
-
-// loadEnvFile manually reads the .env file and sets environment variables
-func loadEnvFile() {
-	// Try different possible locations for .env file
-	possiblePaths := []string{
-		".env",       // When running from project root
-		"../.env",    // When running from cmd directory
-		"../../.env", // When running from a nested directory
-		"/app/.env",  // When running in Docker container
-		filepath.Join(filepath.Dir(os.Args[0]), ".env"), // Next to the binary
-	}
-
-	for _, path := range possiblePaths {
-		if fileExists(path) {
-			fmt.Printf("Loading environment from %s\n", path)
-
-			// Read the file
-			content, err := os.ReadFile(path)
-			if err != nil {
-				fmt.Printf("Error reading .env file: %v\n", err)
-				continue
-			}
-
-			// Parse lines
-			lines := string(content)
-			for _, line := range strings.Split(lines, "\n") {
-				line = strings.TrimSpace(line)
-				if line == "" || strings.HasPrefix(line, "#") {
-					continue
-				}
-
-				parts := strings.SplitN(line, "=", 2)
-				if len(parts) != 2 {
-					continue
-				}
-
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-
-				// Handle quoted values
-				if len(value) > 1 && (strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")) ||
-					(strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'")) {
-					value = value[1 : len(value)-1]
-				}
-
-				// Set environment variable
-				os.Setenv(key, value)
-			}
-
-			// Successfully loaded .env file
-			return
-		}
-	}
-
-	// If we get here, no .env file was found
-	fmt.Println("Warning: No .env file found")
-}
-
-// fileExists checks if a file exists and is not a directory
-func fileExists(path string) bool {
-	info, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		return false
-	}
-	return !info.IsDir()
-}
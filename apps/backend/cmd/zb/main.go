@@ -0,0 +1,249 @@
+// Command zb runs maintenance tasks for the ZeroBalance API, such as
+// migrating the database as a deploy step of its own. It reads the same
+// configuration as the server. Run it without
+// arguments for the list of commands.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kevinlucasklein/zero-balance/config"
+	"github.com/kevinlucasklein/zero-balance/database"
+)
+
+const usage = `Usage:
+  zb migrate [-dry-run] up             apply every pending migration
+  zb migrate [-dry-run] down [n]       roll back the latest n migrations (default 1)
+  zb migrate [-dry-run] to <version>   apply or roll back until version is the latest applied
+  zb migrate [-dry-run] redo           roll back the latest migration and apply it again
+  zb migrate status                    list migrations and when they were applied
+  zb migrate [-dir path] create <name> add empty migration files
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "migrate":
+		os.Exit(migrate(os.Args[2:]))
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "zb: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+// migrate runs a migrate subcommand and returns the exit code
+func migrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	dryRun := flags.Bool("dry-run", false, "print the SQL instead of running it")
+	dir := flags.String("dir", "database/migrations", "directory create writes to")
+
+	// Flags may come anywhere, before, between or after the arguments
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) == 0 {
+		flags.Usage()
+		return 2
+	}
+	command, params := positional[0], positional[1:]
+
+	if command == "create" {
+		if len(params) != 1 {
+			return usageError("create takes the migration name")
+		}
+		up, down, err := database.CreateMigration(*dir, params[0])
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Printf("Created %s\nCreated %s\n", up, down)
+		return 0
+	}
+
+	// would words a summary for the dry run, where nothing has happened
+	would := func(done, dry string) string {
+		if *dryRun {
+			return dry
+		}
+		return done
+	}
+
+	// Check the arguments before connecting
+	var run func(ctx context.Context, m *database.Migrator) int
+	switch command {
+	case "up":
+		if len(params) != 0 {
+			return usageError("up takes no arguments")
+		}
+		run = func(ctx context.Context, m *database.Migrator) int {
+			n, err := m.Up(ctx)
+			if err != nil {
+				return fail(err)
+			}
+			fmt.Printf("%s %d migration(s)\n", would("Applied", "Would apply"), n)
+			return 0
+		}
+
+	case "down":
+		if len(params) > 1 {
+			return usageError("down takes at most one argument")
+		}
+		steps := 1
+		if len(params) == 1 {
+			var err error
+			steps, err = strconv.Atoi(params[0])
+			if err != nil || steps < 1 {
+				return usageError("down takes a positive number of migrations")
+			}
+		}
+		run = func(ctx context.Context, m *database.Migrator) int {
+			n, err := m.Down(ctx, steps)
+			if err != nil {
+				return fail(err)
+			}
+			fmt.Printf("%s %d migration(s)\n", would("Rolled back", "Would roll back"), n)
+			return 0
+		}
+
+	case "to":
+		if len(params) != 1 {
+			return usageError("to takes the version to migrate to")
+		}
+		version, err := strconv.ParseInt(params[0], 10, 64)
+		if err != nil || version < 0 {
+			return usageError("to takes a version number, or 0 to roll back everything")
+		}
+		run = func(ctx context.Context, m *database.Migrator) int {
+			n, err := m.To(ctx, version)
+			if err != nil {
+				return fail(err)
+			}
+			fmt.Printf("%s %d migration(s)\n", would("Ran", "Would run"), n)
+			return 0
+		}
+
+	case "redo":
+		if len(params) != 0 {
+			return usageError("redo takes no arguments")
+		}
+		run = func(ctx context.Context, m *database.Migrator) int {
+			migration, err := m.Redo(ctx)
+			if err != nil {
+				return fail(err)
+			}
+			fmt.Printf("%s %s\n", would("Redid", "Would redo"), migration.File)
+			return 0
+		}
+
+	case "status":
+		if len(params) != 0 {
+			return usageError("status takes no arguments")
+		}
+		run = status
+
+	default:
+		return usageError(fmt.Sprintf("unknown migrate command %q", command))
+	}
+
+	// Interrupting cancels the running statement, whose transaction is rolled back
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fail(fmt.Errorf("invalid configuration:\n%v", err))
+	}
+	db, err := database.ConnectDB(ctx, cfg.Database)
+	if err != nil {
+		return fail(err)
+	}
+	defer db.Close()
+
+	m, err := db.Migrator()
+	if err != nil {
+		return fail(err)
+	}
+	if *dryRun {
+		m.DryRun = os.Stdout
+	}
+	return run(ctx, m)
+}
+
+// status prints every migration and its state. It fails when an applied
+// migration was edited, which would stop the server starting.
+func status(ctx context.Context, m *database.Migrator) int {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return fail(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	counts := map[database.MigrationState]int{}
+	for _, s := range statuses {
+		appliedAt := "-"
+		if !s.AppliedAt.IsZero() {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, s.State, appliedAt)
+		counts[s.State]++
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d applied, %d pending\n", counts[database.StateApplied], counts[database.StatePending])
+	if counts[database.StateMissing] > 0 {
+		fmt.Printf("%d applied migration(s) missing from this build, which cannot roll back past them\n", counts[database.StateMissing])
+	}
+	if counts[database.StateEdited] > 0 {
+		return fail(fmt.Errorf("%d applied migration(s) edited, the server will refuse to start", counts[database.StateEdited]))
+	}
+	return 0
+}
+
+// parseInterspersed parses flags found anywhere in args, which the flag
+// package alone stops looking for at the first argument, and returns the
+// arguments left over. A "--" ends the flags.
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := flags.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// usageError reports a mistake in the command line
+func usageError(msg string) int {
+	fmt.Fprintf(os.Stderr, "zb migrate: %s\n\n%s", msg, usage)
+	return 2
+}
+
+// fail reports an error
+func fail(err error) int {
+	fmt.Fprintf(os.Stderr, "zb migrate: %v\n", err)
+	return 1
+}
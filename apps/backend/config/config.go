@@ -0,0 +1,263 @@
+// Package config loads the server's configuration. Every setting is read, in
+// increasing order of precedence, from its default, a YAML or TOML config
+// file, the .env file and the environment, and the result is validated as a
+// whole before anything starts.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kevinlucasklein/zero-balance/database"
+	"github.com/kevinlucasklein/zero-balance/mailer"
+	"github.com/kevinlucasklein/zero-balance/oidc"
+	"github.com/kevinlucasklein/zero-balance/utils"
+)
+
+// Config is the configuration of the server and the zb command
+type Config struct {
+	// Environment is "production" in production, which enables stricter checks
+	Environment string
+	// Debug enables the /debug endpoint's details
+	Debug bool
+
+	Server   Server
+	Database database.Config
+	Tokens   utils.KeyConfig
+	Mail     mailer.Config
+	OIDC     oidc.ProvidersConfig
+
+	// file and dotEnvFile are the paths read, empty if there was none
+	file       string
+	dotEnvFile string
+	// sources records where each setting came from, by its environment variable
+	sources map[string]Source
+}
+
+// Server configures the HTTP server
+type Server struct {
+	Port string
+	// ProxyHeader is the header a load balancer puts the client IP in, e.g.
+	// X-Forwarded-For, so per-IP limits apply to clients, not the proxy
+	ProxyHeader string
+	// CORSOrigins lists the origins allowed in production, comma separated.
+	// Every origin is allowed elsewhere.
+	CORSOrigins string
+	// AppURL is the frontend's URL, which emailed links point into
+	AppURL string
+	// LockoutStore and RateLimitStore are "postgres", shared between
+	// replicas, or "memory"
+	LockoutStore   string
+	RateLimitStore string
+	// MigrateOnStart applies pending migrations when the server starts
+	MigrateOnStart bool
+}
+
+// Source is where a setting's value came from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "config file"
+	SourceDotEnv  Source = ".env"
+	SourceEnv     Source = "environment"
+)
+
+// Defaults returns the configuration used when nothing is set
+func Defaults() *Config {
+	return &Config{
+		Environment: "development",
+		Server: Server{
+			Port:           "8080",
+			CORSOrigins:    "https://zero-balance.vercel.app",
+			AppURL:         "http://localhost:5173",
+			LockoutStore:   "postgres",
+			RateLimitStore: "postgres",
+			MigrateOnStart: true,
+		},
+		Database: database.DefaultConfig(),
+		Mail: mailer.Config{
+			SMTPPort: "587",
+			From:     "ZeroBalance <no-reply@zero-balance.app>",
+		},
+		OIDC: oidc.ProvidersConfig{
+			GoogleIssuer: "https://accounts.google.com",
+		},
+	}
+}
+
+// Load reads the configuration from every source and validates it. The
+// config file is CONFIG_FILE, or else config.yaml, config.yml or config.toml
+// in the working directory if there is one. Empty values count as unset.
+// The error lists every problem found.
+func Load() (*Config, error) {
+	cfg := Defaults()
+	cfg.sources = map[string]Source{}
+
+	dotEnv, dotEnvFile, err := readDotEnv()
+	if err != nil {
+		return nil, err
+	}
+	cfg.dotEnvFile = dotEnvFile
+
+	path := lookupEnv(nil, "CONFIG_FILE")
+	if path == "" {
+		path = lookupEnv(dotEnv, "CONFIG_FILE")
+	}
+	if path == "" {
+		path = findConfigFile()
+	}
+	var file map[string]string
+	if path != "" {
+		if file, err = readConfigFile(path); err != nil {
+			return nil, err
+		}
+		cfg.file = path
+	}
+
+	var errs []error
+	for _, s := range settings {
+		field := s.field(cfg)
+		cfg.sources[s.name()] = SourceDefault
+		set := func(source Source, name, value string) {
+			if value == "" {
+				return
+			}
+			if err := parseValue(field, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s (from %s): %v", name, source, err))
+				return
+			}
+			cfg.sources[s.name()] = source
+		}
+
+		set(SourceFile, s.key, file[s.key])
+		name, value := s.lookup(dotEnv)
+		set(SourceDotEnv, name, value)
+		name, value = s.lookup(nil)
+		set(SourceEnv, name, value)
+	}
+
+	// The sign-in callback is a page of the frontend unless set otherwise
+	if cfg.OIDC.RedirectBaseURL == "" {
+		cfg.OIDC.RedirectBaseURL = strings.TrimRight(cfg.Server.AppURL, "/") + "/auth/callback"
+	}
+	cfg.Server.LockoutStore = strings.ToLower(cfg.Server.LockoutStore)
+	cfg.Server.RateLimitStore = strings.ToLower(cfg.Server.RateLimitStore)
+
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+// IsProduction reports whether the server runs in production
+func (c *Config) IsProduction() bool {
+	return c.Environment == "production"
+}
+
+// validate checks the values that parsed, naming settings by their
+// environment variable
+func (c *Config) validate() []error {
+	var errs []error
+	invalid := func(name, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s %s", name, fmt.Sprintf(format, args...)))
+	}
+
+	if !isPort(c.Server.Port) {
+		invalid("PORT", "must be a port number, got %q", c.Server.Port)
+	}
+	if !isHTTPURL(c.Server.AppURL) {
+		invalid("APP_URL", "must be an http or https URL, got %q", c.Server.AppURL)
+	}
+	for _, origin := range strings.Split(c.Server.CORSOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "*" && !isHTTPURL(origin) {
+			invalid("CORS_ORIGINS", "must list http or https origins, got %q", origin)
+		}
+	}
+	if c.Server.LockoutStore != "postgres" && c.Server.LockoutStore != "memory" {
+		invalid("LOCKOUT_STORE", "must be postgres or memory, got %q", c.Server.LockoutStore)
+	}
+	if c.Server.RateLimitStore != "postgres" && c.Server.RateLimitStore != "memory" {
+		invalid("RATE_LIMIT_STORE", "must be postgres or memory, got %q", c.Server.RateLimitStore)
+	}
+
+	db := c.Database
+	if !isPort(db.Port) {
+		invalid("DB_PORT", "must be a port number, got %q", db.Port)
+	}
+	switch db.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		invalid("DB_SSL_MODE", "must be disable, allow, prefer, require, verify-ca or verify-full, got %q", db.SSLMode)
+	}
+	if db.ConnectTimeout < 0 {
+		invalid("DB_CONNECT_TIMEOUT", "must not be negative")
+	}
+	if db.MaxOpenConns < 0 {
+		invalid("DB_MAX_OPEN_CONNS", "must not be negative")
+	}
+	if db.MaxIdleConns < 0 {
+		invalid("DB_MAX_IDLE_CONNS", "must not be negative")
+	}
+	if db.MaxOpenConns > 0 && db.MaxIdleConns > db.MaxOpenConns {
+		invalid("DB_MAX_IDLE_CONNS", "must not exceed DB_MAX_OPEN_CONNS (%d)", db.MaxOpenConns)
+	}
+	if db.ConnMaxLifetime < 0 {
+		invalid("DB_CONN_MAX_LIFETIME", "must not be negative")
+	}
+	if db.QueryTimeout < 0 {
+		invalid("DB_QUERY_TIMEOUT", "must not be negative")
+	}
+
+	if len(c.Tokens.PublicKeyFiles) > 0 && c.Tokens.PrivateKeyFile == "" {
+		invalid("JWT_PUBLIC_KEY_FILES", "requires JWT_PRIVATE_KEY_FILE")
+	}
+	if c.Tokens.KeyID != "" && c.Tokens.PrivateKeyFile == "" {
+		invalid("JWT_KEY_ID", "requires JWT_PRIVATE_KEY_FILE")
+	}
+
+	if c.Mail.SMTPHost != "" && !isPort(c.Mail.SMTPPort) {
+		invalid("SMTP_PORT", "must be a port number, got %q", c.Mail.SMTPPort)
+	}
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		invalid("MAIL_FROM", "must be an email address, got %q", c.Mail.From)
+	}
+
+	providers := c.OIDC
+	if providers.GoogleClientID != "" && providers.GoogleClientSecret == "" {
+		invalid("GOOGLE_CLIENT_SECRET", "is required with GOOGLE_CLIENT_ID")
+	}
+	if !isHTTPURL(providers.GoogleIssuer) {
+		invalid("GOOGLE_ISSUER", "must be an http or https URL, got %q", providers.GoogleIssuer)
+	}
+	if providers.GitHubClientID != "" && providers.GitHubClientSecret == "" {
+		invalid("GITHUB_CLIENT_SECRET", "is required with GITHUB_CLIENT_ID")
+	}
+	if providers.GitHubURL != "" && !isHTTPURL(providers.GitHubURL) {
+		invalid("GITHUB_URL", "must be an http or https URL, got %q", providers.GitHubURL)
+	}
+	if providers.GitHubAPIURL != "" && !isHTTPURL(providers.GitHubAPIURL) {
+		invalid("GITHUB_API_URL", "must be an http or https URL, got %q", providers.GitHubAPIURL)
+	}
+	if !isHTTPURL(providers.RedirectBaseURL) {
+		invalid("OIDC_REDIRECT_URL", "must be an http or https URL, got %q", providers.RedirectBaseURL)
+	}
+	return errs
+}
+
+// isPort reports whether s is a TCP port number
+func isPort(s string) bool {
+	port, err := strconv.Atoi(s)
+	return err == nil && port > 0 && port <= 65535
+}
+
+// isHTTPURL reports whether s is an absolute http or https URL
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
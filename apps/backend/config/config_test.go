@@ -0,0 +1,267 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadIn loads the configuration in a fresh working directory holding files,
+// by name, with only the variables in env set
+func loadIn(t *testing.T, files, env map[string]string) (*Config, error) {
+	t.Helper()
+
+	// Nest the working directory so the ../.env and ../../.env candidates
+	// are inside the test's own directory too
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	// Empty variables count as unset, which hides any from the environment
+	// running the tests
+	t.Setenv("CONFIG_FILE", "")
+	for _, s := range settings {
+		for _, name := range s.env {
+			t.Setenv(name, "")
+		}
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	return Load()
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		env        map[string]string
+		wantPort   string
+		wantSource Source
+	}{
+		{
+			name:       "default",
+			wantPort:   "8080",
+			wantSource: SourceDefault,
+		},
+		{
+			name:       "yaml file over the default",
+			files:      map[string]string{"config.yaml": "server:\n  port: 8081\n"},
+			wantPort:   "8081",
+			wantSource: SourceFile,
+		},
+		{
+			name:       "toml file over the default",
+			files:      map[string]string{"config.toml": "[server]\nport = 8081\n"},
+			wantPort:   "8081",
+			wantSource: SourceFile,
+		},
+		{
+			name: ".env over the file",
+			files: map[string]string{
+				"config.yaml": "server:\n  port: 8081\n",
+				".env":        "PORT=8082\n",
+			},
+			wantPort:   "8082",
+			wantSource: SourceDotEnv,
+		},
+		{
+			name: "environment over .env",
+			files: map[string]string{
+				"config.yaml": "server:\n  port: 8081\n",
+				".env":        "PORT=8082\n",
+			},
+			env:        map[string]string{"PORT": "8083"},
+			wantPort:   "8083",
+			wantSource: SourceEnv,
+		},
+		{
+			name:       "empty environment variable counts as unset",
+			files:      map[string]string{".env": "PORT=8082\n"},
+			env:        map[string]string{"PORT": ""},
+			wantPort:   "8082",
+			wantSource: SourceDotEnv,
+		},
+		{
+			name: "CONFIG_FILE over the file in the working directory",
+			files: map[string]string{
+				"config.yaml": "server:\n  port: 8081\n",
+				"custom.toml": "[server]\nport = 8084\n",
+			},
+			env:        map[string]string{"CONFIG_FILE": "custom.toml"},
+			wantPort:   "8084",
+			wantSource: SourceFile,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadIn(t, tt.files, tt.env)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Server.Port != tt.wantPort {
+				t.Fatalf("port = %q, want %q", cfg.Server.Port, tt.wantPort)
+			}
+			if source := cfg.Source("PORT"); source != tt.wantSource {
+				t.Fatalf("source = %q, want %q", source, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownFileKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		// content has a misspelt setting
+		content string
+		wantKey string
+	}{
+		{name: "yaml", file: "config.yaml", content: "server:\n  prot: 8081\n", wantKey: "server.prot"},
+		{name: "toml", file: "config.toml", content: "[databse]\nhost = \"db\"\n", wantKey: "databse.host"},
+		{name: "top level", file: "config.yml", content: "enviroment: production\n", wantKey: "enviroment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadIn(t, map[string]string{tt.file: tt.content}, nil)
+			if err == nil {
+				t.Fatal("Load succeeded, want an unknown setting error")
+			}
+			if !strings.Contains(err.Error(), "unknown setting") || !strings.Contains(err.Error(), tt.wantKey) {
+				t.Fatalf("error %q, want it to name the unknown setting %s", err, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestLoadPGFallbacks(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		env        map[string]string
+		wantHost   string
+		wantSource Source
+	}{
+		{
+			name:       "PGHOST when DB_HOST is unset",
+			env:        map[string]string{"PGHOST": "railway.internal"},
+			wantHost:   "railway.internal",
+			wantSource: SourceEnv,
+		},
+		{
+			name:       "DB_HOST over PGHOST",
+			env:        map[string]string{"DB_HOST": "db.example.com", "PGHOST": "railway.internal"},
+			wantHost:   "db.example.com",
+			wantSource: SourceEnv,
+		},
+		{
+			name:       "PGHOST in .env",
+			files:      map[string]string{".env": "PGHOST=railway.internal\n"},
+			wantHost:   "railway.internal",
+			wantSource: SourceDotEnv,
+		},
+		{
+			name:       "PGHOST in the environment over DB_HOST in .env",
+			files:      map[string]string{".env": "DB_HOST=db.example.com\n"},
+			env:        map[string]string{"PGHOST": "railway.internal"},
+			wantHost:   "railway.internal",
+			wantSource: SourceEnv,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadIn(t, tt.files, tt.env)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Database.Host != tt.wantHost {
+				t.Fatalf("host = %q, want %q", cfg.Database.Host, tt.wantHost)
+			}
+			if source := cfg.Source("DB_HOST"); source != tt.wantSource {
+				t.Fatalf("source = %q, want %q", source, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg, err := loadIn(t, nil, map[string]string{
+		"PGPASSWORD": "hunter2",
+		"JWT_SECRET": "jwt-secret",
+		"SMTP_HOST":  "smtp.example.com",
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "DB_PASS", want: redacted},
+		{name: "JWT_SECRET", want: redacted},
+		// Secrets that are not set show as unset, not redacted
+		{name: "SMTP_PASSWORD", want: ""},
+		{name: "SMTP_HOST", want: "smtp.example.com"},
+	}
+	values := cfg.Redacted()
+	for _, tt := range tests {
+		if got := values[tt.name]; got != tt.want {
+			t.Errorf("Redacted()[%s] = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	var out bytes.Buffer
+	cfg.Print(&out)
+	for _, secret := range []string{"hunter2", "jwt-secret"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("Print output contains the secret %q:\n%s", secret, out.String())
+		}
+	}
+}
+
+func TestLoadCombinesErrors(t *testing.T) {
+	_, err := loadIn(t,
+		map[string]string{"config.yaml": "database:\n  max_open_conns: many\n"},
+		map[string]string{
+			"PORT":             "http",
+			"LOCKOUT_STORE":    "redis",
+			"GOOGLE_CLIENT_ID": "client",
+		},
+	)
+	if err == nil {
+		t.Fatal("Load succeeded, want errors")
+	}
+
+	for _, want := range []string{
+		"database.max_open_conns (from config file): must be an integer",
+		"PORT must be a port number",
+		"LOCKOUT_STORE must be postgres or memory",
+		"GOOGLE_CLIENT_SECRET is required with GOOGLE_CLIENT_ID",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not report %q:\n%v", want, err)
+		}
+	}
+}
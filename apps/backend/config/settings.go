@@ -0,0 +1,197 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// redacted replaces the value of secret settings when printed
+const redacted = "[REDACTED]"
+
+// setting is one configuration value
+type setting struct {
+	// env names the environment variables setting it, in order of preference.
+	// The first one names the setting, the others are fallbacks such as the
+	// PG* variables Railway sets.
+	env []string
+	// key is the setting's dotted path in the config file
+	key string
+	// secret settings are redacted when printed
+	secret bool
+	// field returns a pointer to the value in a Config
+	field func(c *Config) interface{}
+}
+
+// settings lists every setting in the order they are printed
+var settings = []setting{
+	{env: []string{"ENVIRONMENT", "RAILWAY_ENVIRONMENT_NAME"}, key: "environment", field: func(c *Config) interface{} { return &c.Environment }},
+	{env: []string{"DEBUG"}, key: "debug", field: func(c *Config) interface{} { return &c.Debug }},
+
+	{env: []string{"PORT"}, key: "server.port", field: func(c *Config) interface{} { return &c.Server.Port }},
+	{env: []string{"PROXY_HEADER"}, key: "server.proxy_header", field: func(c *Config) interface{} { return &c.Server.ProxyHeader }},
+	{env: []string{"CORS_ORIGINS"}, key: "server.cors_origins", field: func(c *Config) interface{} { return &c.Server.CORSOrigins }},
+	{env: []string{"APP_URL"}, key: "server.app_url", field: func(c *Config) interface{} { return &c.Server.AppURL }},
+	{env: []string{"LOCKOUT_STORE"}, key: "server.lockout_store", field: func(c *Config) interface{} { return &c.Server.LockoutStore }},
+	{env: []string{"RATE_LIMIT_STORE"}, key: "server.rate_limit_store", field: func(c *Config) interface{} { return &c.Server.RateLimitStore }},
+	{env: []string{"MIGRATE_ON_START"}, key: "server.migrate_on_start", field: func(c *Config) interface{} { return &c.Server.MigrateOnStart }},
+
+	{env: []string{"DB_HOST", "PGHOST"}, key: "database.host", field: func(c *Config) interface{} { return &c.Database.Host }},
+	{env: []string{"DB_PORT", "PGPORT"}, key: "database.port", field: func(c *Config) interface{} { return &c.Database.Port }},
+	{env: []string{"DB_USER", "PGUSER"}, key: "database.user", field: func(c *Config) interface{} { return &c.Database.User }},
+	{env: []string{"DB_PASS", "PGPASSWORD"}, key: "database.password", secret: true, field: func(c *Config) interface{} { return &c.Database.Password }},
+	{env: []string{"DB_NAME", "PGDATABASE"}, key: "database.name", field: func(c *Config) interface{} { return &c.Database.Name }},
+	{env: []string{"DB_SSL_MODE"}, key: "database.ssl_mode", field: func(c *Config) interface{} { return &c.Database.SSLMode }},
+	{env: []string{"DB_CONNECT_TIMEOUT"}, key: "database.connect_timeout", field: func(c *Config) interface{} { return &c.Database.ConnectTimeout }},
+	{env: []string{"DB_MAX_OPEN_CONNS"}, key: "database.max_open_conns", field: func(c *Config) interface{} { return &c.Database.MaxOpenConns }},
+	{env: []string{"DB_MAX_IDLE_CONNS"}, key: "database.max_idle_conns", field: func(c *Config) interface{} { return &c.Database.MaxIdleConns }},
+	{env: []string{"DB_CONN_MAX_LIFETIME"}, key: "database.conn_max_lifetime", field: func(c *Config) interface{} { return &c.Database.ConnMaxLifetime }},
+	{env: []string{"DB_QUERY_TIMEOUT"}, key: "database.query_timeout", field: func(c *Config) interface{} { return &c.Database.QueryTimeout }},
+
+	{env: []string{"JWT_SECRET"}, key: "tokens.secret", secret: true, field: func(c *Config) interface{} { return &c.Tokens.Secret }},
+	{env: []string{"JWT_PRIVATE_KEY_FILE"}, key: "tokens.private_key_file", field: func(c *Config) interface{} { return &c.Tokens.PrivateKeyFile }},
+	{env: []string{"JWT_KEY_ID"}, key: "tokens.key_id", field: func(c *Config) interface{} { return &c.Tokens.KeyID }},
+	{env: []string{"JWT_PUBLIC_KEY_FILES"}, key: "tokens.public_key_files", field: func(c *Config) interface{} { return &c.Tokens.PublicKeyFiles }},
+	{env: []string{"JWT_ISSUER"}, key: "tokens.issuer", field: func(c *Config) interface{} { return &c.Tokens.Issuer }},
+	{env: []string{"JWT_AUDIENCE"}, key: "tokens.audience", field: func(c *Config) interface{} { return &c.Tokens.Audience }},
+
+	{env: []string{"SMTP_HOST"}, key: "mail.smtp_host", field: func(c *Config) interface{} { return &c.Mail.SMTPHost }},
+	{env: []string{"SMTP_PORT"}, key: "mail.smtp_port", field: func(c *Config) interface{} { return &c.Mail.SMTPPort }},
+	{env: []string{"SMTP_USERNAME"}, key: "mail.smtp_username", field: func(c *Config) interface{} { return &c.Mail.SMTPUsername }},
+	{env: []string{"SMTP_PASSWORD"}, key: "mail.smtp_password", secret: true, field: func(c *Config) interface{} { return &c.Mail.SMTPPassword }},
+	{env: []string{"MAIL_FROM"}, key: "mail.from", field: func(c *Config) interface{} { return &c.Mail.From }},
+	{env: []string{"MAIL_FILE"}, key: "mail.file", field: func(c *Config) interface{} { return &c.Mail.File }},
+
+	{env: []string{"OIDC_REDIRECT_URL"}, key: "oidc.redirect_url", field: func(c *Config) interface{} { return &c.OIDC.RedirectBaseURL }},
+	{env: []string{"GOOGLE_CLIENT_ID"}, key: "oidc.google.client_id", field: func(c *Config) interface{} { return &c.OIDC.GoogleClientID }},
+	{env: []string{"GOOGLE_CLIENT_SECRET"}, key: "oidc.google.client_secret", secret: true, field: func(c *Config) interface{} { return &c.OIDC.GoogleClientSecret }},
+	{env: []string{"GOOGLE_ISSUER"}, key: "oidc.google.issuer", field: func(c *Config) interface{} { return &c.OIDC.GoogleIssuer }},
+	{env: []string{"GITHUB_CLIENT_ID"}, key: "oidc.github.client_id", field: func(c *Config) interface{} { return &c.OIDC.GitHubClientID }},
+	{env: []string{"GITHUB_CLIENT_SECRET"}, key: "oidc.github.client_secret", secret: true, field: func(c *Config) interface{} { return &c.OIDC.GitHubClientSecret }},
+	{env: []string{"GITHUB_URL"}, key: "oidc.github.url", field: func(c *Config) interface{} { return &c.OIDC.GitHubURL }},
+	{env: []string{"GITHUB_API_URL"}, key: "oidc.github.api_url", field: func(c *Config) interface{} { return &c.OIDC.GitHubAPIURL }},
+}
+
+// name is the setting's main environment variable
+func (s setting) name() string {
+	return s.env[0]
+}
+
+// lookup returns the first of the setting's variables set in vars, or in
+// the environment when vars is nil, and its value
+func (s setting) lookup(vars map[string]string) (string, string) {
+	for _, name := range s.env {
+		if value := lookupEnv(vars, name); value != "" {
+			return name, value
+		}
+	}
+	return s.name(), ""
+}
+
+// parseValue parses value into the field it points to. Lists are comma
+// separated.
+func parseValue(field interface{}, value string) error {
+	switch field := field.(type) {
+	case *string:
+		*field = value
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be true or false, got %q", value)
+		}
+		*field = b
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("must be an integer, got %q", value)
+		}
+		*field = n
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 30s or 5m, got %q", value)
+		}
+		*field = d
+	case *[]string:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field = list
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %T", field))
+	}
+	return nil
+}
+
+// formatValue formats the value a field points to as parseValue reads it
+func formatValue(field interface{}) string {
+	switch field := field.(type) {
+	case *string:
+		return *field
+	case *bool:
+		return strconv.FormatBool(*field)
+	case *int:
+		return strconv.Itoa(*field)
+	case *time.Duration:
+		return field.String()
+	case *[]string:
+		return strings.Join(*field, ",")
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %T", field))
+	}
+}
+
+// Redacted returns every setting's value by environment variable, with
+// secrets that are set replaced by [REDACTED]
+func (c *Config) Redacted() map[string]string {
+	values := make(map[string]string, len(settings))
+	for _, s := range settings {
+		values[s.name()] = c.display(s)
+	}
+	return values
+}
+
+// Print writes the effective configuration with secrets redacted, and where
+// each value came from
+func (c *Config) Print(w io.Writer) {
+	fmt.Fprintln(w, "Configuration:")
+	if c.file != "" {
+		fmt.Fprintf(w, "  config file: %s\n", c.file)
+	}
+	if c.dotEnvFile != "" {
+		fmt.Fprintf(w, "  .env file: %s\n", c.dotEnvFile)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, s := range settings {
+		value := c.display(s)
+		if value == "" {
+			value = "-"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t(%s)\n", s.name(), value, c.Source(s.name()))
+	}
+	tw.Flush()
+}
+
+// Source returns where the setting named by an environment variable came from
+func (c *Config) Source(name string) Source {
+	if source, ok := c.sources[name]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// display formats a setting's value for printing
+func (c *Config) display(s setting) string {
+	value := formatValue(s.field(c))
+	if s.secret && value != "" {
+		return redacted
+	}
+	return value
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// readDotEnv reads the first .env file found and returns its variables and
+// path. Unlike earlier versions it does not set them in the environment, so
+// variables set there take precedence. Having no .env file is not an error.
+func readDotEnv() (map[string]string, string, error) {
+	possiblePaths := []string{
+		".env",       // When running from project root
+		"../.env",    // When running from cmd directory
+		"../../.env", // When running from a nested directory
+		"/app/.env",  // When running in Docker container
+		filepath.Join(filepath.Dir(os.Args[0]), ".env"), // Next to the binary
+	}
+
+	for _, path := range possiblePaths {
+		if !fileExists(path) {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading .env file: %v", err)
+		}
+
+		vars := map[string]string{}
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			key := strings.TrimSpace(parts[0])
+			value := strings.TrimSpace(parts[1])
+
+			// Handle quoted values
+			if len(value) > 1 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+				value = value[1 : len(value)-1]
+			}
+			vars[key] = value
+		}
+		return vars, path, nil
+	}
+	return map[string]string{}, "", nil
+}
+
+// lookupEnv returns a variable from vars, or from the environment when vars
+// is nil
+func lookupEnv(vars map[string]string, key string) string {
+	if vars == nil {
+		return os.Getenv(key)
+	}
+	return vars[key]
+}
+
+// findConfigFile returns the config file in the working directory, if any
+func findConfigFile() string {
+	for _, path := range []string{"config.yaml", "config.yml", "config.toml"} {
+		if fileExists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// readConfigFile reads a YAML or TOML config file, chosen by its extension,
+// into values by dotted key, e.g. database.host. Lists are joined with
+// commas. Keys that are not settings are an error, so typos do not go
+// unnoticed.
+func readConfigFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	tree := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &tree)
+	case ".toml":
+		err = toml.Unmarshal(content, &tree)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+
+	values := map[string]string{}
+	if err := flatten(values, "", tree); err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+
+	known := map[string]bool{}
+	for _, s := range settings {
+		known[s.key] = true
+	}
+	var unknown []string
+	for key := range values {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("config file %s: unknown setting(s) %s", path, strings.Join(unknown, ", "))
+	}
+	return values, nil
+}
+
+// flatten adds the values of a decoded file to values by dotted key
+func flatten(values map[string]string, prefix string, tree map[string]interface{}) error {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if err := flatten(values, key, value); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				switch item.(type) {
+				case map[string]interface{}, []interface{}:
+					return fmt.Errorf("%s must be a list of values", key)
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			// An empty value, or a section with every setting commented out
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
+
+// fileExists checks if a file exists and is not a directory
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return !info.IsDir()
+}
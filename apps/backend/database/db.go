@@ -1,96 +1,142 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
 	"time"
 
 	_ "github.com/lib/pq"
 )
 
-var DB *sql.DB
-
-func ConnectDB() error {
-	// Check for Railway-specific PostgreSQL environment variables first
-	dbUser := getEnvWithFallbacks("DB_USER", "PGUSER", "zero_user")
-	dbPass := getEnvWithFallbacks("DB_PASS", "PGPASSWORD", "zero_pass")
-	dbName := getEnvWithFallbacks("DB_NAME", "PGDATABASE", "zero_balance")
-	dbHost := getEnvWithFallbacks("DB_HOST", "PGHOST", "localhost")
-	dbPort := getEnvWithFallbacks("DB_PORT", "PGPORT", "5432")
-	sslMode := getEnv("DB_SSL_MODE", "disable")
-
-	// Build connection string
-	connStr := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s connect_timeout=5",
-		dbHost, dbPort, dbUser, dbPass, dbName, sslMode,
+// Config describes the PostgreSQL server to connect to and how to pool
+// connections to it
+type Config struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+
+	// ConnectTimeout bounds each attempt to open a connection
+	ConnectTimeout time.Duration
+	// MaxOpenConns caps the connections in use plus idle, zero means unlimited
+	MaxOpenConns int
+	// MaxIdleConns caps the connections kept open between queries
+	MaxIdleConns int
+	// ConnMaxLifetime is how long a connection is reused before it is closed
+	ConnMaxLifetime time.Duration
+	// QueryTimeout bounds the queries of a single request, zero means no limit
+	QueryTimeout time.Duration
+}
+
+// DefaultConfig returns the settings used for anything the configuration leaves unset
+func DefaultConfig() Config {
+	return Config{
+		Host:            "localhost",
+		Port:            "5432",
+		User:            "zero_user",
+		Password:        "zero_pass",
+		Name:            "zero_balance",
+		SSLMode:         "disable",
+		ConnectTimeout:  5 * time.Second,
+		MaxOpenConns:    25,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 5 * time.Minute,
+		QueryTimeout:    10 * time.Second,
+	}
+}
+
+// connString returns the lib/pq connection string for the config
+func (cfg Config) connString() string {
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s connect_timeout=%d",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, cfg.SSLMode,
+		int(cfg.ConnectTimeout.Seconds()),
 	)
+}
+
+// Store is a connection pool to the database, shared by every request
+type Store struct {
+	DB *sql.DB
+}
 
+// ConnectDB opens a connection pool as described by cfg and checks that the
+// server answers
+func ConnectDB(ctx context.Context, cfg Config) (*Store, error) {
 	// Log connection attempt (without password)
 	log.Printf("Connecting to PostgreSQL at %s:%s/%s (user: %s, sslmode: %s)",
-		dbHost, dbPort, dbName, dbUser, sslMode)
+		cfg.Host, cfg.Port, cfg.Name, cfg.User, cfg.SSLMode)
 
-	// Connect to database
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", cfg.connString())
 	if err != nil {
-		return fmt.Errorf("failed to open database connection: %v", err)
+		return nil, fmt.Errorf("failed to open database connection: %v", err)
 	}
 
-	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(time.Minute * 5)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
-	// Test the connection
-	err = db.Ping()
-	if err != nil {
-		return fmt.Errorf("failed to ping database: %v", err)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %v", err)
 	}
 
 	log.Println("Connected to the PostgreSQL database")
-
-	DB = db
-	return nil
+	return &Store{DB: db}, nil
 }
 
 // InitDB connects to the database and runs migrations
-func InitDB() error {
-	// Connect to the database
-	err := ConnectDB()
+func InitDB(ctx context.Context, cfg Config) (*Store, error) {
+	store, err := ConnectDB(ctx, cfg)
 	if err != nil {
-		return fmt.Errorf("database connection failed: %v", err)
+		return nil, fmt.Errorf("database connection failed: %v", err)
 	}
 
-	// Run migrations
-	if err := RunMigrations(); err != nil {
-		return fmt.Errorf("error running migrations: %v", err)
+	if err := store.RunMigrations(ctx); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("error running migrations: %v", err)
 	}
 
 	log.Println("Database migrations applied successfully")
-	return nil
+	return store, nil
 }
 
-// Helper function to get environment variable with fallback
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists && value != "" {
-		return value
-	}
-	return fallback
+// Close closes every connection of the pool
+func (s *Store) Close() error {
+	return s.DB.Close()
 }
 
-// Helper function to get environment variable with multiple fallbacks
-func getEnvWithFallbacks(key1, key2, fallback string) string {
-	// Try first key
-	if value, exists := os.LookupEnv(key1); exists && value != "" {
-		return value
-	}
+// Ping checks that the database answers
+func (s *Store) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
 
-	// Try second key
-	if value, exists := os.LookupEnv(key2); exists && value != "" {
-		return value
-	}
+// TokenVersion returns a user's current token version, which is bumped
+// whenever their password changes
+func (s *Store) TokenVersion(ctx context.Context, userID int) (int, error) {
+	var version int
+	err := s.DB.QueryRowContext(ctx, "SELECT token_version FROM users WHERE id = $1", userID).Scan(&version)
+	return version, err
+}
 
-	// Return fallback
-	return fallback
+// SessionState reports whether a login session exists and has not been
+// revoked, and its user's current token version, recording that the session
+// was just seen
+func (s *Store) SessionState(ctx context.Context, sessionID string) (bool, int, error) {
+	var active bool
+	var tokenVersion int
+	err := s.DB.QueryRowContext(ctx,
+		`UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP
+		FROM users
+		WHERE sessions.id = $1 AND users.id = sessions.user_id
+		RETURNING sessions.revoked_at IS NULL, users.token_version`,
+		sessionID,
+	).Scan(&active, &tokenVersion)
+	if err == sql.ErrNoRows {
+		return false, 0, nil
+	}
+	return active, tokenVersion, err
 }
@@ -0,0 +1,282 @@
+package database
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles holds the SQL migrations, so the binary carries its schema
+// wherever it runs
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// noTransactionDirective on a line of its own makes a script run outside a
+// transaction, one statement at a time, as CREATE INDEX CONCURRENTLY requires
+const noTransactionDirective = "-- +migrate NoTransaction"
+
+// migrationFileName matches NNN_name.sql and its NNN_name_rollback.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+?)(_rollback)?\.sql$`)
+
+// Script is the SQL of one direction of a migration
+type Script struct {
+	SQL string
+	// NoTransaction is set by the NoTransaction directive
+	NoTransaction bool
+}
+
+// Migration is a versioned schema change and the script that undoes it
+type Migration struct {
+	// Version is the numeric prefix of the file name
+	Version int64
+	// Name is the file name without version and extension, e.g. "initial_schema"
+	Name string
+	// File is the name of the up script, e.g. "001_initial_schema.sql"
+	File string
+	Up   Script
+	// Down is nil when the migration has no rollback file
+	Down *Script
+	// Checksum is the hex SHA-256 of the up script, recorded when it is applied
+	Checksum string
+}
+
+// Migrations returns the embedded migrations in version order
+func Migrations() ([]Migration, error) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return LoadMigrations(sub)
+}
+
+// LoadMigrations reads the .sql files at the root of fsys in version order.
+// Every file must be an up script NNN_name.sql or the rollback script
+// NNN_name_rollback.sql of one, and no two up scripts may share a version.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	type rollback struct {
+		file    string
+		version int64
+		name    string
+		script  Script
+	}
+	byVersion := map[int64]*Migration{}
+	var rollbacks []rollback
+	for _, name := range names {
+		match := migrationFileName.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s is not named NNN_name.sql or NNN_name_rollback.sql", name)
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %s: invalid version: %v", name, err)
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if match[3] != "" {
+			// Attached to its up script once every file has been read
+			rollbacks = append(rollbacks, rollback{name, version, match[2], parseScript(string(content))})
+			continue
+		}
+		if other, ok := byVersion[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other.File, name, version)
+		}
+		sum := sha256.Sum256(content)
+		byVersion[version] = &Migration{
+			Version:  version,
+			Name:     match[2],
+			File:     name,
+			Up:       parseScript(string(content)),
+			Checksum: hex.EncodeToString(sum[:]),
+		}
+	}
+
+	for _, r := range rollbacks {
+		m, ok := byVersion[r.version]
+		if !ok || m.Name != r.name {
+			return nil, fmt.Errorf("rollback file %s does not match any migration", r.file)
+		}
+		m.Down = &r.script
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// CreateMigration writes an up script and a rollback script for a new
+// migration to dir, numbered after the latest migration there, and returns
+// their paths. The name is lowercased with runs of other characters than
+// letters and digits replaced by underscores.
+func CreateMigration(dir, name string) (string, string, error) {
+	slug := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if slug == "" {
+		return "", "", fmt.Errorf("migration name %q has no letters or digits", name)
+	}
+
+	migrations, err := LoadMigrations(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	var version int64 = 1
+	if len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version + 1
+	}
+
+	title := strings.ReplaceAll(slug, "_", " ")
+	title = strings.ToUpper(title[:1]) + title[1:]
+	up := filepath.Join(dir, fmt.Sprintf("%03d_%s.sql", version, slug))
+	down := filepath.Join(dir, fmt.Sprintf("%03d_%s_rollback.sql", version, slug))
+	if err := writeNewFile(up, "-- "+title+"\n\n"); err != nil {
+		return "", "", err
+	}
+	if err := writeNewFile(down, "-- "+title+" rollback\n\n"); err != nil {
+		os.Remove(up)
+		return "", "", err
+	}
+	return up, down, nil
+}
+
+// nonSlug matches what CreateMigration replaces in names
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// writeNewFile writes content to path, which must not exist yet
+func writeNewFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseScript reads the directives of a script
+func parseScript(sql string) Script {
+	script := Script{SQL: sql}
+	for _, line := range strings.Split(sql, "\n") {
+		if strings.TrimSpace(line) == noTransactionDirective {
+			script.NoTransaction = true
+		}
+	}
+	return script
+}
+
+// Statements splits the script at the semicolons that end statements, skipping
+// those inside quotes, comments and dollar-quoted bodies. Statements made only
+// of comments are dropped.
+func (s Script) Statements() []string {
+	sql := s.SQL
+	var statements []string
+	add := func(stmt string) {
+		if !isBlankSQL(stmt) {
+			statements = append(statements, strings.TrimSpace(stmt))
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(sql); {
+		switch {
+		case sql[i] == '\'' || sql[i] == '"':
+			i = skipQuoted(sql, i)
+		case strings.HasPrefix(sql[i:], "--"):
+			i = skipPast(sql, i, "\n")
+		case strings.HasPrefix(sql[i:], "/*"):
+			i = skipPast(sql, i+2, "*/")
+		case sql[i] == '$':
+			if tag := dollarTag(sql[i:]); tag != "" {
+				i = skipPast(sql, i+len(tag), tag)
+			} else {
+				i++
+			}
+		case sql[i] == ';':
+			add(sql[start:i])
+			i++
+			start = i
+		default:
+			i++
+		}
+	}
+	add(sql[start:])
+	return statements
+}
+
+// skipQuoted returns the index after the string or identifier opening at i.
+// A doubled quote stands for the quote itself.
+func skipQuoted(sql string, i int) int {
+	quote := sql[i]
+	for i++; i < len(sql); i++ {
+		if sql[i] != quote {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(sql)
+}
+
+// skipPast returns the index after the first end at or after i
+func skipPast(sql string, i int, end string) int {
+	n := strings.Index(sql[i:], end)
+	if n < 0 {
+		return len(sql)
+	}
+	return i + n + len(end)
+}
+
+// dollarTag returns the $tag$ opening a dollar-quoted body at the start of
+// sql, or "" if there is none. Parameters such as $1 are not tags.
+func dollarTag(sql string) string {
+	for i := 1; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '$':
+			return sql[:i+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 1 && c >= '0' && c <= '9':
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// isBlankSQL reports whether sql holds nothing but whitespace and comments
+func isBlankSQL(sql string) bool {
+	for i := 0; i < len(sql); {
+		switch {
+		case strings.HasPrefix(sql[i:], "--"):
+			i = skipPast(sql, i, "\n")
+		case strings.HasPrefix(sql[i:], "/*"):
+			i = skipPast(sql, i+2, "*/")
+		case strings.ContainsRune(" \t\r\n", rune(sql[i])):
+			i++
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestScriptStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "plain statements",
+			sql:  "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			want: []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name: "no trailing semicolon",
+			sql:  "SELECT 1;\nSELECT 2",
+			want: []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name: "semicolon in a string",
+			sql:  "INSERT INTO a VALUES ('x;y');SELECT 1;",
+			want: []string{"INSERT INTO a VALUES ('x;y')", "SELECT 1"},
+		},
+		{
+			name: "doubled quote in a string",
+			sql:  "INSERT INTO a VALUES ('it''s; fine');SELECT 1;",
+			want: []string{"INSERT INTO a VALUES ('it''s; fine')", "SELECT 1"},
+		},
+		{
+			name: "semicolon in a quoted identifier",
+			sql:  `CREATE TABLE "a;b" (id INT);SELECT 1;`,
+			want: []string{`CREATE TABLE "a;b" (id INT)`, "SELECT 1"},
+		},
+		{
+			name: "semicolon in a line comment",
+			sql:  "SELECT 1; -- first; not a statement\nSELECT 2;",
+			want: []string{"SELECT 1", "-- first; not a statement\nSELECT 2"},
+		},
+		{
+			name: "semicolon in a block comment",
+			sql:  "SELECT /* a; b */ 1;",
+			want: []string{"SELECT /* a; b */ 1"},
+		},
+		{
+			name: "comment-only statements are dropped",
+			sql:  "-- Initial schema\n\nSELECT 1;\n/* trailing; */\n-- end\n",
+			want: []string{"-- Initial schema\n\nSELECT 1"},
+		},
+		{
+			name: "dollar-quoted function body",
+			sql: "CREATE FUNCTION f() RETURNS trigger AS $$\nBEGIN\n  NEW.updated_at = NOW();\n  RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql;\n" +
+				"CREATE TRIGGER t BEFORE UPDATE ON a FOR EACH ROW EXECUTE FUNCTION f();",
+			want: []string{
+				"CREATE FUNCTION f() RETURNS trigger AS $$\nBEGIN\n  NEW.updated_at = NOW();\n  RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql",
+				"CREATE TRIGGER t BEFORE UPDATE ON a FOR EACH ROW EXECUTE FUNCTION f()",
+			},
+		},
+		{
+			name: "tagged dollar quote containing $$",
+			sql:  "DO $body$ BEGIN PERFORM '$$;'; END; $body$;SELECT 1;",
+			want: []string{"DO $body$ BEGIN PERFORM '$$;'; END; $body$", "SELECT 1"},
+		},
+		{
+			name: "parameters are not dollar quotes",
+			sql:  "PREPARE p AS SELECT $1;SELECT 2;",
+			want: []string{"PREPARE p AS SELECT $1", "SELECT 2"},
+		},
+		{
+			name: "concurrent index with the directive",
+			sql:  noTransactionDirective + "\nCREATE INDEX CONCURRENTLY a_idx ON a (id);\nCREATE INDEX CONCURRENTLY b_idx ON b (id);\n",
+			want: []string{
+				noTransactionDirective + "\nCREATE INDEX CONCURRENTLY a_idx ON a (id)",
+				"CREATE INDEX CONCURRENTLY b_idx ON b (id)",
+			},
+		},
+		{
+			name: "empty script",
+			sql:  "\n-- nothing to do\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseScript(tt.sql).Statements()
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScriptNoTransaction(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want bool
+	}{
+		{name: "directive", sql: "-- +migrate NoTransaction\nCREATE INDEX CONCURRENTLY a_idx ON a (id);", want: true},
+		{name: "indented directive", sql: "  -- +migrate NoTransaction  \nSELECT 1;", want: true},
+		{name: "no directive", sql: "CREATE INDEX a_idx ON a (id);"},
+		{name: "directive inside a comment line", sql: "-- see -- +migrate NoTransaction\nSELECT 1;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseScript(tt.sql).NoTransaction; got != tt.want {
+				t.Fatalf("NoTransaction = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+	for i, m := range migrations {
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			t.Fatalf("migration %s is out of order", m.File)
+		}
+		if len(m.Up.Statements()) == 0 {
+			t.Errorf("migration %s has no statements", m.File)
+		}
+	}
+}
@@ -1,198 +1,567 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io"
+	"log"
+	"math"
 	"sort"
 	"strings"
+	"time"
 )
 
-// RunMigrations applies all SQL migration files in the migrations directory
-func RunMigrations() error {
-	// Ensure DB is connected
-	if DB == nil {
-		return fmt.Errorf("database connection not established")
+// migrationLockID is the key of the advisory lock held while migrating, so
+// replicas starting together take turns instead of racing
+const migrationLockID int64 = 0x7a62_6d69_6772 // "zbmigr"
+
+// ErrChecksumMismatch is returned when an applied migration's file has been
+// edited since it was applied
+var ErrChecksumMismatch = errors.New("migration was edited after it was applied")
+
+// AppliedMigration is a row of the schema_migrations table
+type AppliedMigration struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// MigrationState describes a migration in Status
+type MigrationState string
+
+const (
+	StatePending MigrationState = "pending"
+	StateApplied MigrationState = "applied"
+	// StateEdited is an applied migration whose file has changed since
+	StateEdited MigrationState = "edited"
+	// StateMissing is an applied migration with no file in this build
+	StateMissing MigrationState = "missing"
+)
+
+// MigrationStatus is a migration and whether it has been applied
+type MigrationStatus struct {
+	Version int64
+	Name    string
+	State   MigrationState
+	// AppliedAt is zero for pending migrations
+	AppliedAt time.Time
+}
+
+// Migrator applies and rolls back migrations. Every run holds the migration
+// lock and first checks that applied migrations are unchanged.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+
+	// DryRun, when set, receives the SQL of every script that would run,
+	// which is then neither run nor recorded
+	DryRun io.Writer
+}
+
+// NewMigrator returns a migrator for the given migrations, in version order
+func NewMigrator(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Migrator returns a migrator for the embedded migrations
+func (s *Store) Migrator() (*Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %v", err)
 	}
+	return NewMigrator(s.DB, migrations), nil
+}
 
-	// Create migrations table if it doesn't exist
-	_, err := DB.Exec(`
-		CREATE TABLE IF NOT EXISTS migrations (
-			id SERIAL PRIMARY KEY,
-			migration_name VARCHAR(255) UNIQUE NOT NULL,
-			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
+// RunMigrations applies every pending embedded migration
+func (s *Store) RunMigrations(ctx context.Context) error {
+	m, err := s.Migrator()
 	if err != nil {
-		return fmt.Errorf("failed to create migrations table: %v", err)
+		return err
 	}
+	_, err = m.Up(ctx)
+	return err
+}
 
-	// Get list of applied migrations
-	rows, err := DB.Query("SELECT migration_name FROM migrations")
+// RollbackMigration rolls back the most recently applied migration
+func (s *Store) RollbackMigration(ctx context.Context) error {
+	m, err := s.Migrator()
 	if err != nil {
-		return fmt.Errorf("failed to query migrations: %v", err)
+		return err
 	}
-	defer rows.Close()
+	_, err = m.Down(ctx, 1)
+	return err
+}
 
-	appliedMigrations := make(map[string]bool)
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			return fmt.Errorf("failed to scan migration row: %v", err)
+// Up applies every pending migration in version order and returns how many
+// were applied. Applied migrations missing from this build are left alone,
+// as a newer build may have applied them during a rolling deploy.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]AppliedMigration) error {
+		for _, row := range m.unknown(applied) {
+			log.Printf("Applied migration %d (%s) is not in this build, leaving it alone", row.Version, row.Name)
+		}
+		pending, err := m.pending(applied, math.MaxInt64)
+		if err != nil {
+			return err
 		}
-		appliedMigrations[name] = true
+		for _, migration := range pending {
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down rolls back the latest steps applied migrations, newest first, and
+// returns how many were rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	count := 0
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]AppliedMigration) error {
+		if err := m.requireKnown(applied); err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// To applies or rolls back migrations until exactly those up to version are
+// applied, and returns how many it ran. Version 0 rolls back everything.
+func (m *Migrator) To(ctx context.Context, version int64) (int, error) {
+	if version != 0 && !m.has(version) {
+		return 0, fmt.Errorf("there is no migration with version %d", version)
 	}
 
-	// Get migration files - try both relative and absolute paths
-	migrationsDir := getMigrationsPath()
-	fmt.Printf("Looking for migrations in: %s\n", migrationsDir)
+	count := 0
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]AppliedMigration) error {
+		if err := m.requireKnown(applied); err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && m.migrations[i].Version > version; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			count++
+		}
+
+		pending, err := m.pending(applied, version)
+		if err != nil {
+			return err
+		}
+		for _, migration := range pending {
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Redo rolls back the latest applied migration and applies it again, and
+// returns it
+func (m *Migrator) Redo(ctx context.Context) (Migration, error) {
+	var redone Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]AppliedMigration) error {
+		if err := m.requireKnown(applied); err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+			redone = migration
+			return nil
+		}
+		return errors.New("no migration has been applied")
+	})
+	return redone, err
+}
 
-	files, err := os.ReadDir(migrationsDir)
+// Status returns every migration in version order with its state, including
+// applied migrations that are missing from this build. It changes nothing and
+// does not wait for the migration lock.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.appliedMigrations(ctx, m.db)
 	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %v", err)
+		return nil, err
 	}
 
-	// Filter and sort migration files
-	var migrations []string
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".sql") &&
-			!strings.Contains(file.Name(), "rollback") {
-			migrations = append(migrations, file.Name())
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name, State: StatePending}
+		if row, ok := applied[migration.Version]; ok {
+			status.AppliedAt = row.AppliedAt
+			status.State = StateApplied
+			if row.Checksum != migration.Checksum {
+				status.State = StateEdited
+			}
+			delete(applied, migration.Version)
 		}
+		statuses = append(statuses, status)
 	}
-	sort.Strings(migrations)
+	for _, row := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Version: row.Version, Name: row.Name, AppliedAt: row.AppliedAt, State: StateMissing,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
 
-	// Apply migrations
-	for _, migration := range migrations {
-		if appliedMigrations[migration] {
-			fmt.Printf("Migration %s already applied\n", migration)
-			continue
+// has reports whether a migration has the given version
+func (m *Migrator) has(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
 		}
+	}
+	return false
+}
 
-		fmt.Printf("Applying migration: %s\n", migration)
-
-		// Read migration file
-		migrationPath := filepath.Join(migrationsDir, migration)
-		content, err := os.ReadFile(migrationPath)
-		if err != nil {
-			return fmt.Errorf("failed to read migration file %s: %v", migration, err)
+// pending returns the unapplied migrations up to version in version order.
+// Migrations are applied in order, so one older than an applied migration
+// is an error rather than pending.
+func (m *Migrator) pending(applied map[int64]AppliedMigration, version int64) ([]Migration, error) {
+	var latest int64
+	for v := range applied {
+		if v <= version {
+			latest = max(latest, v)
 		}
+	}
 
-		// Begin transaction
-		tx, err := DB.Begin()
-		if err != nil {
-			return fmt.Errorf("failed to begin transaction: %v", err)
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if migration.Version < latest {
+			return nil, fmt.Errorf("migration %s is older than the latest applied migration %d, renumber it", migration.File, latest)
 		}
+		pending = append(pending, migration)
+	}
+	return pending, nil
+}
 
-		// Execute migration
-		_, err = tx.Exec(string(content))
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to execute migration %s: %v", migration, err)
+// locked runs fn on a connection holding the migration lock, with the applied
+// migrations once those in this build have been checked against their files
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, applied map[int64]AppliedMigration) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a database connection: %v", err)
+	}
+	defer conn.Close()
+
+	// Advisory locks belong to the session, so everything below must run on conn
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %v", err)
+	}
+	defer func() {
+		// ctx may be done by now, and the lock must be released regardless
+		if _, unlockErr := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); unlockErr != nil {
+			log.Printf("Error releasing the migration lock: %v", unlockErr)
+			// Close the connection instead of returning it to the pool, which
+			// ends the session and releases the lock with it
+			conn.Raw(func(any) error { return driver.ErrBadConn })
 		}
+	}()
 
-		// Record migration
-		_, err = tx.Exec("INSERT INTO migrations (migration_name) VALUES ($1)", migration)
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to record migration %s: %v", migration, err)
+	if m.DryRun == nil {
+		if err := m.ensureMigrationsTable(ctx, conn); err != nil {
+			return err
 		}
+	}
+	applied, err := m.appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if err := m.verify(applied); err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
 
-		// Commit transaction
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to commit transaction: %v", err)
+// verify checks that the applied migrations this build has are unchanged
+func (m *Migrator) verify(applied map[int64]AppliedMigration) error {
+	for _, migration := range m.migrations {
+		row, ok := applied[migration.Version]
+		if ok && migration.Checksum != row.Checksum {
+			return fmt.Errorf("%s: %w, restore it and add a new migration instead", migration.File, ErrChecksumMismatch)
 		}
+	}
+	return nil
+}
 
-		fmt.Printf("Successfully applied migration: %s\n", migration)
+// unknown returns the applied migrations missing from this build, in version order
+func (m *Migrator) unknown(applied map[int64]AppliedMigration) []AppliedMigration {
+	var missing []AppliedMigration
+	for version, row := range applied {
+		if !m.has(version) {
+			missing = append(missing, row)
+		}
 	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Version < missing[j].Version })
+	return missing
+}
 
+// requireKnown fails when an applied migration is missing from this build.
+// Rolling back needs every file, even to reach a migration older than the
+// missing one, whose later changes could not be undone otherwise.
+func (m *Migrator) requireKnown(applied map[int64]AppliedMigration) error {
+	if missing := m.unknown(applied); len(missing) > 0 {
+		return fmt.Errorf("applied migration %d (%s) is missing from this build", missing[0].Version, missing[0].Name)
+	}
 	return nil
 }
 
-// RollbackMigration rolls back the most recent migration
-func RollbackMigration() error {
-	// Ensure DB is connected
-	if DB == nil {
-		return fmt.Errorf("database connection not established")
+// apply runs a migration's up script and records it
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	if m.DryRun != nil {
+		fmt.Fprintf(m.DryRun, "-- Apply %s\n%s\n\n", migration.File, strings.TrimSpace(migration.Up.SQL))
+		return nil
+	}
+	log.Printf("Applying migration %s", migration.File)
+	err := runScript(ctx, conn, migration.Up, func(db execer) error {
+		_, err := db.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+			migration.Version, migration.Name, migration.Checksum,
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply migration %s: %v", migration.File, err)
 	}
+	return nil
+}
 
-	// Get the most recent migration
-	var migrationName string
-	err := DB.QueryRow(`
-		SELECT migration_name FROM migrations 
-		ORDER BY applied_at DESC LIMIT 1
-	`).Scan(&migrationName)
+// revert runs a migration's rollback script and forgets it was applied
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	if migration.Down == nil {
+		return fmt.Errorf("migration %s has no rollback file", migration.File)
+	}
+	if m.DryRun != nil {
+		fmt.Fprintf(m.DryRun, "-- Roll back %s\n%s\n\n", migration.File, strings.TrimSpace(migration.Down.SQL))
+		return nil
+	}
+	log.Printf("Rolling back migration %s", migration.File)
+	err := runScript(ctx, conn, *migration.Down, func(db execer) error {
+		_, err := db.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get latest migration: %v", err)
+		return fmt.Errorf("failed to roll back migration %s: %v", migration.File, err)
 	}
+	return nil
+}
 
-	// Find corresponding rollback file
-	rollbackName := strings.TrimSuffix(migrationName, ".sql") + "_rollback.sql"
-	rollbackPath := filepath.Join(getMigrationsPath(), rollbackName)
+// execer is satisfied by *sql.Conn and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
 
-	// Check if rollback file exists
-	if _, err := os.Stat(rollbackPath); os.IsNotExist(err) {
-		return fmt.Errorf("rollback file %s does not exist", rollbackName)
+// runScript runs script and then record, together in a transaction unless
+// the script opts out. Without one, the statements run one by one and a
+// failure leaves those before it applied.
+func runScript(ctx context.Context, conn *sql.Conn, script Script, record func(execer) error) error {
+	if script.NoTransaction {
+		for _, stmt := range script.Statements() {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return record(conn)
 	}
 
-	// Read rollback file
-	content, err := os.ReadFile(rollbackPath)
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to read rollback file %s: %v", rollbackName, err)
+		return err
 	}
+	defer tx.Rollback()
 
-	// Begin transaction
-	tx, err := DB.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+	if _, err := tx.ExecContext(ctx, script.SQL); err != nil {
+		return err
 	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
-	// Execute rollback
-	_, err = tx.Exec(string(content))
+// ensureMigrationsTable creates schema_migrations. A database migrated before
+// it existed has its history moved over from the old migrations table, which
+// recorded only file names, taking the current files' checksums as applied.
+func (m *Migrator) ensureMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to execute rollback %s: %v", rollbackName, err)
+		return err
 	}
+	defer tx.Rollback()
 
-	// Remove migration record
-	_, err = tx.Exec("DELETE FROM migrations WHERE migration_name = $1", migrationName)
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up schema_migrations: %v", err)
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		CREATE TABLE schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to remove migration record %s: %v", migrationName, err)
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
 	}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+	var legacy bool
+	if err := tx.QueryRowContext(ctx, "SELECT to_regclass('migrations') IS NOT NULL").Scan(&legacy); err != nil {
+		return fmt.Errorf("failed to look up the migrations table: %v", err)
+	}
+	if legacy {
+		if err := m.adoptLegacyMigrations(ctx, tx); err != nil {
+			return err
+		}
 	}
+	return tx.Commit()
+}
 
-	fmt.Printf("Successfully rolled back migration: %s\n", migrationName)
+// adoptLegacyMigrations copies the old migrations table into schema_migrations
+// and drops it
+func (m *Migrator) adoptLegacyMigrations(ctx context.Context, tx *sql.Tx) error {
+	adopted, err := m.legacyMigrations(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, row := range adopted {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)",
+			row.Version, row.Name, row.Checksum, row.AppliedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record migration %d: %v", row.Version, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DROP TABLE migrations"); err != nil {
+		return fmt.Errorf("failed to drop the migrations table: %v", err)
+	}
+	log.Printf("Moved %d applied migrations to schema_migrations", len(adopted))
 	return nil
 }
 
-// getMigrationsPath returns the path to the migrations directory
-// It tries multiple possible locations to handle different environments
-func getMigrationsPath() string {
-	// Check if MIGRATIONS_PATH environment variable is set
-	if path := os.Getenv("MIGRATIONS_PATH"); path != "" {
-		return path
+// queryer is satisfied by *sql.DB, *sql.Conn and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// legacyMigrations reads the old migrations table as schema_migrations rows,
+// with the checksums of the current files
+func (m *Migrator) legacyMigrations(ctx context.Context, q queryer) ([]AppliedMigration, error) {
+	byFile := make(map[string]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		byFile[migration.File] = migration
 	}
 
-	// Try different possible locations
-	possiblePaths := []string{
-		"database/migrations",       // When running from project root
-		"./database/migrations",     // When running from project root with explicit ./
-		"../database/migrations",    // When running from a subdirectory
-		"../../database/migrations", // When running from a nested subdirectory
-		"/app/database/migrations",  // When running in Docker container
+	rows, err := q.QueryContext(ctx, "SELECT migration_name, applied_at FROM migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query migrations: %v", err)
 	}
+	defer rows.Close()
 
-	for _, path := range possiblePaths {
-		if _, err := os.Stat(path); err == nil {
-			return path
+	var legacy []AppliedMigration
+	for rows.Next() {
+		var file string
+		var appliedAt time.Time
+		if err := rows.Scan(&file, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration row: %v", err)
+		}
+		migration, ok := byFile[file]
+		if !ok {
+			return nil, fmt.Errorf("applied migration %s is missing from this build", file)
 		}
+		legacy = append(legacy, AppliedMigration{
+			Version: migration.Version, Name: migration.Name, Checksum: migration.Checksum, AppliedAt: appliedAt,
+		})
 	}
+	return legacy, rows.Err()
+}
 
-	// Default to the most likely path
-	return "database/migrations"
+// appliedMigrations returns the applied migrations by version. Before
+// schema_migrations is created, they are read from the old migrations table
+// if there is one.
+func (m *Migrator) appliedMigrations(ctx context.Context, q queryer) (map[int64]AppliedMigration, error) {
+	var current, legacy bool
+	err := q.QueryRowContext(ctx,
+		"SELECT to_regclass('schema_migrations') IS NOT NULL, to_regclass('migrations') IS NOT NULL",
+	).Scan(&current, &legacy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up schema_migrations: %v", err)
+	}
+
+	applied := map[int64]AppliedMigration{}
+	if !current {
+		if !legacy {
+			return applied, nil
+		}
+		rows, err := m.legacyMigrations(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			applied[row.Version] = row
+		}
+		return applied, nil
+	}
+
+	rows, err := q.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row AppliedMigration
+		if err := rows.Scan(&row.Version, &row.Name, &row.Checksum, &row.AppliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration row: %v", err)
+		}
+		applied[row.Version] = row
+	}
+	return applied, rows.Err()
 }
@@ -0,0 +1,11 @@
+-- Anchor day of month for monthly income sources
+
+-- next_pay_date alone cannot tell a source paid on the 31st from one paid on
+-- the 28th once it has been clamped to the end of February, so monthly
+-- sources remember the day they are actually paid on.
+ALTER TABLE income_sources
+    ADD COLUMN pay_day SMALLINT CHECK (pay_day BETWEEN 1 AND 31);
+
+UPDATE income_sources
+SET pay_day = EXTRACT(DAY FROM next_pay_date)
+WHERE frequency = 'monthly';
@@ -0,0 +1,3 @@
+-- Anchor day of month for monthly income sources rollback
+
+ALTER TABLE income_sources DROP COLUMN IF EXISTS pay_day;
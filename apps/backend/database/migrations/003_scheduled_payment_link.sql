@@ -0,0 +1,6 @@
+-- Link completed scheduled payments to the payment that settled them
+
+ALTER TABLE scheduled_payments
+    ADD COLUMN payment_id INT REFERENCES payments(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_scheduled_payments_payment_id ON scheduled_payments(payment_id);
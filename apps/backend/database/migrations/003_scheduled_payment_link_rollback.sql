@@ -0,0 +1,4 @@
+-- Link completed scheduled payments to the payment that settled them rollback
+
+DROP INDEX IF EXISTS idx_scheduled_payments_payment_id;
+ALTER TABLE scheduled_payments DROP COLUMN IF EXISTS payment_id;
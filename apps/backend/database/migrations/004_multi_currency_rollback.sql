@@ -0,0 +1,12 @@
+-- Multi-currency support rollback
+
+DROP TABLE IF EXISTS exchange_rates;
+
+ALTER TABLE scheduled_payments DROP COLUMN IF EXISTS currency;
+ALTER TABLE payments DROP COLUMN IF EXISTS currency;
+ALTER TABLE debts DROP COLUMN IF EXISTS currency;
+ALTER TABLE income_sources DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS is_admin,
+    DROP COLUMN IF EXISTS base_currency;
@@ -0,0 +1,6 @@
+-- Revoke existing tokens when a password changes
+
+-- Every JWT carries the token_version it was issued at, bumping it invalidates them all
+ALTER TABLE users
+    ADD COLUMN token_version INT NOT NULL DEFAULT 0,
+    ADD COLUMN password_changed_at TIMESTAMP;
@@ -0,0 +1,5 @@
+-- Revoke existing tokens when a password changes rollback
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS password_changed_at,
+    DROP COLUMN IF EXISTS token_version;
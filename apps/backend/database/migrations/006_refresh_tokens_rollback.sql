@@ -0,0 +1,3 @@
+-- Rotating refresh tokens rollback
+
+DROP TABLE IF EXISTS refresh_tokens;
@@ -0,0 +1,3 @@
+-- Password reset tokens rollback
+
+DROP TABLE IF EXISTS password_reset_tokens;
@@ -0,0 +1,9 @@
+-- Failed login tracking for brute-force protection
+
+-- Keys are prefixed by kind, e.g. "login:email:..." or "login:ip:..."
+CREATE TABLE login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ
+);
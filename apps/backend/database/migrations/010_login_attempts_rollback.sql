@@ -0,0 +1,3 @@
+-- Failed login tracking rollback
+
+DROP TABLE IF EXISTS login_attempts;
@@ -0,0 +1,11 @@
+-- Token buckets for API rate limiting
+
+-- Keys are the route group and the client, e.g. "profile:user:42" or "auth:ip:203.0.113.7"
+CREATE TABLE rate_limit_buckets (
+    key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    allowed BOOLEAN NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_rate_limit_buckets_updated_at ON rate_limit_buckets(updated_at);
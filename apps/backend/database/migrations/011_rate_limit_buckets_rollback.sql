@@ -0,0 +1,3 @@
+-- Token buckets for API rate limiting rollback
+
+DROP TABLE IF EXISTS rate_limit_buckets;
@@ -0,0 +1,3 @@
+-- Login sessions rollback
+
+DROP TABLE IF EXISTS sessions;
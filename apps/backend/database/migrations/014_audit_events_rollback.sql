@@ -0,0 +1,3 @@
+-- Audit log rollback
+
+DROP TABLE IF EXISTS audit_events;
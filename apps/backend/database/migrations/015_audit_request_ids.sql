@@ -0,0 +1,29 @@
+-- Audit log request IDs and append-only enforcement
+
+-- request_id ties an event to the X-Request-ID of the request that made it
+ALTER TABLE audit_events ADD COLUMN request_id VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_audit_events_entity ON audit_events(user_id, entity_type, entity_id, id);
+
+-- Events are never edited or removed by statements. Foreign key actions run
+-- as nested triggers, so deleting a user still cascades to their events and
+-- clears actor_id on the events they made for others.
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF pg_trigger_depth() = 1 THEN
+        RAISE EXCEPTION 'audit_events is append-only';
+    END IF;
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
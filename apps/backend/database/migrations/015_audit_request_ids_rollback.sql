@@ -0,0 +1,8 @@
+-- Audit log request IDs and append-only enforcement rollback
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only();
+
+DROP INDEX IF EXISTS idx_audit_events_entity;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS request_id;
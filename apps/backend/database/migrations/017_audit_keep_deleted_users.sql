@@ -0,0 +1,15 @@
+-- Keep the audit trail of deleted accounts
+
+-- actor_id and user_id become plain snapshots of the user IDs instead of
+-- foreign keys, so deleting an account neither removes its events nor
+-- rewrites them. User IDs are never reused.
+ALTER TABLE audit_events DROP CONSTRAINT IF EXISTS audit_events_user_id_fkey;
+ALTER TABLE audit_events DROP CONSTRAINT IF EXISTS audit_events_actor_id_fkey;
+
+-- Without foreign key actions to let through, events are never edited or
+-- removed at all
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,369 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeDB stands in for Postgres under the migrator: it keeps schema_migrations
+// in memory and records every other statement in the order it ran
+type fakeDB struct {
+	mu      sync.Mutex
+	created bool
+	rows    map[int64]AppliedMigration
+	ran     []string
+}
+
+var (
+	fakeDBsMu sync.Mutex
+	fakeDBs   = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("fakemigrations", fakeDriver{})
+}
+
+// openFakeDB returns a database backed by a new fakeDB
+func openFakeDB(t *testing.T) (*sql.DB, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{rows: map[int64]AppliedMigration{}}
+	fakeDBsMu.Lock()
+	fakeDBs[t.Name()] = fake
+	fakeDBsMu.Unlock()
+
+	db, err := sql.Open("fakemigrations", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, fake
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	fake, ok := fakeDBs[name]
+	if !ok {
+		return nil, fmt.Errorf("no fake database %q", name)
+	}
+	return &fakeConn{db: fake}, nil
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake database does not prepare statements")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	query = strings.TrimSpace(query)
+	switch {
+	case strings.HasPrefix(query, "SELECT pg_advisory_"):
+	case strings.HasPrefix(query, "CREATE TABLE schema_migrations"):
+		db.created = true
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+		version := args[0].Value.(int64)
+		db.rows[version] = AppliedMigration{
+			Version: version, Name: args[1].Value.(string), Checksum: args[2].Value.(string), AppliedAt: time.Now(),
+		}
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations"):
+		delete(db.rows, args[0].Value.(int64))
+	default:
+		db.ran = append(db.ran, query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch {
+	case query == "SELECT to_regclass('schema_migrations') IS NOT NULL":
+		return &fakeRows{columns: []string{"exists"}, values: [][]driver.Value{{db.created}}}, nil
+	case query == "SELECT to_regclass('schema_migrations') IS NOT NULL, to_regclass('migrations') IS NOT NULL":
+		return &fakeRows{columns: []string{"current", "legacy"}, values: [][]driver.Value{{db.created, false}}}, nil
+	case strings.HasPrefix(query, "SELECT to_regclass('migrations')"):
+		return &fakeRows{columns: []string{"exists"}, values: [][]driver.Value{{false}}}, nil
+	case strings.HasPrefix(query, "SELECT version, name, checksum, applied_at FROM schema_migrations"):
+		rows := &fakeRows{columns: []string{"version", "name", "checksum", "applied_at"}}
+		for _, row := range db.rows {
+			rows.values = append(rows.values, []driver.Value{row.Version, row.Name, row.Checksum, row.AppliedAt})
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("fake database cannot run %q", query)
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// testMigrations has three migrations, each creating a table its rollback drops
+func testMigrations(t *testing.T) []Migration {
+	t.Helper()
+	fsys := fstest.MapFS{}
+	for _, name := range []string{"001_a", "002_b", "003_c"} {
+		table := name[len("001_"):]
+		fsys[name+".sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE " + table + " (id INT);")}
+		fsys[name+"_rollback.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE " + table + ";")}
+	}
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	return migrations
+}
+
+// versions returns the applied versions in order
+func (db *fakeDB) versions() []int64 {
+	var versions []int64
+	for version := range db.rows {
+		versions = append(versions, version)
+	}
+	slices.Sort(versions)
+	return versions
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	ctx := context.Background()
+	db, fake := openFakeDB(t)
+	m := NewMigrator(db, testMigrations(t))
+
+	if n, err := m.Up(ctx); err != nil || n != 3 {
+		t.Fatalf("Up = %d, %v, want 3", n, err)
+	}
+	if n, err := m.Up(ctx); err != nil || n != 0 {
+		t.Fatalf("second Up = %d, %v, want 0", n, err)
+	}
+	if n, err := m.Down(ctx, 2); err != nil || n != 2 {
+		t.Fatalf("Down(2) = %d, %v, want 2", n, err)
+	}
+	if got := fake.versions(); !slices.Equal(got, []int64{1}) {
+		t.Fatalf("applied versions %v, want [1]", got)
+	}
+
+	want := []string{
+		"CREATE TABLE a (id INT);", "CREATE TABLE b (id INT);", "CREATE TABLE c (id INT);",
+		"DROP TABLE c;", "DROP TABLE b;",
+	}
+	if !slices.Equal(fake.ran, want) {
+		t.Fatalf("ran %q, want %q", fake.ran, want)
+	}
+}
+
+func TestMigratorRefusesOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	db, fake := openFakeDB(t)
+	migrations := testMigrations(t)
+
+	// 002 was added after 003 had been applied
+	if _, err := NewMigrator(db, []Migration{migrations[0], migrations[2]}).Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if _, err := NewMigrator(db, migrations).Up(ctx); err == nil {
+		t.Fatal("Up applied a migration older than the latest applied one")
+	}
+	if got := fake.versions(); !slices.Equal(got, []int64{1, 3}) {
+		t.Fatalf("applied versions %v, want [1 3]", got)
+	}
+}
+
+func TestMigratorRefusesEditedMigration(t *testing.T) {
+	ctx := context.Background()
+	db, fake := openFakeDB(t)
+	migrations := testMigrations(t)
+	if _, err := NewMigrator(db, migrations[:1]).Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	migrations[0].Checksum = strings.Repeat("0", 64)
+	if _, err := NewMigrator(db, migrations).Up(ctx); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Up error = %v, want ErrChecksumMismatch", err)
+	}
+	if got := fake.versions(); !slices.Equal(got, []int64{1}) {
+		t.Fatalf("applied versions %v, want [1]", got)
+	}
+}
+
+func TestMigratorTo(t *testing.T) {
+	ctx := context.Background()
+	db, fake := openFakeDB(t)
+	m := NewMigrator(db, testMigrations(t))
+
+	steps := []struct {
+		version int64
+		want    int
+		applied []int64
+	}{
+		{version: 2, want: 2, applied: []int64{1, 2}},
+		{version: 2, want: 0, applied: []int64{1, 2}},
+		{version: 3, want: 1, applied: []int64{1, 2, 3}},
+		{version: 1, want: 2, applied: []int64{1}},
+		{version: 0, want: 1},
+	}
+	for _, step := range steps {
+		if n, err := m.To(ctx, step.version); err != nil || n != step.want {
+			t.Fatalf("To(%d) = %d, %v, want %d", step.version, n, err, step.want)
+		}
+		if got := fake.versions(); !slices.Equal(got, step.applied) {
+			t.Fatalf("after To(%d) applied versions %v, want %v", step.version, got, step.applied)
+		}
+	}
+	if _, err := m.To(ctx, 4); err == nil {
+		t.Fatal("To an unknown version succeeded")
+	}
+
+	want := []string{
+		"CREATE TABLE a (id INT);", "CREATE TABLE b (id INT);", "CREATE TABLE c (id INT);",
+		"DROP TABLE c;", "DROP TABLE b;", "DROP TABLE a;",
+	}
+	if !slices.Equal(fake.ran, want) {
+		t.Fatalf("ran %q, want %q", fake.ran, want)
+	}
+}
+
+func TestMigratorRedo(t *testing.T) {
+	ctx := context.Background()
+	db, fake := openFakeDB(t)
+	m := NewMigrator(db, testMigrations(t))
+
+	if _, err := m.Redo(ctx); err == nil {
+		t.Fatal("Redo with nothing applied succeeded")
+	}
+	if _, err := m.To(ctx, 2); err != nil {
+		t.Fatalf("To: %v", err)
+	}
+	fake.ran = nil
+
+	redone, err := m.Redo(ctx)
+	if err != nil || redone.Version != 2 {
+		t.Fatalf("Redo = %d, %v, want 2", redone.Version, err)
+	}
+	if want := []string{"DROP TABLE b;", "CREATE TABLE b (id INT);"}; !slices.Equal(fake.ran, want) {
+		t.Fatalf("ran %q, want %q", fake.ran, want)
+	}
+	if got := fake.versions(); !slices.Equal(got, []int64{1, 2}) {
+		t.Fatalf("applied versions %v, want [1 2]", got)
+	}
+}
+
+func TestMigratorStatus(t *testing.T) {
+	ctx := context.Background()
+	db, fake := openFakeDB(t)
+	migrations := testMigrations(t)
+	if _, err := NewMigrator(db, migrations[:2]).Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	fake.rows[9] = AppliedMigration{Version: 9, Name: "gone", Checksum: strings.Repeat("0", 64)}
+	migrations[1].Checksum = strings.Repeat("0", 64)
+
+	statuses, err := NewMigrator(db, migrations).Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	want := []MigrationState{StateApplied, StateEdited, StatePending, StateMissing}
+	var got []MigrationState
+	for _, status := range statuses {
+		got = append(got, status.State)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("states %v, want %v", got, want)
+	}
+}
+
+func TestMigratorDryRun(t *testing.T) {
+	ctx := context.Background()
+	db, fake := openFakeDB(t)
+	migrations := testMigrations(t)
+	if _, err := NewMigrator(db, migrations[:1]).Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	fake.ran = nil
+
+	var out strings.Builder
+	m := NewMigrator(db, migrations)
+	m.DryRun = &out
+	if n, err := m.To(ctx, 2); err != nil || n != 1 {
+		t.Fatalf("To = %d, %v, want 1", n, err)
+	}
+	if n, err := m.Down(ctx, 1); err != nil || n != 1 {
+		t.Fatalf("Down = %d, %v, want 1", n, err)
+	}
+
+	want := "-- Apply 002_b.sql\nCREATE TABLE b (id INT);\n\n" +
+		"-- Roll back 001_a.sql\nDROP TABLE a;\n\n"
+	if out.String() != want {
+		t.Fatalf("dry run printed %q, want %q", out.String(), want)
+	}
+	if len(fake.ran) != 0 {
+		t.Fatalf("dry run ran %q", fake.ran)
+	}
+	if got := fake.versions(); !slices.Equal(got, []int64{1}) {
+		t.Fatalf("applied versions %v, want [1]", got)
+	}
+}
+
+func TestMigratorMissingMigration(t *testing.T) {
+	ctx := context.Background()
+	db, fake := openFakeDB(t)
+	migrations := testMigrations(t)
+	if _, err := NewMigrator(db, migrations).Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	// An older build has nothing to apply, but cannot roll back past 003
+	older := NewMigrator(db, migrations[:2])
+	if n, err := older.Up(ctx); err != nil || n != 0 {
+		t.Fatalf("Up = %d, %v, want 0", n, err)
+	}
+	if _, err := older.Down(ctx, 1); err == nil {
+		t.Fatal("Down rolled back with an applied migration missing")
+	}
+	if _, err := older.To(ctx, 1); err == nil {
+		t.Fatal("To rolled back with an applied migration missing")
+	}
+	if _, err := older.Redo(ctx); err == nil {
+		t.Fatal("Redo ran with an applied migration missing")
+	}
+	if got := fake.versions(); !slices.Equal(got, []int64{1, 2, 3}) {
+		t.Fatalf("applied versions %v, want [1 2 3]", got)
+	}
+}
@@ -5,8 +5,10 @@ go 1.23.4
 require github.com/gofiber/fiber/v2 v2.52.6
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/golang-jwt/jwt/v4 v4.5.1
 	golang.org/x/crypto v0.36.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,129 @@
+// Package lockout tracks failed authentication attempts per key, such as an
+// email address or client IP, and locks the key out with exponential backoff.
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Policy controls when a key is locked and for how long
+type Policy struct {
+	// Threshold is the number of failures that triggers the first lock
+	Threshold int
+	// BaseDelay is the first lock's length, doubled for every further failure
+	BaseDelay time.Duration
+	// MaxDelay caps the lock length
+	MaxDelay time.Duration
+	// Window is how long after the last failure the count starts over
+	Window time.Duration
+}
+
+// EmailPolicy applies to a single account, where a handful of typos is normal
+var EmailPolicy = Policy{
+	Threshold: 5,
+	BaseDelay: 30 * time.Second,
+	MaxDelay:  15 * time.Minute,
+	Window:    time.Hour,
+}
+
+// IPPolicy applies to a client IP, which may be shared by many users behind NAT
+var IPPolicy = Policy{
+	Threshold: 20,
+	BaseDelay: 30 * time.Second,
+	MaxDelay:  15 * time.Minute,
+	Window:    time.Hour,
+}
+
+// Delay returns how long a key with the given number of failures is locked
+func (p Policy) Delay(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.Threshold; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// Entry is the recorded state of a key
+type Entry struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists failure counts and locks
+type Store interface {
+	// Get returns the entry for key, or a zero Entry if there is none
+	Get(ctx context.Context, key string) (Entry, error)
+	// AddFailure records a failure at now and returns the new failure count.
+	// The count restarts at 1 when the previous failure is older than window.
+	AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error)
+	// Lock locks key until the given time
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets key
+	Reset(ctx context.Context, key string) error
+}
+
+// NewStore returns the store of the given kind. The default, "postgres",
+// shares lockouts between replicas; "memory" suits a single instance.
+func NewStore(kind string, db *sql.DB) Store {
+	if strings.EqualFold(kind, "memory") {
+		return NewMemoryStore()
+	}
+	return NewPostgresStore(db)
+}
+
+// Limiter applies a policy to the keys under one prefix of a store
+type Limiter struct {
+	store  Store
+	prefix string
+	policy Policy
+	now    func() time.Time
+}
+
+// New returns a limiter for keys under prefix
+func New(store Store, prefix string, policy Policy) *Limiter {
+	return &Limiter{store: store, prefix: prefix, policy: policy, now: time.Now}
+}
+
+// Wait returns how long key remains locked, or zero if an attempt is allowed
+func (l *Limiter) Wait(ctx context.Context, key string) (time.Duration, error) {
+	entry, err := l.store.Get(ctx, l.prefix+key)
+	if err != nil {
+		return 0, err
+	}
+	if wait := entry.LockedUntil.Sub(l.now()); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Fail records a failed attempt and returns how long key is now locked
+func (l *Limiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+	now := l.now()
+	failures, err := l.store.AddFailure(ctx, l.prefix+key, now, l.policy.Window)
+	if err != nil {
+		return 0, err
+	}
+
+	delay := l.policy.Delay(failures)
+	if delay > 0 {
+		if err := l.store.Lock(ctx, l.prefix+key, now.Add(delay)); err != nil {
+			return 0, err
+		}
+	}
+	return delay, nil
+}
+
+// Reset clears key after a successful attempt
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.store.Reset(ctx, l.prefix+key)
+}
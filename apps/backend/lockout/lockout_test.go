@@ -0,0 +1,122 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 1, want: 0},
+		{failures: 4, want: 0},
+		{failures: 5, want: 30 * time.Second},
+		{failures: 6, want: time.Minute},
+		{failures: 7, want: 2 * time.Minute},
+		{failures: 9, want: 8 * time.Minute},
+		{failures: 10, want: 15 * time.Minute},
+		{failures: 100, want: 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := EmailPolicy.Delay(tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// clock is a settable time source for limiters
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func (c *clock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// newTestLimiter returns a limiter for EmailPolicy on a memory store and the
+// clock it reads
+func newTestLimiter() (*Limiter, *clock) {
+	c := &clock{now: time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)}
+	l := New(NewMemoryStore(), "login:email:", EmailPolicy)
+	l.now = c.Now
+	return l, c
+}
+
+// fail records failures for key and returns the lock the last one started
+func fail(t *testing.T, l *Limiter, key string, failures int) time.Duration {
+	t.Helper()
+	var delay time.Duration
+	for i := 0; i < failures; i++ {
+		d, err := l.Fail(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		delay = d
+	}
+	return delay
+}
+
+// wait returns how long key is locked
+func wait(t *testing.T, l *Limiter, key string) time.Duration {
+	t.Helper()
+	d, err := l.Wait(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestLimiterThreshold(t *testing.T) {
+	l, c := newTestLimiter()
+
+	if delay := fail(t, l, "ada@example.com", EmailPolicy.Threshold-1); delay != 0 {
+		t.Fatalf("locked for %v below the threshold", delay)
+	}
+	if d := wait(t, l, "ada@example.com"); d != 0 {
+		t.Fatalf("Wait = %v below the threshold, want 0", d)
+	}
+
+	if delay := fail(t, l, "ada@example.com", 1); delay != EmailPolicy.BaseDelay {
+		t.Fatalf("failure at the threshold locked for %v, want %v", delay, EmailPolicy.BaseDelay)
+	}
+	if d := wait(t, l, "ada@example.com"); d != EmailPolicy.BaseDelay {
+		t.Fatalf("Wait = %v, want %v", d, EmailPolicy.BaseDelay)
+	}
+	if d := wait(t, l, "bob@example.com"); d != 0 {
+		t.Fatalf("another key is locked for %v", d)
+	}
+
+	c.Advance(EmailPolicy.BaseDelay)
+	if d := wait(t, l, "ada@example.com"); d != 0 {
+		t.Fatalf("Wait = %v after the lock ran out, want 0", d)
+	}
+
+	// The next failure doubles the lock
+	if delay := fail(t, l, "ada@example.com", 1); delay != 2*EmailPolicy.BaseDelay {
+		t.Fatalf("failure after the lock locked for %v, want %v", delay, 2*EmailPolicy.BaseDelay)
+	}
+}
+
+func TestLimiterStartsOver(t *testing.T) {
+	tests := []struct {
+		name  string
+		clear func(l *Limiter, c *clock)
+	}{
+		{name: "after a success", clear: func(l *Limiter, c *clock) { l.Reset(context.Background(), "ada@example.com") }},
+		{name: "after the window", clear: func(l *Limiter, c *clock) { c.Advance(EmailPolicy.Window + time.Second) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, c := newTestLimiter()
+			fail(t, l, "ada@example.com", EmailPolicy.Threshold-1)
+			tt.clear(l, c)
+
+			if delay := fail(t, l, "ada@example.com", EmailPolicy.Threshold-1); delay != 0 {
+				t.Fatalf("locked for %v, want the count to start over", delay)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pruneEvery is how many recorded failures pass between sweeps of stale entries
+const pruneEvery = 1000
+
+// MemoryStore keeps entries in process memory. Lockouts are lost on restart
+// and not shared between instances.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	writes  int
+}
+
+type memoryEntry struct {
+	Entry
+	window time.Duration
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}}
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(ctx context.Context, key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		return e.Entry, nil
+	}
+	return Entry{}, nil
+}
+
+// AddFailure implements Store
+func (s *MemoryStore) AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.writes++
+	if s.writes%pruneEvery == 0 {
+		s.prune(now)
+	}
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &memoryEntry{}
+		s.entries[key] = e
+	}
+	if now.Sub(e.LastFailure) > window {
+		e.Failures = 0
+	}
+	e.Failures++
+	e.LastFailure = now
+	e.window = window
+	return e.Failures, nil
+}
+
+// Lock implements Store
+func (s *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		e.LockedUntil = until
+	}
+	return nil
+}
+
+// Reset implements Store
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// prune drops entries whose failures have expired and that are not locked
+func (s *MemoryStore) prune(now time.Time) {
+	for key, e := range s.entries {
+		if now.Sub(e.LastFailure) > e.window && now.After(e.LockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// staleAfter is how long after its last failure an unlocked row is pruned. It
+// must be longer than every policy's Window.
+const staleAfter = 24 * time.Hour
+
+// PostgresStore keeps entries in the login_attempts table so every replica
+// sees the same lockouts
+type PostgresStore struct {
+	db     *sql.DB
+	writes atomic.Int64
+}
+
+// NewPostgresStore returns a store backed by db
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Get implements Store
+func (s *PostgresStore) Get(ctx context.Context, key string) (Entry, error) {
+	var entry Entry
+	var lockedUntil sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		"SELECT failures, last_failure_at, locked_until FROM login_attempts WHERE key = $1",
+		key,
+	).Scan(&entry.Failures, &entry.LastFailure, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return Entry{}, nil
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.LockedUntil = lockedUntil.Time
+	return entry, nil
+}
+
+// AddFailure implements Store. The upsert is a single statement, so
+// concurrent failures on different replicas are all counted.
+func (s *PostgresStore) AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	var failures int
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_attempts.last_failure_at < $2 - make_interval(secs => $3) THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = $2
+		RETURNING failures`,
+		key, now, window.Seconds(),
+	).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+
+	if s.writes.Add(1)%pruneEvery == 0 {
+		s.prune(ctx, now)
+	}
+	return failures, nil
+}
+
+// Lock implements Store
+func (s *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE login_attempts SET locked_until = $2 WHERE key = $1", key, until)
+	return err
+}
+
+// Reset implements Store
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE key = $1", key)
+	return err
+}
+
+// prune deletes rows that no longer affect any decision
+func (s *PostgresStore) prune(ctx context.Context, now time.Time) {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM login_attempts WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < $2)",
+		now.Add(-staleAfter), now,
+	)
+	if err != nil {
+		log.Printf("Error pruning login attempts: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+// Package mailer sends transactional email such as password reset links.
+package mailer
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Config selects how email is delivered
+type Config struct {
+	// SMTPHost enables sending through an SMTP server
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	// From is the sender of every message
+	From string
+	// File receives messages when there is no SMTP server, the log when empty
+	File string
+}
+
+// New returns an SMTP mailer when an SMTP host is configured. Otherwise
+// messages are appended to the configured file, or written to the log when
+// that is unset too, which is what local development and tests use.
+func New(cfg Config) Mailer {
+	if cfg.SMTPHost != "" {
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}
+	}
+	return &FileMailer{Path: cfg.File}
+}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -29,15 +31,39 @@ func AuthMiddleware() fiber.Handler {
 		}
 
 		// Validate the token
-		userID, err := utils.ValidateJWT(tokenParts[1])
+		claims, err := utils.ValidateJWT(c.UserContext(), tokenParts[1])
+		if errors.Is(err, utils.ErrMFAPending) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Two-factor authentication has not been completed",
+			})
+		}
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid or expired token",
 			})
 		}
 
-		// Store the user ID in the context for later use
-		c.Locals("userID", userID)
+		// Reject tokens of sessions that have been logged out, or issued
+		// before the user's last password change
+		active, err := checkSession(c.UserContext(), claims.UserID, claims.SessionID, claims.TokenVersion)
+		if err != nil {
+			log.Printf("Error checking session: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+		if !active {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Session has been logged out",
+			})
+		}
+
+		// Store the caller in the context for later use
+		c.Locals(principalKey, Principal{
+			UserID:    claims.UserID,
+			SessionID: claims.SessionID,
+			Roles:     claims.Roles,
+		})
 
 		// Continue to the next middleware or route handler
 		return c.Next()
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Roles a user can hold, carried in access tokens
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// principalKey is the c.Locals key AuthMiddleware stores the Principal under
+const principalKey = "principal"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID    int
+	SessionID string
+	Roles     []string
+}
+
+// HasRole reports whether the principal was granted role
+func (p Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupPrincipal returns the principal AuthMiddleware stored, if any
+func LookupPrincipal(c *fiber.Ctx) (Principal, bool) {
+	principal, ok := c.Locals(principalKey).(Principal)
+	return principal, ok
+}
+
+// CurrentPrincipal returns the caller of a route behind AuthMiddleware
+func CurrentPrincipal(c *fiber.Ctx) Principal {
+	principal, _ := LookupPrincipal(c)
+	return principal
+}
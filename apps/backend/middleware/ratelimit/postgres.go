@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// staleAfter is how long an untouched bucket is kept. It must be longer than
+// the time any limit takes to refill completely.
+const staleAfter = 24 * time.Hour
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so every
+// replica enforces the same limits
+type PostgresStore struct {
+	db    *sql.DB
+	takes atomic.Int64
+}
+
+// NewPostgresStore returns a store backed by db
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Take implements Store. Refilling and taking happen in a single upsert, so
+// concurrent requests on different replicas never spend the same token.
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	var result Result
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+		VALUES ($1, $2::DOUBLE PRECISION - 1, TRUE, $3)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE
+				WHEN LEAST($2, b.tokens + GREATEST(EXTRACT(EPOCH FROM ($3 - b.updated_at)), 0) * $4) >= 1
+				THEN LEAST($2, b.tokens + GREATEST(EXTRACT(EPOCH FROM ($3 - b.updated_at)), 0) * $4) - 1
+				ELSE LEAST($2, b.tokens + GREATEST(EXTRACT(EPOCH FROM ($3 - b.updated_at)), 0) * $4)
+			END,
+			allowed = LEAST($2, b.tokens + GREATEST(EXTRACT(EPOCH FROM ($3 - b.updated_at)), 0) * $4) >= 1,
+			updated_at = GREATEST(b.updated_at, $3)
+		RETURNING allowed, tokens`,
+		key, float64(limit.Burst), now, limit.rate(),
+	).Scan(&result.Allowed, &result.Tokens)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if s.takes.Add(1)%pruneEvery == 0 {
+		s.prune(ctx, now)
+	}
+	return result, nil
+}
+
+// prune deletes buckets nobody has used for a long time
+func (s *PostgresStore) prune(ctx context.Context, now time.Time) {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM rate_limit_buckets WHERE updated_at < $1", now.Add(-staleAfter))
+	if err != nil {
+		log.Printf("Error pruning rate limit buckets: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+// Package ratelimit provides token bucket rate limiting middleware. Each route
+// group gets its own bucket per client, keyed by user ID when the request is
+// authenticated and by IP otherwise.
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+)
+
+// Limit allows bursts of up to Burst requests, refilled at Burst per Per
+type Limit struct {
+	Burst int
+	Per   time.Duration
+}
+
+// rate returns the refill rate in tokens per second
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Per.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	// Allowed reports whether a token was available
+	Allowed bool
+	// Tokens is what is left in the bucket afterwards
+	Tokens float64
+}
+
+// Store persists token buckets
+type Store interface {
+	// Take refills key's bucket for the time passed since it was last used,
+	// then removes one token if there is one
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// NewStore returns the store of the given kind. The default, "postgres",
+// shares limits between replicas; "memory" suits a single instance and is
+// also used when there is no database.
+func NewStore(kind string, db *sql.DB) Store {
+	if db == nil || strings.EqualFold(kind, "memory") {
+		return NewMemoryStore()
+	}
+	return NewPostgresStore(db)
+}
+
+// New returns middleware limiting the route group name. It must run after
+// AuthMiddleware for requests to be keyed by user.
+func New(store Store, name string, limit Limit) fiber.Handler {
+	policy := fmt.Sprintf("%d;w=%d", limit.Burst, int(limit.Per.Seconds()))
+
+	return func(c *fiber.Ctx) error {
+		result, err := store.Take(c.UserContext(), name+":"+clientKey(c), limit, time.Now())
+		if err != nil {
+			// Fail open, an unavailable store should not take the API down with it
+			log.Printf("Error checking rate limit: %v", err)
+			return c.Next()
+		}
+
+		// Seconds until the bucket is full again
+		missing := float64(limit.Burst) - result.Tokens
+		reset := int(math.Ceil(missing / limit.rate()))
+
+		c.Set("RateLimit-Policy", policy)
+		c.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Set("RateLimit-Remaining", strconv.Itoa(int(math.Floor(result.Tokens))))
+		c.Set("RateLimit-Reset", strconv.Itoa(reset))
+
+		if !result.Allowed {
+			// Seconds until the next token
+			retryAfter := int(math.Ceil((1 - result.Tokens) / limit.rate()))
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":       "Too many requests, please slow down",
+				"retry_after": retryAfter,
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// clientKey identifies the caller by user ID when authenticated, else by IP
+func clientKey(c *fiber.Ctx) string {
+	if principal, ok := middleware.LookupPrincipal(c); ok {
+		return "user:" + strconv.Itoa(principal.UserID)
+	}
+	return "ip:" + c.IP()
+}
+
+// refill returns a bucket's tokens after elapsed time, capped at the burst size
+func refill(tokens float64, elapsed time.Duration, limit Limit) float64 {
+	if elapsed > 0 {
+		tokens += elapsed.Seconds() * limit.rate()
+	}
+	return math.Min(tokens, float64(limit.Burst))
+}
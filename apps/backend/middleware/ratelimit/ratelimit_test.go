@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/utils"
+)
+
+func TestMemoryStoreRefill(t *testing.T) {
+	// One token a second, up to three
+	limit := Limit{Burst: 3, Per: 3 * time.Second}
+	start := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		// after is the time since start of the request
+		after       time.Duration
+		wantAllowed bool
+		wantTokens  float64
+	}{
+		{after: 0, wantAllowed: true, wantTokens: 2},
+		{after: 0, wantAllowed: true, wantTokens: 1},
+		{after: 0, wantAllowed: true, wantTokens: 0},
+		{after: 0, wantAllowed: false, wantTokens: 0},
+		{after: 500 * time.Millisecond, wantAllowed: false, wantTokens: 0.5},
+		{after: time.Second, wantAllowed: true, wantTokens: 0},
+		// A long pause refills the bucket only up to the burst size
+		{after: time.Hour, wantAllowed: true, wantTokens: 2},
+	}
+
+	store := NewMemoryStore()
+	for i, tt := range tests {
+		result, err := store.Take(context.Background(), "key", limit, start.Add(tt.after))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != tt.wantAllowed || result.Tokens != tt.wantTokens {
+			t.Fatalf("request %d at +%v: %+v, want allowed %v with %v tokens left", i+1, tt.after, result, tt.wantAllowed, tt.wantTokens)
+		}
+	}
+}
+
+// newTestApp returns an app limiting every request to limit, which
+// authenticates the requests that carry a token. Every session is live.
+func newTestApp(t *testing.T, limit Limit) *fiber.App {
+	middleware.SetSessionLookup(func(context.Context, string) (bool, int, error) { return true, 0, nil })
+	t.Cleanup(func() { middleware.SetSessionLookup(nil) })
+
+	app := fiber.New()
+	auth := middleware.AuthMiddleware()
+	app.Use(func(c *fiber.Ctx) error {
+		if c.Get(fiber.HeaderAuthorization) == "" {
+			return c.Next()
+		}
+		return auth(c)
+	})
+	app.Use(New(NewMemoryStore(), "test", limit))
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	return app
+}
+
+func TestMiddlewareHeaders(t *testing.T) {
+	// One token every 30 seconds, up to two
+	app := newTestApp(t, Limit{Burst: 2, Per: time.Minute})
+
+	tests := []struct {
+		authenticated bool
+		wantStatus    int
+		wantRemaining string
+		wantReset     string
+		wantRetry     string
+	}{
+		{wantStatus: fiber.StatusOK, wantRemaining: "1", wantReset: "30"},
+		{wantStatus: fiber.StatusOK, wantRemaining: "0", wantReset: "60"},
+		{wantStatus: fiber.StatusTooManyRequests, wantRemaining: "0", wantReset: "60", wantRetry: "30"},
+		// Authenticated requests have a bucket per user
+		{authenticated: true, wantStatus: fiber.StatusOK, wantRemaining: "1", wantReset: "30"},
+	}
+
+	token, err := utils.GenerateJWT(7, 0, "session", []string{middleware.RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range tests {
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		if tt.authenticated {
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := map[string]string{
+			"status":              strconv.Itoa(resp.StatusCode),
+			"RateLimit-Policy":    resp.Header.Get("RateLimit-Policy"),
+			"RateLimit-Limit":     resp.Header.Get("RateLimit-Limit"),
+			"RateLimit-Remaining": resp.Header.Get("RateLimit-Remaining"),
+			"RateLimit-Reset":     resp.Header.Get("RateLimit-Reset"),
+			"Retry-After":         resp.Header.Get(fiber.HeaderRetryAfter),
+		}
+		want := map[string]string{
+			"status":              strconv.Itoa(tt.wantStatus),
+			"RateLimit-Policy":    "2;w=60",
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": tt.wantRemaining,
+			"RateLimit-Reset":     tt.wantReset,
+			"Retry-After":         tt.wantRetry,
+		}
+		for name := range want {
+			if got[name] != want[name] {
+				t.Fatalf("request %d: %s = %q, want %q", i+1, name, got[name], want[name])
+			}
+		}
+	}
+}
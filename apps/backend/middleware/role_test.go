@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		require []string
+		// roles are the caller's, or nil for an unauthenticated request
+		roles      []string
+		wantStatus int
+	}{
+		{name: "unauthenticated", require: []string{RoleAdmin}, wantStatus: fiber.StatusUnauthorized},
+		{name: "missing role", require: []string{RoleAdmin}, roles: []string{RoleUser}, wantStatus: fiber.StatusForbidden},
+		{name: "no roles", require: []string{RoleAdmin}, roles: []string{}, wantStatus: fiber.StatusForbidden},
+		{name: "holding the role", require: []string{RoleAdmin}, roles: []string{RoleUser, RoleAdmin}, wantStatus: fiber.StatusOK},
+		{name: "holding one of the roles", require: []string{RoleAdmin, RoleUser}, roles: []string{RoleUser}, wantStatus: fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				if tt.roles != nil {
+					c.Locals(principalKey, Principal{UserID: 1, SessionID: "session", Roles: tt.roles})
+				}
+				return c.Next()
+			})
+			app.Get("/", RequireRole(tt.require...), func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// sessionCacheTTL is how long a session's state is trusted without asking the
+// database. Revoking a session or changing the password on another instance
+// takes effect within it.
+const sessionCacheTTL = 30 * time.Second
+
+// sessionCacheSize caps the cache, which is emptied when it fills up
+const sessionCacheSize = 10000
+
+// SessionLookup reports whether a session is still active, and the current
+// token version of its user, in a single query. Missing sessions count as
+// inactive.
+type SessionLookup func(ctx context.Context, sessionID string) (active bool, tokenVersion int, err error)
+
+// sessionLookup is consulted by AuthMiddleware for every token
+var sessionLookup SessionLookup
+
+// errNoSessionLookup is returned while no session lookup has been set, as
+// access tokens cannot be trusted without checking their session
+var errNoSessionLookup = errors.New("no session lookup set")
+
+var sessionCache = struct {
+	sync.Mutex
+	entries map[string]sessionCacheEntry
+}{entries: map[string]sessionCacheEntry{}}
+
+type sessionCacheEntry struct {
+	userID       int
+	active       bool
+	tokenVersion int
+	checkedAt    time.Time
+}
+
+// SetSessionLookup makes AuthMiddleware reject access tokens whose session has
+// been revoked or whose token version is no longer the user's. AuthMiddleware
+// fails every request until it is set.
+func SetSessionLookup(lookup SessionLookup) {
+	sessionLookup = lookup
+}
+
+// ForgetSession drops a session from the cache, so revoking it takes effect
+// immediately on this instance
+func ForgetSession(sessionID string) {
+	sessionCache.Lock()
+	defer sessionCache.Unlock()
+	delete(sessionCache.entries, sessionID)
+}
+
+// ForgetUserSessions drops every session of a user from the cache, so logging
+// them out everywhere or changing their password takes effect immediately on
+// this instance. Call it once the change has been committed.
+func ForgetUserSessions(userID int) {
+	sessionCache.Lock()
+	defer sessionCache.Unlock()
+	for sessionID, entry := range sessionCache.entries {
+		if entry.userID == userID {
+			delete(sessionCache.entries, sessionID)
+		}
+	}
+}
+
+// checkSession reports whether a user's session is active and the token
+// version is still theirs, asking the lookup at most once per sessionCacheTTL
+func checkSession(ctx context.Context, userID int, sessionID string, tokenVersion int) (bool, error) {
+	if sessionLookup == nil {
+		return false, errNoSessionLookup
+	}
+
+	now := time.Now()
+	sessionCache.Lock()
+	entry, ok := sessionCache.entries[sessionID]
+	sessionCache.Unlock()
+	if !ok || entry.userID != userID || now.Sub(entry.checkedAt) >= sessionCacheTTL {
+		active, current, err := sessionLookup(ctx, sessionID)
+		if err != nil {
+			return false, err
+		}
+		entry = sessionCacheEntry{userID: userID, active: active, tokenVersion: current, checkedAt: now}
+
+		sessionCache.Lock()
+		if len(sessionCache.entries) >= sessionCacheSize {
+			sessionCache.entries = map[string]sessionCacheEntry{}
+		}
+		sessionCache.entries[sessionID] = entry
+		sessionCache.Unlock()
+	}
+	return entry.active && entry.tokenVersion == tokenVersion, nil
+}
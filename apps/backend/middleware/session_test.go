@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeSessions answers session lookups from a map and counts them
+type fakeSessions struct {
+	active  map[string]bool
+	version int
+	err     error
+	lookups int
+}
+
+func (f *fakeSessions) lookup(_ context.Context, sessionID string) (bool, int, error) {
+	f.lookups++
+	return f.active[sessionID], f.version, f.err
+}
+
+// useSessions makes f the session lookup until the test ends
+func useSessions(t *testing.T, f *fakeSessions) {
+	t.Helper()
+	SetSessionLookup(f.lookup)
+	t.Cleanup(func() {
+		SetSessionLookup(nil)
+		sessionCache.Lock()
+		sessionCache.entries = map[string]sessionCacheEntry{}
+		sessionCache.Unlock()
+	})
+}
+
+func TestCheckSession(t *testing.T) {
+	errLookup := errors.New("lookup failed")
+
+	tests := []struct {
+		name      string
+		sessionID string
+		version   int
+		lookupErr error
+		want      bool
+		wantErr   error
+	}{
+		{name: "active session", sessionID: "a", version: 3, want: true},
+		{name: "revoked session", sessionID: "revoked", version: 3},
+		{name: "missing session", sessionID: "missing", version: 3},
+		{name: "issued before a password change", sessionID: "a", version: 2},
+		{name: "lookup fails", sessionID: "a", version: 3, lookupErr: errLookup, wantErr: errLookup},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useSessions(t, &fakeSessions{active: map[string]bool{"a": true, "revoked": false}, version: 3, err: tt.lookupErr})
+			ok, err := checkSession(context.Background(), 42, tt.sessionID, tt.version)
+			if ok != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("checkSession = %v, %v, want %v, %v", ok, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSessionWithoutLookup(t *testing.T) {
+	ok, err := checkSession(context.Background(), 42, "a", 3)
+	if ok || !errors.Is(err, errNoSessionLookup) {
+		t.Fatalf("checkSession = %v, %v, want false, %v", ok, err, errNoSessionLookup)
+	}
+}
+
+func TestCheckSessionCache(t *testing.T) {
+	ctx := context.Background()
+	sessions := &fakeSessions{active: map[string]bool{"a": true}, version: 3}
+	useSessions(t, sessions)
+
+	for i := 0; i < 3; i++ {
+		if ok, err := checkSession(ctx, 42, "a", 3); !ok || err != nil {
+			t.Fatalf("checkSession = %v, %v, want true", ok, err)
+		}
+	}
+	if sessions.lookups != 1 {
+		t.Fatalf("%d lookups, want 1 while the session is cached", sessions.lookups)
+	}
+
+	// The cache is keyed by session, but a token naming another user is looked up
+	if _, err := checkSession(ctx, 7, "a", 3); err != nil {
+		t.Fatal(err)
+	}
+	if sessions.lookups != 2 {
+		t.Fatalf("%d lookups, want 2 after asking for another user", sessions.lookups)
+	}
+
+	// A password change is seen at once by this instance after forgetting the user
+	sessions.version = 4
+	ForgetUserSessions(7)
+	if ok, _ := checkSession(ctx, 7, "a", 3); ok {
+		t.Fatal("token of the old version accepted after ForgetUserSessions")
+	}
+
+	sessions.active["a"] = false
+	ForgetSession("a")
+	if ok, _ := checkSession(ctx, 7, "a", 4); ok {
+		t.Fatal("revoked session accepted after ForgetSession")
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// QueryTimeout gives each request's user context a deadline, which cancels
+// every query still running for the request once it passes. Handlers that
+// failed because of it respond with 503 instead of 500. A zero timeout
+// disables the deadline.
+func QueryTimeout(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if timeout <= 0 {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+		defer cancel()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		failed := err != nil || c.Response().StatusCode() == fiber.StatusInternalServerError
+		if failed && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "The request took too long, please try again",
+			})
+		}
+		return err
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	// query stands in for a database call, failing once the request's
+	// context is done
+	query := func(c *fiber.Ctx, d time.Duration) error {
+		select {
+		case <-c.UserContext().Done():
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "query canceled"})
+		case <-time.After(d):
+			return c.SendString("ok")
+		}
+	}
+
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		handler    fiber.Handler
+		wantStatus int
+	}{
+		{
+			name:       "fast query",
+			timeout:    time.Second,
+			handler:    func(c *fiber.Ctx) error { return query(c, 0) },
+			wantStatus: fiber.StatusOK,
+		},
+		{
+			name:       "query past the deadline",
+			timeout:    10 * time.Millisecond,
+			handler:    func(c *fiber.Ctx) error { return query(c, time.Second) },
+			wantStatus: fiber.StatusServiceUnavailable,
+		},
+		{
+			name:       "other failure",
+			timeout:    time.Second,
+			handler:    func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusInternalServerError) },
+			wantStatus: fiber.StatusInternalServerError,
+		},
+		{
+			name:    "no timeout",
+			timeout: 0,
+			handler: func(c *fiber.Ctx) error {
+				if _, ok := c.UserContext().Deadline(); ok {
+					return c.SendStatus(fiber.StatusInternalServerError)
+				}
+				return c.SendString("ok")
+			},
+			wantStatus: fiber.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(QueryTimeout(tt.timeout))
+			app.Get("/", tt.handler)
+
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// EmailVerifiedLookup reports whether a user has verified their email
+// address. Missing users count as unverified.
+type EmailVerifiedLookup func(ctx context.Context, userID int) (bool, error)
+
+// VerifiedEmailMiddleware restricts sensitive routes to users who have
+// verified their email address. It must run after AuthMiddleware.
+func VerifiedEmailMiddleware(lookup EmailVerifiedLookup) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := LookupPrincipal(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authentication required",
+			})
+		}
+
+		verified, err := lookup(c.UserContext(), principal.UserID)
+		if err != nil {
+			log.Printf("Error querying email verification: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+		if !verified {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Please verify your email address first",
+			})
+		}
+
+		return c.Next()
+	}
+}
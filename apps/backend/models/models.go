@@ -0,0 +1,130 @@
+// Package models holds the domain types the API serves, mirroring
+// packages/shared-types. JSON field names are snake_case, as the API sends
+// them; monetary amounts are exact decimals.
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/kevinlucasklein/zero-balance/money"
+)
+
+// DateLayout is the format of dates without a time of day, such as due dates
+const DateLayout = "2006-01-02"
+
+// User is an account. Only the profile fields are sent to clients, the
+// account state is kept server side.
+type User struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	BaseCurrency  string `json:"base_currency"`
+	CreatedAt     string `json:"created_at"`
+
+	// PasswordHash is empty for accounts created through a sign-in provider
+	// that have not set a password yet
+	PasswordHash string `json:"-"`
+	Role         string `json:"-"`
+	// TokenVersion is carried by every access token, bumping it revokes them
+	TokenVersion int  `json:"-"`
+	MFAEnabled   bool `json:"-"`
+	// DisabledAt is when an admin disabled the account, nil while it is enabled
+	DisabledAt            *string `json:"-"`
+	PasswordResetRequired bool    `json:"-"`
+}
+
+// Session is a login on one device, as listed to its user
+type Session struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	// Current marks the session of the request listing them
+	Current bool `json:"current"`
+}
+
+// Identity is a sign-in provider account linked to a user
+type Identity struct {
+	ID          int     `json:"id"`
+	UserID      int     `json:"-"`
+	Provider    string  `json:"provider"`
+	Email       string  `json:"email"`
+	CreatedAt   string  `json:"created_at"`
+	LastLoginAt *string `json:"last_login_at"`
+}
+
+// Debt represents a row of the debts table
+type Debt struct {
+	ID             int          `json:"id"`
+	UserID         int          `json:"user_id"`
+	CreditorName   string       `json:"creditor_name"`
+	Amount         money.Amount `json:"amount"`
+	Currency       string       `json:"currency"`
+	InterestRate   money.Rate   `json:"interest_rate"`
+	MinimumPayment money.Amount `json:"minimum_payment"`
+	DueDate        string       `json:"due_date"`
+	Status         string       `json:"status"`
+	CreatedAt      string       `json:"created_at"`
+}
+
+// IncomeSource represents a row of the income_sources table
+type IncomeSource struct {
+	ID          int          `json:"id"`
+	UserID      int          `json:"user_id"`
+	SourceName  string       `json:"source_name"`
+	Amount      money.Amount `json:"amount"`
+	Currency    string       `json:"currency"`
+	Frequency   string       `json:"frequency"`
+	NextPayDate string       `json:"next_pay_date"`
+	PayDay      *int         `json:"pay_day,omitempty"`
+	CreatedAt   string       `json:"created_at"`
+}
+
+// Payment represents a row of the payments table
+type Payment struct {
+	ID          int          `json:"id"`
+	UserID      int          `json:"user_id"`
+	DebtID      int          `json:"debt_id"`
+	Amount      money.Amount `json:"amount"`
+	Currency    string       `json:"currency"`
+	PaymentDate string       `json:"payment_date"`
+	Method      string       `json:"method"`
+}
+
+// ScheduledPayment represents a row of the scheduled_payments table
+type ScheduledPayment struct {
+	ID                int          `json:"id"`
+	UserID            int          `json:"user_id"`
+	DebtID            int          `json:"debt_id"`
+	RecommendedAmount money.Amount `json:"recommended_amount"`
+	Currency          string       `json:"currency"`
+	ScheduledDate     string       `json:"scheduled_date"`
+	Status            string       `json:"status"`
+	PaymentID         *int         `json:"payment_id,omitempty"`
+	CreatedAt         string       `json:"created_at"`
+}
+
+// AuditEvent is an audit log entry as shown to the user it concerns
+type AuditEvent struct {
+	ID int64 `json:"id"`
+	// ActorID is who made the change, null for the system or a deleted user
+	ActorID    *int            `json:"actor_id"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   string          `json:"entity_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	IPAddress  string          `json:"ip_address"`
+	RequestID  string          `json:"request_id"`
+	CreatedAt  string          `json:"created_at"`
+}
+
+// ExchangeRate represents a row of the exchange_rates table
+type ExchangeRate struct {
+	BaseCurrency  string             `json:"base_currency"`
+	QuoteCurrency string             `json:"quote_currency"`
+	Rate          money.ExchangeRate `json:"rate"`
+	UpdatedAt     string             `json:"updated_at"`
+}
@@ -0,0 +1,124 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// DefaultCurrency is used for users and rows created before currencies existed
+const DefaultCurrency = "USD"
+
+// rateScale is the number of decimal places stored for exchange rates,
+// matching the NUMERIC(18,8) column of exchange_rates
+const rateScale = 8
+
+// ErrInvalidRate is returned for an exchange rate that is not a positive decimal
+var ErrInvalidRate = errors.New("exchange rate must be a positive decimal number with at most 8 decimal places")
+
+// iso4217 lists the active ISO 4217 alphabetic currency codes whose minor
+// unit is a hundredth. Amounts and the DECIMAL(10,2) columns always have two
+// decimal places, so currencies with none (e.g. JPY) or three (e.g. KWD) are
+// left out rather than stored with the wrong precision.
+var iso4217 = map[string]bool{
+	"AED": true, "AFN": true, "ALL": true, "AMD": true, "ANG": true, "AOA": true, "ARS": true, "AUD": true,
+	"AWG": true, "AZN": true, "BAM": true, "BBD": true, "BDT": true, "BGN": true, "BMD": true, "BND": true,
+	"BOB": true, "BRL": true, "BSD": true, "BTN": true, "BWP": true, "BYN": true, "BZD": true, "CAD": true,
+	"CDF": true, "CHF": true, "CNY": true, "COP": true, "CRC": true, "CUP": true, "CVE": true, "CZK": true,
+	"DKK": true, "DOP": true, "DZD": true, "EGP": true, "ERN": true, "ETB": true, "EUR": true, "FJD": true,
+	"FKP": true, "GBP": true, "GEL": true, "GHS": true, "GIP": true, "GMD": true, "GTQ": true, "GYD": true,
+	"HKD": true, "HNL": true, "HTG": true, "HUF": true, "IDR": true, "ILS": true, "INR": true, "IRR": true,
+	"JMD": true, "KES": true, "KGS": true, "KHR": true, "KPW": true, "KYD": true, "KZT": true, "LAK": true,
+	"LBP": true, "LKR": true, "LRD": true, "LSL": true, "MAD": true, "MDL": true, "MGA": true, "MKD": true,
+	"MMK": true, "MNT": true, "MOP": true, "MRU": true, "MUR": true, "MVR": true, "MWK": true, "MXN": true,
+	"MYR": true, "MZN": true, "NAD": true, "NGN": true, "NIO": true, "NOK": true, "NPR": true, "NZD": true,
+	"PAB": true, "PEN": true, "PGK": true, "PHP": true, "PKR": true, "PLN": true, "QAR": true, "RON": true,
+	"RSD": true, "RUB": true, "SAR": true, "SBD": true, "SCR": true, "SDG": true, "SEK": true, "SGD": true,
+	"SHP": true, "SLE": true, "SOS": true, "SRD": true, "SSP": true, "STN": true, "SVC": true, "SYP": true,
+	"SZL": true, "THB": true, "TJS": true, "TMT": true, "TOP": true, "TRY": true, "TTD": true, "TWD": true,
+	"TZS": true, "UAH": true, "USD": true, "UYU": true, "UZS": true, "VES": true, "WST": true, "XCD": true,
+	"YER": true, "ZAR": true, "ZMW": true, "ZWL": true,
+}
+
+// NormalizeCurrency upper-cases a currency code and reports whether it is a
+// supported ISO 4217 code
+func NormalizeCurrency(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return code, iso4217[code]
+}
+
+// ExchangeRate is the number of units of a quote currency one unit of a base
+// currency buys, scaled by 10^8. It is encoded in JSON as a decimal string.
+type ExchangeRate int64
+
+// ParseExchangeRate parses a positive decimal string such as "1.0825" into an ExchangeRate
+func ParseExchangeRate(s string) (ExchangeRate, error) {
+	v, err := parseFixed(s, rateScale)
+	if err != nil || v <= 0 {
+		return 0, ErrInvalidRate
+	}
+	return ExchangeRate(v), nil
+}
+
+// String formats the rate with eight decimal places
+func (r ExchangeRate) String() string { return formatFixed(int64(r), rateScale) }
+
+// MarshalJSON encodes the rate as a decimal string
+func (r ExchangeRate) MarshalJSON() ([]byte, error) { return json.Marshal(r.String()) }
+
+// UnmarshalJSON accepts either a decimal string or a bare JSON number
+func (r *ExchangeRate) UnmarshalJSON(data []byte) error {
+	text := strings.TrimSpace(string(data))
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+	v, err := ParseExchangeRate(text)
+	if err != nil {
+		return err
+	}
+	*r = v
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC columns
+func (r *ExchangeRate) Scan(src interface{}) error {
+	v, err := scanFixed(src, rateScale)
+	if err != nil {
+		return err
+	}
+	*r = ExchangeRate(v)
+	return nil
+}
+
+// Value implements driver.Valuer, sending the rate as an exact decimal string
+func (r ExchangeRate) Value() (driver.Value, error) { return r.String(), nil }
+
+// Convert multiplies an amount by an exchange rate, rounding half away from
+// zero to the nearest cent of the quote currency
+func Convert(a Amount, r ExchangeRate) Amount {
+	n := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(int64(r)))
+	return Amount(bigDivRound(n, new(big.Int).Exp(big.NewInt(10), big.NewInt(rateScale), nil)))
+}
+
+// ConvertInverse divides an amount by an exchange rate, converting from the
+// quote currency back into the base currency
+func ConvertInverse(a Amount, r ExchangeRate) Amount {
+	n := new(big.Int).Mul(big.NewInt(int64(a)), new(big.Int).Exp(big.NewInt(10), big.NewInt(rateScale), nil))
+	return Amount(bigDivRound(n, big.NewInt(int64(r))))
+}
+
+// bigDivRound divides n by a positive d, rounding half away from zero
+func bigDivRound(n, d *big.Int) int64 {
+	half := new(big.Int).Quo(d, big.NewInt(2))
+	if n.Sign() < 0 {
+		q := new(big.Int).Neg(n)
+		q.Add(q, half).Quo(q, d)
+		return -q.Int64()
+	}
+	q := new(big.Int).Add(n, half)
+	return q.Quo(q, d).Int64()
+}
@@ -0,0 +1,278 @@
+// Package money provides exact fixed-point types for the DECIMAL columns of
+// the schema, so amounts are never rounded through float64.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is a monetary amount in cents. It maps to DECIMAL(10,2) columns and
+// is encoded in JSON as a decimal string such as "1234.56".
+type Amount int64
+
+// Rate is an annual interest rate in hundredths of a percent, so 19.99% is
+// Rate(1999). It maps to DECIMAL(5,2) columns and is encoded like Amount.
+type Rate int64
+
+// Largest values the schema columns can hold
+const (
+	MaxAmount Amount = 9999999999 // DECIMAL(10,2)
+	MaxRate   Rate   = 99999      // DECIMAL(5,2)
+)
+
+// ErrInvalid is returned when a value is not a decimal with at most two places
+var ErrInvalid = errors.New("must be a decimal number with at most 2 decimal places")
+
+// Parse parses a decimal string such as "12", "-3.5" or "1234.56" into an Amount
+func Parse(s string) (Amount, error) {
+	v, err := parseFixed2(s)
+	return Amount(v), err
+}
+
+// ParseRate parses a percentage string such as "19.99" into a Rate
+func ParseRate(s string) (Rate, error) {
+	v, err := parseFixed2(s)
+	return Rate(v), err
+}
+
+// Cents returns the amount as a whole number of cents
+func (a Amount) Cents() int64 { return int64(a) }
+
+// String formats the amount with exactly two decimal places
+func (a Amount) String() string { return formatFixed2(int64(a)) }
+
+// Float64 returns the amount in currency units for display-only math such as ratios
+func (a Amount) Float64() float64 { return float64(a) / 100 }
+
+// IsNegative reports whether the amount is below zero
+func (a Amount) IsNegative() bool { return a < 0 }
+
+// Min returns the smaller of a and b
+func Min(a, b Amount) Amount {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Sum adds up amounts
+func Sum(amounts ...Amount) Amount {
+	var total Amount
+	for _, a := range amounts {
+		total += a
+	}
+	return total
+}
+
+// MonthlyInterest returns one month of interest on a balance at an annual
+// rate, rounded half away from zero to the nearest cent
+func MonthlyInterest(balance Amount, rate Rate) Amount {
+	// cents * (percent * 100) / (100 percent * 100 * 12 months)
+	return Amount(divRound(int64(balance)*int64(rate), 120000))
+}
+
+// Ratio returns a / b rounded to four decimal places, or 0 when b is zero
+func Ratio(a, b Amount) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(divRound(int64(a)*10000, int64(b))) / 10000
+}
+
+// String formats the rate with exactly two decimal places
+func (r Rate) String() string { return formatFixed2(int64(r)) }
+
+// MarshalJSON encodes the amount as a decimal string
+func (a Amount) MarshalJSON() ([]byte, error) { return json.Marshal(a.String()) }
+
+// UnmarshalJSON accepts either a decimal string or a bare JSON number. The
+// number's literal text is parsed directly, so it never passes through float64.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalFixed2(data)
+	if err != nil {
+		return err
+	}
+	*a = Amount(v)
+	return nil
+}
+
+// UnmarshalText lets form and query decoders parse amounts
+func (a *Amount) UnmarshalText(text []byte) error {
+	v, err := parseFixed2(string(text))
+	if err != nil {
+		return err
+	}
+	*a = Amount(v)
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC columns
+func (a *Amount) Scan(src interface{}) error {
+	v, err := scanFixed2(src)
+	if err != nil {
+		return err
+	}
+	*a = Amount(v)
+	return nil
+}
+
+// Value implements driver.Valuer, sending the amount as an exact decimal string
+func (a Amount) Value() (driver.Value, error) { return a.String(), nil }
+
+// MarshalJSON encodes the rate as a decimal string
+func (r Rate) MarshalJSON() ([]byte, error) { return json.Marshal(r.String()) }
+
+// UnmarshalJSON accepts either a decimal string or a bare JSON number
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalFixed2(data)
+	if err != nil {
+		return err
+	}
+	*r = Rate(v)
+	return nil
+}
+
+// UnmarshalText lets form and query decoders parse rates
+func (r *Rate) UnmarshalText(text []byte) error {
+	v, err := parseFixed2(string(text))
+	if err != nil {
+		return err
+	}
+	*r = Rate(v)
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC columns
+func (r *Rate) Scan(src interface{}) error {
+	v, err := scanFixed2(src)
+	if err != nil {
+		return err
+	}
+	*r = Rate(v)
+	return nil
+}
+
+// Value implements driver.Valuer, sending the rate as an exact decimal string
+func (r Rate) Value() (driver.Value, error) { return r.String(), nil }
+
+// parseFixed2 parses a decimal string into hundredths
+func parseFixed2(s string) (int64, error) {
+	return parseFixed(s, 2)
+}
+
+// parseFixed parses a decimal string into an integer scaled by 10^places.
+// Extra fractional digits are only accepted when they are zeros, as in "1.500".
+func parseFixed(s string, places int) (int64, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, ErrInvalid
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > places {
+		return 0, ErrInvalid
+	}
+	for len(frac) < places {
+		frac += "0"
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if len(whole)+places > 18 || !isDigits(whole) || !isDigits(frac) {
+		return 0, ErrInvalid
+	}
+
+	v, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, ErrInvalid
+	}
+	if negative {
+		v = -v
+	}
+	return v, nil
+}
+
+// formatFixed2 formats hundredths as a decimal string with two places
+func formatFixed2(v int64) string {
+	return formatFixed(v, 2)
+}
+
+// formatFixed formats an integer scaled by 10^places as a decimal string
+func formatFixed(v int64, places int) string {
+	sign := ""
+	u := uint64(v)
+	if v < 0 {
+		sign = "-"
+		u = uint64(-v)
+	}
+	scale := uint64(math.Pow10(places))
+	return fmt.Sprintf("%s%d.%0*d", sign, u/scale, places, u%scale)
+}
+
+// unmarshalFixed2 decodes a JSON string or number into hundredths
+func unmarshalFixed2(data []byte) (int64, error) {
+	text := strings.TrimSpace(string(data))
+	if strings.HasPrefix(text, `"`) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return 0, err
+		}
+		text = s
+	}
+	return parseFixed2(text)
+}
+
+// scanFixed2 converts a database value into hundredths
+func scanFixed2(src interface{}) (int64, error) {
+	return scanFixed(src, 2)
+}
+
+// scanFixed converts a database value into an integer scaled by 10^places
+func scanFixed(src interface{}, places int) (int64, error) {
+	switch v := src.(type) {
+	case nil:
+		return 0, nil
+	case []byte:
+		return parseFixed(string(v), places)
+	case string:
+		return parseFixed(v, places)
+	case int64:
+		return v * int64(math.Pow10(places)), nil
+	case float64:
+		return int64(math.Round(v * math.Pow10(places))), nil
+	}
+	return 0, fmt.Errorf("cannot scan %T into a decimal", src)
+}
+
+// divRound divides n by d, rounding half away from zero
+func divRound(n, d int64) int64 {
+	if d < 0 {
+		n, d = -n, -d
+	}
+	if n < 0 {
+		return -((-n + d/2) / d)
+	}
+	return (n + d/2) / d
+}
+
+// isDigits reports whether s consists only of ASCII digits
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFixed(t *testing.T) {
+	tests := []struct {
+		in      string
+		places  int
+		want    int64
+		wantErr bool
+	}{
+		{in: "12", places: 2, want: 1200},
+		{in: "-3.5", places: 2, want: -350},
+		{in: "+3.5", places: 2, want: 350},
+		{in: " 1234.56 ", places: 2, want: 123456},
+		{in: ".5", places: 2, want: 50},
+		{in: "5.", places: 2, want: 500},
+		{in: "1.500", places: 2, want: 150},
+		{in: "1.0825", places: 8, want: 108250000},
+		{in: "1.005", places: 2, wantErr: true},
+		{in: "0.001", places: 2, wantErr: true},
+		{in: "1.123456789", places: 8, wantErr: true},
+		{in: "", places: 2, wantErr: true},
+		{in: ".", places: 2, wantErr: true},
+		{in: "-", places: 2, wantErr: true},
+		{in: "1e3", places: 2, wantErr: true},
+		{in: "1,000.00", places: 2, wantErr: true},
+		{in: "--1", places: 2, wantErr: true},
+		{in: "1.-5", places: 2, wantErr: true},
+		{in: "10000000000000000", places: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFixed(tt.in, tt.places)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("parseFixed(%q, %d) = %d, %v, want ErrInvalid", tt.in, tt.places, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseFixed(%q, %d) = %d, %v, want %d", tt.in, tt.places, got, err, tt.want)
+		}
+	}
+}
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		n, d, want int64
+	}{
+		{n: 10, d: 4, want: 3},
+		{n: -10, d: 4, want: -3},
+		{n: 10, d: -4, want: -3},
+		{n: -10, d: -4, want: 3},
+		{n: 9, d: 4, want: 2},
+		{n: -9, d: 4, want: -2},
+		{n: 11, d: 4, want: 3},
+		{n: 15, d: 10, want: 2},
+		{n: -15, d: 10, want: -2},
+		{n: 14, d: 10, want: 1},
+		{n: 0, d: 7, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := divRound(tt.n, tt.d); got != tt.want {
+			t.Errorf("divRound(%d, %d) = %d, want %d", tt.n, tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestMonthlyInterest(t *testing.T) {
+	tests := []struct {
+		balance Amount
+		rate    Rate
+		want    Amount
+	}{
+		// $1,000.00 at 24% is exactly $20.00 a month
+		{balance: 100000, rate: 2400, want: 2000},
+		// $100.00 at 19.99% is 166.58 cents
+		{balance: 10000, rate: 1999, want: 167},
+		// 0.5 cents rounds up, away from zero
+		{balance: 100, rate: 600, want: 1},
+		{balance: -100, rate: 600, want: -1},
+		{balance: 100000, rate: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := MonthlyInterest(tt.balance, tt.rate); got != tt.want {
+			t.Errorf("MonthlyInterest(%s, %s) = %s, want %s", tt.balance, tt.rate, got, tt.want)
+		}
+	}
+}
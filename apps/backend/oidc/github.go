@@ -0,0 +1,94 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// GitHubProvider signs users in with GitHub, which has no ID tokens. The
+// user's ID and verified primary email address come from the GitHub API.
+type GitHubProvider struct {
+	Config
+	// BaseURL and APIURL default to github.com and api.github.com, and are
+	// set for GitHub Enterprise Server
+	BaseURL string
+	APIURL  string
+}
+
+// gitHubUser is the part of GET /user used here
+type gitHubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+// gitHubEmail is an entry of GET /user/emails
+type gitHubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// AuthURL implements Provider
+func (p *GitHubProvider) AuthURL(ctx context.Context, req AuthRequest) (string, error) {
+	return p.withScopes().authCodeURL(p.baseURL()+"/login/oauth/authorize", req, nil)
+}
+
+// Exchange implements Provider
+func (p *GitHubProvider) Exchange(ctx context.Context, code string, req AuthRequest) (Identity, error) {
+	token, err := p.exchangeCode(ctx, p.baseURL()+"/login/oauth/access_token", code, req)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var user gitHubUser
+	if err := p.getJSON(ctx, p.apiURL()+"/user", token.AccessToken, &user); err != nil {
+		return Identity{}, err
+	}
+	if user.ID == 0 {
+		return Identity{}, errors.New("GitHub user has no ID")
+	}
+
+	var emails []gitHubEmail
+	if err := p.getJSON(ctx, p.apiURL()+"/user/emails", token.AccessToken, &emails); err != nil {
+		return Identity{}, err
+	}
+
+	identity := Identity{Subject: strconv.FormatInt(user.ID, 10), Name: user.Name}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+	return identity, nil
+}
+
+// withScopes returns the config, asking for the user's email addresses unless
+// it has scopes of its own
+func (p *GitHubProvider) withScopes() Config {
+	cfg := p.Config
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"read:user", "user:email"}
+	}
+	return cfg
+}
+
+func (p *GitHubProvider) baseURL() string {
+	if p.BaseURL == "" {
+		return "https://github.com"
+	}
+	return strings.TrimRight(p.BaseURL, "/")
+}
+
+func (p *GitHubProvider) apiURL() string {
+	if p.APIURL == "" {
+		return "https://api.github.com"
+	}
+	return strings.TrimRight(p.APIURL, "/")
+}
@@ -0,0 +1,127 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Provider keys are cached for keyCacheTTL. A token signed with an unknown
+// key refetches them, at most once per keyRefetchInterval, so rotations are
+// picked up without letting bad tokens hammer the provider.
+const (
+	keyCacheTTL        = time.Hour
+	keyRefetchInterval = time.Minute
+)
+
+// keySet is a provider's cached JSON Web Key Set
+type keySet struct {
+	url       string
+	keys      map[string]publicKey
+	fetchedAt time.Time
+}
+
+// publicKey is a provider key with the algorithm it signs with
+type publicKey struct {
+	alg    string
+	public interface{}
+}
+
+// jwk is a JSON Web Key as published by a provider
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// get returns the key named kid, fetching the key set when it is stale or
+// does not have the key
+func (s *keySet) get(ctx context.Context, cfg Config, kid string) (publicKey, error) {
+	key, ok := s.keys[kid]
+	stale := time.Since(s.fetchedAt) > keyCacheTTL
+	if ok && !stale {
+		return key, nil
+	}
+	if !stale && time.Since(s.fetchedAt) < keyRefetchInterval {
+		return publicKey{}, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := cfg.getJSON(ctx, s.url, "", &doc); err != nil {
+		return publicKey{}, fmt.Errorf("fetching provider keys: %w", err)
+	}
+
+	keys := map[string]publicKey{}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if parsed, err := k.parse(); err == nil {
+			keys[k.KeyID] = parsed
+		}
+	}
+	s.keys = keys
+	s.fetchedAt = time.Now()
+
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	return publicKey{}, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// parse converts an RSA or P-256 JWK to a public key
+func (k jwk) parse() (publicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return publicKey{}, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return publicKey{}, err
+		}
+		if n.BitLen() < 2048 || !e.IsInt64() {
+			return publicKey{}, fmt.Errorf("unsupported RSA key %q", k.KeyID)
+		}
+		return publicKey{alg: "RS256", public: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return publicKey{}, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return publicKey{}, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return publicKey{}, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return publicKey{}, fmt.Errorf("EC key %q is not on its curve", k.KeyID)
+		}
+		return publicKey{alg: "ES256", public: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+	}
+	return publicKey{}, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+// decodeInt decodes a base64url encoded big-endian integer
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
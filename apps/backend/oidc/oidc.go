@@ -0,0 +1,245 @@
+// Package oidc signs users in with external identity providers through the
+// OAuth 2.0 authorization code flow with PKCE. OpenID Connect providers such
+// as Google prove who the user is with a signed ID token. GitHub only speaks
+// OAuth 2.0, so its API is asked instead.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxResponseSize caps how much of a provider response is read
+const maxResponseSize = 1 << 20
+
+// requestTimeout bounds each request to a provider
+const requestTimeout = 10 * time.Second
+
+// Identity is who a provider says the user is
+type Identity struct {
+	// Subject is the provider's stable, unique ID of the user
+	Subject string
+	Email   string
+	// EmailVerified reports whether the provider has verified Email
+	EmailVerified bool
+	Name          string
+}
+
+// AuthRequest is a started sign-in. It must be kept server side until the
+// provider redirects back, and used once.
+type AuthRequest struct {
+	// State ties the provider's redirect to this request
+	State string
+	// Nonce ties the ID token to this request
+	Nonce string
+	// CodeVerifier is the PKCE secret the authorization code is redeemed with
+	CodeVerifier string
+}
+
+// NewAuthRequest returns an AuthRequest with fresh random values
+func NewAuthRequest() (AuthRequest, error) {
+	var req AuthRequest
+	for _, value := range []*string{&req.State, &req.Nonce, &req.CodeVerifier} {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return AuthRequest{}, err
+		}
+		*value = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return req, nil
+}
+
+// codeChallenge is the S256 PKCE challenge of the request's code verifier
+func (r AuthRequest) codeChallenge() string {
+	sum := sha256.Sum256([]byte(r.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Provider is an identity provider users can sign in with
+type Provider interface {
+	// AuthURL returns the URL the user is sent to in order to sign in
+	AuthURL(ctx context.Context, req AuthRequest) (string, error)
+	// Exchange redeems the authorization code the provider redirected back
+	// with and returns the user's identity
+	Exchange(ctx context.Context, code string, req AuthRequest) (Identity, error)
+}
+
+// Config is what every provider needs to know about this application
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends the user back to, and must be
+	// registered with the provider
+	RedirectURL string
+	Scopes      []string
+	// Client makes requests to the provider, http.DefaultClient when nil
+	Client *http.Client
+}
+
+// ProvidersConfig holds the client registrations with the supported providers
+type ProvidersConfig struct {
+	GoogleClientID     string
+	GoogleClientSecret string
+	GoogleIssuer       string
+	GitHubClientID     string
+	GitHubClientSecret string
+	// GitHubURL and GitHubAPIURL point at GitHub Enterprise, github.com when empty
+	GitHubURL    string
+	GitHubAPIURL string
+	// RedirectBaseURL is where providers send the user back to, followed by
+	// the provider's name
+	RedirectBaseURL string
+}
+
+// Providers returns the providers with a client ID configured, by name:
+// "google" and "github"
+func Providers(cfg ProvidersConfig) map[string]Provider {
+	providers := map[string]Provider{}
+	if cfg.GoogleClientID != "" {
+		providers["google"] = NewOIDCProvider(cfg.GoogleIssuer, Config{
+			ClientID:     cfg.GoogleClientID,
+			ClientSecret: cfg.GoogleClientSecret,
+			RedirectURL:  cfg.RedirectURL("google"),
+		})
+	}
+	if cfg.GitHubClientID != "" {
+		providers["github"] = &GitHubProvider{
+			Config: Config{
+				ClientID:     cfg.GitHubClientID,
+				ClientSecret: cfg.GitHubClientSecret,
+				RedirectURL:  cfg.RedirectURL("github"),
+			},
+			BaseURL: cfg.GitHubURL,
+			APIURL:  cfg.GitHubAPIURL,
+		}
+	}
+	return providers
+}
+
+// RedirectURL is where a provider sends the user back to
+func (c ProvidersConfig) RedirectURL(provider string) string {
+	return strings.TrimRight(c.RedirectBaseURL, "/") + "/" + provider
+}
+
+// authCodeURL builds the authorization request URL for an endpoint
+func (c Config) authCodeURL(endpoint string, req AuthRequest, extra url.Values) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", c.ClientID)
+	query.Set("redirect_uri", c.RedirectURL)
+	query.Set("scope", strings.Join(c.Scopes, " "))
+	query.Set("state", req.State)
+	query.Set("code_challenge", req.codeChallenge())
+	query.Set("code_challenge_method", "S256")
+	for key, values := range extra {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// tokenResponse is the token endpoint's answer
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode redeems an authorization code at a token endpoint
+func (c Config) exchangeCode(ctx context.Context, endpoint, code string, req AuthRequest) (tokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.RedirectURL},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+		"code_verifier": {req.CodeVerifier},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+
+	var token tokenResponse
+	status, err := c.do(httpReq, &token)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	// GitHub reports errors with a 200 status, so both are checked
+	if token.Error != "" {
+		return tokenResponse{}, fmt.Errorf("token request failed: %s", strings.TrimSpace(token.Error+" "+token.ErrorDescription))
+	}
+	if status != http.StatusOK {
+		return tokenResponse{}, fmt.Errorf("token request failed with status %d", status)
+	}
+	if token.AccessToken == "" {
+		return tokenResponse{}, errors.New("token response has no access token")
+	}
+	return token, nil
+}
+
+// getJSON fetches a JSON document, authorized with accessToken when it is set
+func (c Config) getJSON(ctx context.Context, endpoint, accessToken string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	status, err := c.do(req, v)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("GET %s failed with status %d", endpoint, status)
+	}
+	return nil
+}
+
+// do sends a request and decodes a JSON response body into v. Error
+// responses are decoded too, as they may explain the error.
+func (c Config) do(req *http.Request, v interface{}) (int, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("decoding %s response: %w", req.URL, err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,101 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kevinlucasklein/zero-balance/oidc"
+	"github.com/kevinlucasklein/zero-balance/oidc/oidctest"
+)
+
+func TestOIDCProviderExchange(t *testing.T) {
+	provider, err := oidctest.NewProvider("zero-balance", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Close()
+
+	identity := oidc.Identity{Subject: "42", Email: "ada@example.com", EmailVerified: true, Name: "Ada"}
+	provider.SetIdentity(identity)
+	client := provider.Client("http://app.test/auth/callback/test")
+
+	tests := []struct {
+		name string
+		// tamper changes the request or code the callback redeems
+		tamper func(req *oidc.AuthRequest, code *string)
+		// redeemTwice redeems the code before the exchange being checked
+		redeemTwice bool
+		wantErr     bool
+		wantIs      error
+	}{
+		{name: "valid", tamper: func(*oidc.AuthRequest, *string) {}},
+		{
+			name:    "wrong code verifier",
+			tamper:  func(req *oidc.AuthRequest, _ *string) { req.CodeVerifier = "not-the-verifier" },
+			wantErr: true,
+		},
+		{
+			name:    "nonce of another sign-in",
+			tamper:  func(req *oidc.AuthRequest, _ *string) { req.Nonce = "another-nonce" },
+			wantErr: true,
+			wantIs:  oidc.ErrNonceMismatch,
+		},
+		{
+			name:    "unknown code",
+			tamper:  func(_ *oidc.AuthRequest, code *string) { *code = "made-up" },
+			wantErr: true,
+		},
+		{
+			name:        "code redeemed twice",
+			tamper:      func(*oidc.AuthRequest, *string) {},
+			redeemTwice: true,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			req, err := oidc.NewAuthRequest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			authURL, err := client.AuthURL(ctx, req)
+			if err != nil {
+				t.Fatalf("AuthURL: %v", err)
+			}
+			code, state, err := provider.Authorize(authURL)
+			if err != nil {
+				t.Fatalf("Authorize: %v", err)
+			}
+			if state != req.State {
+				t.Fatalf("state = %q, want %q", state, req.State)
+			}
+
+			if tt.redeemTwice {
+				if _, err := client.Exchange(ctx, code, req); err != nil {
+					t.Fatalf("first Exchange: %v", err)
+				}
+			}
+			tt.tamper(&req, &code)
+
+			got, err := client.Exchange(ctx, code, req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Exchange succeeded, want an error")
+				}
+				if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+					t.Fatalf("Exchange error = %v, want %v", err, tt.wantIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if got != identity {
+				t.Fatalf("identity = %+v, want %+v", got, identity)
+			}
+		})
+	}
+}
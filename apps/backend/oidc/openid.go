@@ -0,0 +1,172 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// clockSkew is how far iat may lie in the future and exp in the past, to
+// allow for clock differences with the provider
+const clockSkew = time.Minute
+
+// ErrNonceMismatch is returned for an ID token that was not issued for the
+// sign-in being finished, which may be a replay
+var ErrNonceMismatch = errors.New("ID token nonce does not match")
+
+// OIDCProvider is an OpenID Connect provider. Its endpoints are discovered
+// from the issuer, and the ID token returned with the access token says who
+// the user is.
+type OIDCProvider struct {
+	Config
+	// Issuer is the provider's issuer URL, e.g. https://accounts.google.com
+	Issuer string
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     *keySet
+}
+
+// metadata is the part of the provider's discovery document used here
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// idTokenClaims are the ID token claims used here
+type idTokenClaims struct {
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	Email           string `json:"email"`
+	// EmailVerified is a string in some providers' tokens
+	EmailVerified interface{} `json:"email_verified"`
+	Name          string      `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// NewOIDCProvider returns a provider for an issuer, asking for the user's
+// email address and name unless cfg has scopes of its own
+func NewOIDCProvider(issuer string, cfg Config) *OIDCProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &OIDCProvider{Config: cfg, Issuer: strings.TrimRight(issuer, "/")}
+}
+
+// AuthURL implements Provider
+func (p *OIDCProvider) AuthURL(ctx context.Context, req AuthRequest) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.authCodeURL(meta.AuthorizationEndpoint, req, map[string][]string{"nonce": {req.Nonce}})
+}
+
+// Exchange implements Provider. The identity comes from the ID token, which
+// must be signed by the provider, issued to this client and for this request.
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, req AuthRequest) (Identity, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	token, err := p.exchangeCode(ctx, meta.TokenEndpoint, code, req)
+	if err != nil {
+		return Identity{}, err
+	}
+	if token.IDToken == "" {
+		return Identity{}, errors.New("token response has no ID token")
+	}
+
+	claims := &idTokenClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "ES256"}), jwt.WithoutClaimsValidation())
+	_, err = parser.ParseWithClaims(token.IDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		return p.verificationKey(ctx, t)
+	})
+	if err != nil {
+		return Identity{}, fmt.Errorf("verifying ID token: %w", err)
+	}
+	if err := p.validate(claims, req.Nonce); err != nil {
+		return Identity{}, fmt.Errorf("verifying ID token: %w", err)
+	}
+
+	verified, _ := claims.EmailVerified.(bool)
+	if s, ok := claims.EmailVerified.(string); ok {
+		verified = s == "true"
+	}
+	return Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+		Name:          claims.Name,
+	}, nil
+}
+
+// validate checks the ID token claims as OpenID Connect Core 3.1.3.7 requires
+func (p *OIDCProvider) validate(claims *idTokenClaims, nonce string) error {
+	now := time.Now()
+	switch {
+	case claims.Subject == "" || claims.ExpiresAt == nil || claims.IssuedAt == nil:
+		return errors.New("ID token is missing a required claim")
+	case claims.Issuer != p.Issuer:
+		return jwt.ErrTokenInvalidIssuer
+	case !claims.VerifyAudience(p.ClientID, true):
+		return jwt.ErrTokenInvalidAudience
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID:
+		return jwt.ErrTokenInvalidAudience
+	case !claims.VerifyExpiresAt(now.Add(-clockSkew), true):
+		return jwt.ErrTokenExpired
+	case !claims.VerifyIssuedAt(now.Add(clockSkew), true):
+		return jwt.ErrTokenUsedBeforeIssued
+	case !claims.VerifyNotBefore(now.Add(clockSkew), false):
+		return jwt.ErrTokenNotValidYet
+	case claims.Nonce == "" || claims.Nonce != nonce:
+		return ErrNonceMismatch
+	}
+	return nil
+}
+
+// discover fetches the provider's discovery document once and caches it
+func (p *OIDCProvider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var meta metadata
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", "", &meta); err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", p.Issuer, err)
+	}
+	if meta.Issuer != p.Issuer {
+		return nil, fmt.Errorf("discovering %s: document is for issuer %q", p.Issuer, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("discovering %s: document is missing an endpoint", p.Issuer)
+	}
+	p.metadata = &meta
+	p.keys = &keySet{url: meta.JWKSURI}
+	return p.metadata, nil
+}
+
+// verificationKey picks the provider key an ID token is signed with
+func (p *OIDCProvider) verificationKey(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key, err := p.keys.get(ctx, p.Config, kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.public, nil
+}
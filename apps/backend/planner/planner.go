@@ -0,0 +1,278 @@
+// Package planner builds month-by-month debt payoff schedules.
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kevinlucasklein/zero-balance/money"
+)
+
+// Strategy decides which debt receives money left over after minimum payments
+type Strategy string
+
+const (
+	// Avalanche pays the highest interest rate first
+	Avalanche Strategy = "avalanche"
+	// Snowball pays the smallest balance first
+	Snowball Strategy = "snowball"
+	// Custom pays debts in a user-supplied order
+	Custom Strategy = "custom"
+)
+
+// MaxMonths bounds a schedule so a plan that barely outpaces interest still terminates
+const MaxMonths = 1200
+
+var (
+	// ErrInvalidStrategy is returned for an unknown strategy name
+	ErrInvalidStrategy = errors.New("strategy must be 'avalanche', 'snowball', or 'custom'")
+	// ErrBudgetTooLow is returned when the budget does not cover the minimum payments
+	ErrBudgetTooLow = errors.New("monthly budget does not cover the minimum payments")
+	// ErrNoProgress is returned when the budget does not outpace accruing interest
+	ErrNoProgress = errors.New("monthly budget does not cover the interest, debts would never be paid off")
+)
+
+// Debt is the part of a debts row the planner needs
+type Debt struct {
+	ID             int
+	Name           string
+	Balance        money.Amount
+	InterestRate   money.Rate
+	MinimumPayment money.Amount
+}
+
+// DebtPayment is the amount paid towards one debt in one month
+type DebtPayment struct {
+	DebtID    int          `json:"debt_id"`
+	Payment   money.Amount `json:"payment"`
+	Interest  money.Amount `json:"interest"`
+	Principal money.Amount `json:"principal"`
+	Balance   money.Amount `json:"balance"`
+}
+
+// Month is one row of the amortized schedule
+type Month struct {
+	Month     int           `json:"month"`
+	Date      string        `json:"date"`
+	Payments  []DebtPayment `json:"payments"`
+	Total     money.Amount  `json:"total"`
+	Interest  money.Amount  `json:"interest"`
+	Remaining money.Amount  `json:"remaining"`
+}
+
+// DebtSummary reports when a single debt is paid off and what it cost
+type DebtSummary struct {
+	DebtID        int          `json:"debt_id"`
+	Name          string       `json:"name"`
+	Priority      int          `json:"priority"`
+	PayoffMonth   int          `json:"payoff_month"`
+	PayoffDate    string       `json:"payoff_date"`
+	TotalInterest money.Amount `json:"total_interest"`
+	TotalPaid     money.Amount `json:"total_paid"`
+}
+
+// Plan is a complete payoff schedule. All amounts are in a single currency,
+// which the caller records in Currency.
+type Plan struct {
+	Strategy      Strategy      `json:"strategy"`
+	Currency      string        `json:"currency,omitempty"`
+	MonthlyBudget money.Amount  `json:"monthly_budget"`
+	Months        int           `json:"months"`
+	PayoffDate    string        `json:"payoff_date"`
+	TotalInterest money.Amount  `json:"total_interest"`
+	TotalPaid     money.Amount  `json:"total_paid"`
+	Debts         []DebtSummary `json:"debts"`
+	Schedule      []Month       `json:"schedule"`
+}
+
+// ParseStrategy converts a query string value into a Strategy
+func ParseStrategy(value string) (Strategy, error) {
+	switch Strategy(value) {
+	case Avalanche, Snowball, Custom:
+		return Strategy(value), nil
+	}
+	return "", ErrInvalidStrategy
+}
+
+// Build simulates paying off debts with a fixed monthly budget. Each month
+// interest accrues on every open balance, every debt receives its minimum
+// payment, and whatever is left of the budget goes to debts in priority
+// order. Minimums freed up by paid-off debts roll into the extra payment.
+// order is only used by the Custom strategy; debts it does not mention are
+// paid after the listed ones in avalanche order. Month 1 is the month after
+// start.
+func Build(debts []Debt, budget money.Amount, strategy Strategy, order []int, start time.Time) (*Plan, error) {
+	prioritized, err := prioritize(debts, strategy, order)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Strategy:      strategy,
+		MonthlyBudget: budget,
+		Debts:         make([]DebtSummary, len(prioritized)),
+		Schedule:      []Month{},
+	}
+
+	balances := make([]money.Amount, len(prioritized))
+	var remaining money.Amount
+	for i, debt := range prioritized {
+		balances[i] = debt.Balance
+		remaining += balances[i]
+		plan.Debts[i] = DebtSummary{DebtID: debt.ID, Name: debt.Name, Priority: i + 1}
+	}
+
+	for month := 1; remaining > 0; month++ {
+		if month > MaxMonths {
+			return nil, ErrNoProgress
+		}
+
+		date := monthDate(start, month)
+		row := Month{Month: month, Date: date, Payments: []DebtPayment{}}
+		payments := make([]DebtPayment, len(prioritized))
+
+		// Accrue interest and pay minimums
+		available := budget
+		for i, debt := range prioritized {
+			if balances[i] <= 0 {
+				continue
+			}
+			interest := money.MonthlyInterest(balances[i], debt.InterestRate)
+			balances[i] += interest
+
+			payment := money.Min(debt.MinimumPayment, balances[i])
+			payments[i] = DebtPayment{DebtID: debt.ID, Payment: payment, Interest: interest}
+			available -= payment
+		}
+		if available < 0 {
+			return nil, ErrBudgetTooLow
+		}
+
+		// Spend the rest of the budget in priority order
+		for i := range prioritized {
+			if available <= 0 {
+				break
+			}
+			if balances[i] <= 0 {
+				continue
+			}
+			extra := money.Min(available, balances[i]-payments[i].Payment)
+			payments[i].Payment += extra
+			available -= extra
+		}
+
+		// Apply payments and record the month
+		var newRemaining money.Amount
+		for i := range prioritized {
+			if balances[i] <= 0 {
+				continue
+			}
+			p := payments[i]
+			balances[i] -= p.Payment
+			p.Principal = p.Payment - p.Interest
+			p.Balance = balances[i]
+			row.Payments = append(row.Payments, p)
+			row.Total += p.Payment
+			row.Interest += p.Interest
+			newRemaining += balances[i]
+
+			summary := &plan.Debts[i]
+			summary.TotalInterest += p.Interest
+			summary.TotalPaid += p.Payment
+			if balances[i] == 0 {
+				summary.PayoffMonth = month
+				summary.PayoffDate = date
+			}
+		}
+		if newRemaining >= remaining {
+			return nil, ErrNoProgress
+		}
+		remaining = newRemaining
+		row.Remaining = remaining
+
+		plan.Schedule = append(plan.Schedule, row)
+		plan.Months = month
+		plan.PayoffDate = date
+		plan.TotalInterest += row.Interest
+		plan.TotalPaid += row.Total
+	}
+
+	return plan, nil
+}
+
+// prioritize returns a copy of debts sorted by the order extra money is applied
+func prioritize(debts []Debt, strategy Strategy, order []int) ([]Debt, error) {
+	sorted := make([]Debt, 0, len(debts))
+	for _, debt := range debts {
+		if debt.Balance < 0 || debt.InterestRate < 0 || debt.MinimumPayment < 0 {
+			return nil, fmt.Errorf("debt %d has a negative balance, rate or minimum payment", debt.ID)
+		}
+		if debt.Balance > 0 {
+			sorted = append(sorted, debt)
+		}
+	}
+
+	avalanche := func(a, b Debt) bool {
+		if a.InterestRate != b.InterestRate {
+			return a.InterestRate > b.InterestRate
+		}
+		if a.Balance != b.Balance {
+			return a.Balance < b.Balance
+		}
+		return a.ID < b.ID
+	}
+
+	switch strategy {
+	case Avalanche:
+		sort.SliceStable(sorted, func(i, j int) bool { return avalanche(sorted[i], sorted[j]) })
+	case Snowball:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			a, b := sorted[i], sorted[j]
+			if a.Balance != b.Balance {
+				return a.Balance < b.Balance
+			}
+			if a.InterestRate != b.InterestRate {
+				return a.InterestRate > b.InterestRate
+			}
+			return a.ID < b.ID
+		})
+	case Custom:
+		rank := make(map[int]int, len(order))
+		known := make(map[int]bool, len(debts))
+		for _, debt := range debts {
+			known[debt.ID] = true
+		}
+		for i, id := range order {
+			if !known[id] {
+				return nil, fmt.Errorf("debt %d in the custom order is not an active debt", id)
+			}
+			if _, dup := rank[id]; dup {
+				return nil, fmt.Errorf("debt %d appears more than once in the custom order", id)
+			}
+			rank[id] = i
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			a, b := sorted[i], sorted[j]
+			ra, aListed := rank[a.ID]
+			rb, bListed := rank[b.ID]
+			switch {
+			case aListed && bListed:
+				return ra < rb
+			case aListed != bListed:
+				return aListed
+			}
+			return avalanche(a, b)
+		})
+	default:
+		return nil, ErrInvalidStrategy
+	}
+
+	return sorted, nil
+}
+
+// monthDate returns the YYYY-MM label of the nth month after start
+func monthDate(start time.Time, n int) string {
+	return time.Date(start.Year(), start.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC).Format("2006-01")
+}
@@ -0,0 +1,107 @@
+package planner
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kevinlucasklein/zero-balance/money"
+)
+
+var start = time.Date(2025, time.January, 15, 0, 0, 0, 0, time.UTC)
+
+// testDebts has a different debt first under each strategy
+var testDebts = []Debt{
+	{ID: 1, Name: "Card", Balance: 100000, InterestRate: 2499, MinimumPayment: 2500},
+	{ID: 2, Name: "Loan", Balance: 50000, InterestRate: 500, MinimumPayment: 2500},
+	{ID: 3, Name: "Store card", Balance: 200000, InterestRate: 1800, MinimumPayment: 4000},
+}
+
+func TestBuildPriority(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		order    []int
+		want     []int
+	}{
+		{name: "avalanche pays the highest rate first", strategy: Avalanche, want: []int{1, 3, 2}},
+		{name: "snowball pays the smallest balance first", strategy: Snowball, want: []int{2, 1, 3}},
+		{name: "custom order, then avalanche", strategy: Custom, order: []int{2}, want: []int{2, 1, 3}},
+		{name: "custom order", strategy: Custom, order: []int{3, 2, 1}, want: []int{3, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := Build(testDebts, 20000, tt.strategy, tt.order, start)
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+
+			var got []int
+			for _, summary := range plan.Debts {
+				got = append(got, summary.DebtID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("priority order %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("priority order %v, want %v", got, tt.want)
+				}
+			}
+
+			// Everything above the minimums goes to the first debt
+			minimums := money.Sum(testDebts[0].MinimumPayment, testDebts[1].MinimumPayment, testDebts[2].MinimumPayment)
+			for _, p := range plan.Schedule[0].Payments {
+				want := minimumOf(p.DebtID)
+				if p.DebtID == tt.want[0] {
+					want += plan.MonthlyBudget - minimums
+				}
+				if p.Payment != want {
+					t.Fatalf("month 1 payment to debt %d = %s, want %s", p.DebtID, p.Payment, want)
+				}
+			}
+
+			if last := plan.Schedule[len(plan.Schedule)-1]; last.Remaining != 0 || last.Date != plan.PayoffDate {
+				t.Fatalf("last month %+v, want everything paid off by %s", last, plan.PayoffDate)
+			}
+		})
+	}
+}
+
+// minimumOf returns the minimum payment of one of testDebts
+func minimumOf(id int) money.Amount {
+	for _, debt := range testDebts {
+		if debt.ID == id {
+			return debt.MinimumPayment
+		}
+	}
+	return 0
+}
+
+func TestBuildErrors(t *testing.T) {
+	// $20.00 of interest accrues in the first month
+	debt := Debt{ID: 1, Name: "Card", Balance: 100000, InterestRate: 2400, MinimumPayment: 1000}
+
+	tests := []struct {
+		name     string
+		budget   money.Amount
+		strategy Strategy
+		wantErr  error
+	}{
+		{name: "budget below the minimums", budget: 999, strategy: Avalanche, wantErr: ErrBudgetTooLow},
+		{name: "budget below the interest", budget: 1500, strategy: Avalanche, wantErr: ErrNoProgress},
+		{name: "budget equal to the interest", budget: 2000, strategy: Snowball, wantErr: ErrNoProgress},
+		{name: "budget above the interest", budget: 5000, strategy: Snowball},
+		{name: "unknown strategy", budget: 5000, strategy: "random", wantErr: ErrInvalidStrategy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Build([]Debt{debt}, tt.budget, tt.strategy, nil, start)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Build error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
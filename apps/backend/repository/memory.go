@@ -0,0 +1,1292 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevinlucasklein/zero-balance/audit"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/money"
+)
+
+// MemoryStore keeps the models in process memory, for tests. Transactions
+// hold the store's lock until they finish and are rolled back by restoring a
+// snapshot.
+type MemoryStore struct {
+	mu   *sync.Mutex
+	data *memoryData
+	// inTx is set on the store handed to an InTx callback, which already
+	// holds mu
+	inTx bool
+}
+
+type memoryData struct {
+	nextID             int
+	users              map[int]models.User
+	debts              []models.Debt
+	incomeSources      []models.IncomeSource
+	payments           []models.Payment
+	scheduledPayments  []models.ScheduledPayment
+	exchangeRates      []models.ExchangeRate
+	refreshTokens      map[string]memoryRefreshToken
+	sessions           map[string]memorySession
+	verificationTokens map[string]memoryOneTimeToken
+	resetTokens        map[string]memoryOneTimeToken
+	mfa                map[int]memoryMFA
+	recoveryCodes      []memoryRecoveryCode
+	identities         []memoryIdentity
+	loginStates        map[string]memoryLoginState
+	auditEvents        []memoryAuditEvent
+}
+
+type memoryRefreshToken struct {
+	RefreshToken
+	expiresAt time.Time
+}
+
+type memorySession struct {
+	userID     int
+	userAgent  string
+	ipAddress  string
+	createdAt  time.Time
+	lastSeenAt time.Time
+	revoked    bool
+}
+
+type memoryOneTimeToken struct {
+	userID    int
+	expiresAt time.Time
+	used      bool
+}
+
+// memoryMFA is the part of MFAState kept apart from the user, whose
+// MFAEnabled field says whether it is enabled
+type memoryMFA struct {
+	secret   string
+	lastStep int64
+}
+
+type memoryRecoveryCode struct {
+	userID   int
+	codeHash string
+	used     bool
+}
+
+type memoryIdentity struct {
+	models.Identity
+	subject string
+}
+
+type memoryLoginState struct {
+	LoginState
+	expiresAt time.Time
+}
+
+// memoryAuditEvent is an event as recorded, with its states marshalled as
+// the Postgres store keeps them
+type memoryAuditEvent struct {
+	audit.Event
+	id            int64
+	before, after json.RawMessage
+	createdAt     time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mu: &sync.Mutex{},
+		data: &memoryData{
+			users:              map[int]models.User{},
+			refreshTokens:      map[string]memoryRefreshToken{},
+			sessions:           map[string]memorySession{},
+			verificationTokens: map[string]memoryOneTimeToken{},
+			resetTokens:        map[string]memoryOneTimeToken{},
+			mfa:                map[int]memoryMFA{},
+			loginStates:        map[string]memoryLoginState{},
+		},
+	}
+}
+
+// clone copies the data deeply enough that changes to the copy never show
+// through to the original
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		nextID:             d.nextID,
+		users:              maps.Clone(d.users),
+		debts:              slices.Clone(d.debts),
+		incomeSources:      slices.Clone(d.incomeSources),
+		payments:           slices.Clone(d.payments),
+		scheduledPayments:  slices.Clone(d.scheduledPayments),
+		exchangeRates:      slices.Clone(d.exchangeRates),
+		refreshTokens:      maps.Clone(d.refreshTokens),
+		sessions:           maps.Clone(d.sessions),
+		verificationTokens: maps.Clone(d.verificationTokens),
+		resetTokens:        maps.Clone(d.resetTokens),
+		mfa:                maps.Clone(d.mfa),
+		recoveryCodes:      slices.Clone(d.recoveryCodes),
+		identities:         slices.Clone(d.identities),
+		loginStates:        maps.Clone(d.loginStates),
+		auditEvents:        slices.Clone(d.auditEvents),
+	}
+}
+
+// id returns the next row ID, shared by every table
+func (d *memoryData) id() int {
+	d.nextID++
+	return d.nextID
+}
+
+// lock locks the store and returns the function unlocking it, both no-ops
+// inside a transaction
+func (s *MemoryStore) lock() func() {
+	if s.inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// InTx implements Store
+func (s *MemoryStore) InTx(ctx context.Context, fn func(Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.data.clone()
+	if err := fn(&MemoryStore{mu: s.mu, data: s.data, inTx: true}); err != nil {
+		*s.data = *snapshot
+		return err
+	}
+	return nil
+}
+
+// Users implements Store
+func (s *MemoryStore) Users() UserRepository { return memUsers{s} }
+
+// Debts implements Store
+func (s *MemoryStore) Debts() DebtRepository { return memDebts{s} }
+
+// IncomeSources implements Store
+func (s *MemoryStore) IncomeSources() IncomeSourceRepository { return memIncomeSources{s} }
+
+// Payments implements Store
+func (s *MemoryStore) Payments() PaymentRepository { return memPayments{s} }
+
+// ScheduledPayments implements Store
+func (s *MemoryStore) ScheduledPayments() ScheduledPaymentRepository { return memScheduledPayments{s} }
+
+// ExchangeRates implements Store
+func (s *MemoryStore) ExchangeRates() ExchangeRateRepository { return memExchangeRates{s} }
+
+// Tokens implements Store
+func (s *MemoryStore) Tokens() TokenRepository { return memTokens{s} }
+
+// MFA implements Store
+func (s *MemoryStore) MFA() MFARepository { return memMFA{s} }
+
+// Identities implements Store
+func (s *MemoryStore) Identities() IdentityRepository { return memIdentities{s} }
+
+// LoginStates implements Store
+func (s *MemoryStore) LoginStates() LoginStateRepository { return memLoginStates{s} }
+
+// AuditEvents implements Store
+func (s *MemoryStore) AuditEvents() AuditRepository { return memAuditEvents{s} }
+
+// Stats implements Store
+func (s *MemoryStore) Stats() StatsRepository { return memStats{s} }
+
+// AddUser stores a user as is, giving it an ID when it has none, so tests
+// can set up any account state
+func (s *MemoryStore) AddUser(user models.User) models.User {
+	defer s.lock()()
+	if user.ID == 0 {
+		user.ID = s.data.id()
+	}
+	s.data.users[user.ID] = user
+	return user
+}
+
+// AddDebt stores a debt, giving it an ID
+func (s *MemoryStore) AddDebt(debt models.Debt) models.Debt {
+	defer s.lock()()
+	debt.ID = s.data.id()
+	s.data.debts = append(s.data.debts, debt)
+	return debt
+}
+
+// AddIncomeSource stores an income source, giving it an ID
+func (s *MemoryStore) AddIncomeSource(source models.IncomeSource) models.IncomeSource {
+	defer s.lock()()
+	source.ID = s.data.id()
+	s.data.incomeSources = append(s.data.incomeSources, source)
+	return source
+}
+
+// AddPayment stores a payment, giving it an ID
+func (s *MemoryStore) AddPayment(payment models.Payment) models.Payment {
+	defer s.lock()()
+	payment.ID = s.data.id()
+	s.data.payments = append(s.data.payments, payment)
+	return payment
+}
+
+// AddScheduledPayment stores a scheduled payment, giving it an ID
+func (s *MemoryStore) AddScheduledPayment(sp models.ScheduledPayment) models.ScheduledPayment {
+	defer s.lock()()
+	sp.ID = s.data.id()
+	s.data.scheduledPayments = append(s.data.scheduledPayments, sp)
+	return sp
+}
+
+// AddExchangeRate stores an exchange rate
+func (s *MemoryStore) AddExchangeRate(rate models.ExchangeRate) {
+	defer s.lock()()
+	s.data.exchangeRates = append(s.data.exchangeRates, rate)
+}
+
+// AuditLog returns the recorded audit events, oldest first
+func (s *MemoryStore) AuditLog() []audit.Event {
+	defer s.lock()()
+	events := make([]audit.Event, len(s.data.auditEvents))
+	for i, event := range s.data.auditEvents {
+		events[i] = event.Event
+	}
+	return events
+}
+
+// SessionState reports whether a login session exists and has not been
+// revoked, and its user's current token version, recording that the session
+// was just seen. It is the memory counterpart of the server's session lookup.
+func (s *MemoryStore) SessionState(ctx context.Context, sessionID string) (bool, int, error) {
+	defer s.lock()()
+	session, ok := s.data.sessions[sessionID]
+	user, userOK := s.data.users[session.userID]
+	if !ok || !userOK {
+		return false, 0, nil
+	}
+	session.lastSeenAt = time.Now()
+	s.data.sessions[sessionID] = session
+	return !session.revoked, user.TokenVersion, nil
+}
+
+// now formats the current time as the Postgres store reports timestamps
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+type memUsers struct{ s *MemoryStore }
+
+func (r memUsers) Create(ctx context.Context, user models.User) (models.User, error) {
+	defer r.s.lock()()
+	for _, existing := range r.s.data.users {
+		if existing.Email == user.Email {
+			return models.User{}, ErrEmailTaken
+		}
+	}
+
+	// Mirror the column defaults of the users table
+	created := models.User{
+		ID:            r.s.data.id(),
+		Name:          user.Name,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		BaseCurrency:  "USD",
+		CreatedAt:     now(),
+		PasswordHash:  user.PasswordHash,
+		Role:          "user",
+	}
+	r.s.data.users[created.ID] = created
+	return created, nil
+}
+
+func (r memUsers) ByID(ctx context.Context, id int) (models.User, error) {
+	defer r.s.lock()()
+	user, ok := r.s.data.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r memUsers) ByEmail(ctx context.Context, email string) (models.User, error) {
+	defer r.s.lock()()
+	for _, user := range r.s.data.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r memUsers) ByIDForUpdate(ctx context.Context, id int) (models.User, error) {
+	return r.ByID(ctx, id)
+}
+
+func (r memUsers) ByEmailForUpdate(ctx context.Context, email string) (models.User, error) {
+	defer r.s.lock()()
+	var found models.User
+	for _, user := range r.s.data.users {
+		if strings.EqualFold(user.Email, email) && (found.ID == 0 || user.ID < found.ID) {
+			found = user
+		}
+	}
+	if found.ID == 0 {
+		return models.User{}, ErrNotFound
+	}
+	return found, nil
+}
+
+func (r memUsers) UpdateProfile(ctx context.Context, id int, name, baseCurrency string) (models.User, error) {
+	return r.update(id, func(user *models.User) {
+		user.Name = name
+		if baseCurrency != "" {
+			user.BaseCurrency = baseCurrency
+		}
+	})
+}
+
+func (r memUsers) SetPasswordHash(ctx context.Context, id int, hash string) error {
+	_, err := r.update(id, func(user *models.User) {
+		user.PasswordHash = hash
+		user.PasswordResetRequired = false
+	})
+	return err
+}
+
+func (r memUsers) BumpTokenVersion(ctx context.Context, id int) (int, error) {
+	user, err := r.update(id, func(user *models.User) {
+		user.TokenVersion++
+	})
+	return user.TokenVersion, err
+}
+
+func (r memUsers) MarkEmailVerified(ctx context.Context, id int) error {
+	_, err := r.update(id, func(user *models.User) {
+		user.EmailVerified = true
+	})
+	return err
+}
+
+func (r memUsers) Search(ctx context.Context, filter UserFilter, limit, offset int) ([]models.User, int, error) {
+	defer r.s.lock()()
+	search := strings.ToLower(filter.Search)
+	var matches []models.User
+	for _, user := range r.s.data.users {
+		if search != "" && !strings.Contains(strings.ToLower(user.Name), search) &&
+			!strings.Contains(strings.ToLower(user.Email), search) {
+			continue
+		}
+		if filter.Role != "" && user.Role != filter.Role {
+			continue
+		}
+		if (filter.Status == "active" && user.DisabledAt != nil) || (filter.Status == "disabled" && user.DisabledAt == nil) {
+			continue
+		}
+		matches = append(matches, user)
+	}
+	slices.SortFunc(matches, func(a, b models.User) int { return cmp.Compare(a.ID, b.ID) })
+
+	page := []models.User{}
+	if offset < len(matches) {
+		page = append(page, matches[offset:min(offset+limit, len(matches))]...)
+	}
+	return page, len(matches), nil
+}
+
+func (r memUsers) SetDisabled(ctx context.Context, id int, disabled bool) error {
+	_, err := r.update(id, func(user *models.User) {
+		user.DisabledAt = nil
+		if disabled {
+			disabledAt := now()
+			user.DisabledAt = &disabledAt
+		}
+	})
+	return err
+}
+
+func (r memUsers) RequirePasswordReset(ctx context.Context, id int) error {
+	_, err := r.update(id, func(user *models.User) {
+		user.PasswordResetRequired = true
+	})
+	return err
+}
+
+func (r memUsers) Delete(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	d := r.s.data
+	delete(d.users, id)
+	delete(d.mfa, id)
+
+	// Mirror the cascades of the tables referencing users
+	d.debts = filter(d.debts, func(debt models.Debt) bool { return debt.UserID != id })
+	d.incomeSources = filter(d.incomeSources, func(source models.IncomeSource) bool { return source.UserID != id })
+	d.payments = filter(d.payments, func(payment models.Payment) bool { return payment.UserID != id })
+	d.scheduledPayments = filter(d.scheduledPayments, func(sp models.ScheduledPayment) bool { return sp.UserID != id })
+	d.recoveryCodes = filter(d.recoveryCodes, func(code memoryRecoveryCode) bool { return code.userID != id })
+	d.identities = filter(d.identities, func(identity memoryIdentity) bool { return identity.UserID != id })
+	maps.DeleteFunc(d.refreshTokens, func(_ string, token memoryRefreshToken) bool { return token.UserID == id })
+	maps.DeleteFunc(d.sessions, func(_ string, session memorySession) bool { return session.userID == id })
+	maps.DeleteFunc(d.verificationTokens, func(_ string, token memoryOneTimeToken) bool { return token.userID == id })
+	maps.DeleteFunc(d.resetTokens, func(_ string, token memoryOneTimeToken) bool { return token.userID == id })
+	return nil
+}
+
+// update applies change to a stored user and returns the result
+func (r memUsers) update(id int, change func(*models.User)) (models.User, error) {
+	defer r.s.lock()()
+	user, ok := r.s.data.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	change(&user)
+	r.s.data.users[id] = user
+	return user, nil
+}
+
+type memDebts struct{ s *MemoryStore }
+
+func (r memDebts) ListByUser(ctx context.Context, userID int) ([]models.Debt, error) {
+	defer r.s.lock()()
+	return filter(r.s.data.debts, func(d models.Debt) bool { return d.UserID == userID }), nil
+}
+
+func (r memDebts) ListByStatus(ctx context.Context, userID int, status string) ([]models.Debt, error) {
+	defer r.s.lock()()
+	debts := filter(r.s.data.debts, func(d models.Debt) bool {
+		return d.UserID == userID && (status == "" || d.Status == status)
+	})
+	slices.Reverse(debts)
+	return debts, nil
+}
+
+func (r memDebts) ByID(ctx context.Context, userID, id int) (models.Debt, error) {
+	defer r.s.lock()()
+	i := r.index(userID, id)
+	if i < 0 {
+		return models.Debt{}, ErrNotFound
+	}
+	return r.s.data.debts[i], nil
+}
+
+func (r memDebts) ByIDForUpdate(ctx context.Context, userID, id int) (models.Debt, error) {
+	return r.ByID(ctx, userID, id)
+}
+
+func (r memDebts) LockByUser(ctx context.Context, userID int) error {
+	return nil
+}
+
+func (r memDebts) Create(ctx context.Context, debt models.Debt) (models.Debt, error) {
+	defer r.s.lock()()
+	if debt.Currency == "" {
+		debt.Currency = r.s.data.users[debt.UserID].BaseCurrency
+	}
+	debt.ID = r.s.data.id()
+	debt.CreatedAt = now()
+	r.s.data.debts = append(r.s.data.debts, debt)
+	return debt, nil
+}
+
+func (r memDebts) Update(ctx context.Context, debt models.Debt) (models.Debt, error) {
+	return r.update(debt.UserID, debt.ID, func(stored *models.Debt) {
+		stored.CreditorName = debt.CreditorName
+		stored.Amount = debt.Amount
+		stored.InterestRate = debt.InterestRate
+		stored.MinimumPayment = debt.MinimumPayment
+		stored.DueDate = debt.DueDate
+		stored.Status = debt.Status
+	})
+}
+
+func (r memDebts) ApplyPayment(ctx context.Context, userID, id int, amount money.Amount) (models.Debt, error) {
+	return r.update(userID, id, func(debt *models.Debt) {
+		debt.Amount -= amount
+		if debt.Amount == 0 {
+			debt.Status = "paid_off"
+		}
+	})
+}
+
+func (r memDebts) ReversePayment(ctx context.Context, userID, id int, amount money.Amount) (models.Debt, error) {
+	return r.update(userID, id, func(debt *models.Debt) {
+		debt.Amount += amount
+		debt.Status = "active"
+	})
+}
+
+func (r memDebts) Delete(ctx context.Context, userID, id int) (models.Debt, error) {
+	defer r.s.lock()()
+	i := r.index(userID, id)
+	if i < 0 {
+		return models.Debt{}, ErrNotFound
+	}
+	debt := r.s.data.debts[i]
+	r.s.data.debts = slices.Delete(r.s.data.debts, i, i+1)
+
+	// Mirror the cascades of the tables referencing debts
+	r.s.data.payments = filter(r.s.data.payments, func(p models.Payment) bool { return p.DebtID != id })
+	r.s.data.scheduledPayments = filter(r.s.data.scheduledPayments, func(sp models.ScheduledPayment) bool { return sp.DebtID != id })
+	return debt, nil
+}
+
+// index returns the position of one of a user's debts, or -1
+func (r memDebts) index(userID, id int) int {
+	return slices.IndexFunc(r.s.data.debts, func(d models.Debt) bool { return d.ID == id && d.UserID == userID })
+}
+
+// update applies change to one of a user's debts and returns the result
+func (r memDebts) update(userID, id int, change func(*models.Debt)) (models.Debt, error) {
+	defer r.s.lock()()
+	i := r.index(userID, id)
+	if i < 0 {
+		return models.Debt{}, ErrNotFound
+	}
+	change(&r.s.data.debts[i])
+	return r.s.data.debts[i], nil
+}
+
+func (r memDebts) ActiveTotals(ctx context.Context, userID int) (Totals, error) {
+	defer r.s.lock()()
+	totals := Totals{ByCurrency: map[string]money.Amount{}}
+	for _, debt := range r.s.data.debts {
+		if debt.UserID == userID && debt.Status == "active" {
+			totals.Count++
+			totals.ByCurrency[debt.Currency] += debt.Amount
+		}
+	}
+	return totals, nil
+}
+
+type memIncomeSources struct{ s *MemoryStore }
+
+func (r memIncomeSources) ListByUser(ctx context.Context, userID int) ([]models.IncomeSource, error) {
+	defer r.s.lock()()
+	return filter(r.s.data.incomeSources, func(i models.IncomeSource) bool { return i.UserID == userID }), nil
+}
+
+func (r memIncomeSources) ListByNextPayDate(ctx context.Context, userID int) ([]models.IncomeSource, error) {
+	sources, err := r.ListByUser(ctx, userID)
+	slices.SortStableFunc(sources, func(a, b models.IncomeSource) int { return cmp.Compare(a.NextPayDate, b.NextPayDate) })
+	return sources, err
+}
+
+func (r memIncomeSources) ByID(ctx context.Context, userID, id int) (models.IncomeSource, error) {
+	defer r.s.lock()()
+	i := r.index(userID, id)
+	if i < 0 {
+		return models.IncomeSource{}, ErrNotFound
+	}
+	return r.s.data.incomeSources[i], nil
+}
+
+func (r memIncomeSources) ByIDForUpdate(ctx context.Context, userID, id int) (models.IncomeSource, error) {
+	return r.ByID(ctx, userID, id)
+}
+
+func (r memIncomeSources) Create(ctx context.Context, source models.IncomeSource) (models.IncomeSource, error) {
+	defer r.s.lock()()
+	if source.Currency == "" {
+		source.Currency = r.s.data.users[source.UserID].BaseCurrency
+	}
+	source.ID = r.s.data.id()
+	source.CreatedAt = now()
+	r.s.data.incomeSources = append(r.s.data.incomeSources, source)
+	return source, nil
+}
+
+func (r memIncomeSources) Update(ctx context.Context, source models.IncomeSource) (models.IncomeSource, error) {
+	return r.update(source.UserID, source.ID, func(stored *models.IncomeSource) {
+		stored.SourceName = source.SourceName
+		stored.Amount = source.Amount
+		stored.Frequency = source.Frequency
+		stored.NextPayDate = source.NextPayDate
+		stored.PayDay = source.PayDay
+		if source.Currency != "" {
+			stored.Currency = source.Currency
+		}
+	})
+}
+
+func (r memIncomeSources) SetNextPayDate(ctx context.Context, userID, id int, nextPayDate string) (models.IncomeSource, error) {
+	return r.update(userID, id, func(source *models.IncomeSource) {
+		source.NextPayDate = nextPayDate
+	})
+}
+
+func (r memIncomeSources) Delete(ctx context.Context, userID, id int) (models.IncomeSource, error) {
+	defer r.s.lock()()
+	i := r.index(userID, id)
+	if i < 0 {
+		return models.IncomeSource{}, ErrNotFound
+	}
+	source := r.s.data.incomeSources[i]
+	r.s.data.incomeSources = slices.Delete(r.s.data.incomeSources, i, i+1)
+	return source, nil
+}
+
+// index returns the position of one of a user's income sources, or -1
+func (r memIncomeSources) index(userID, id int) int {
+	return slices.IndexFunc(r.s.data.incomeSources, func(i models.IncomeSource) bool { return i.ID == id && i.UserID == userID })
+}
+
+// update applies change to one of a user's income sources and returns the result
+func (r memIncomeSources) update(userID, id int, change func(*models.IncomeSource)) (models.IncomeSource, error) {
+	defer r.s.lock()()
+	i := r.index(userID, id)
+	if i < 0 {
+		return models.IncomeSource{}, ErrNotFound
+	}
+	change(&r.s.data.incomeSources[i])
+	return r.s.data.incomeSources[i], nil
+}
+
+func (r memIncomeSources) Totals(ctx context.Context, userID int) (Totals, error) {
+	defer r.s.lock()()
+	totals := Totals{ByCurrency: map[string]money.Amount{}}
+	for _, source := range r.s.data.incomeSources {
+		if source.UserID == userID {
+			totals.Count++
+			totals.ByCurrency[source.Currency] += source.Amount
+		}
+	}
+	return totals, nil
+}
+
+type memPayments struct{ s *MemoryStore }
+
+func (r memPayments) ListByUser(ctx context.Context, userID int) ([]models.Payment, error) {
+	defer r.s.lock()()
+	return filter(r.s.data.payments, func(p models.Payment) bool { return p.UserID == userID }), nil
+}
+
+func (r memPayments) ListByDebt(ctx context.Context, userID, debtID int) ([]models.Payment, error) {
+	defer r.s.lock()()
+	payments := filter(r.s.data.payments, func(p models.Payment) bool { return p.UserID == userID && p.DebtID == debtID })
+	slices.SortFunc(payments, func(a, b models.Payment) int {
+		return cmp.Or(cmp.Compare(b.PaymentDate, a.PaymentDate), cmp.Compare(b.ID, a.ID))
+	})
+	return payments, nil
+}
+
+func (r memPayments) Create(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	defer r.s.lock()()
+	payment.ID = r.s.data.id()
+	r.s.data.payments = append(r.s.data.payments, payment)
+	return payment, nil
+}
+
+func (r memPayments) Delete(ctx context.Context, userID, debtID, id int) (models.Payment, error) {
+	defer r.s.lock()()
+	i := slices.IndexFunc(r.s.data.payments, func(p models.Payment) bool {
+		return p.ID == id && p.DebtID == debtID && p.UserID == userID
+	})
+	if i < 0 {
+		return models.Payment{}, ErrNotFound
+	}
+	payment := r.s.data.payments[i]
+	r.s.data.payments = slices.Delete(r.s.data.payments, i, i+1)
+
+	// Mirror the ON DELETE SET NULL of scheduled_payments.payment_id
+	for i, sp := range r.s.data.scheduledPayments {
+		if sp.PaymentID != nil && *sp.PaymentID == id {
+			r.s.data.scheduledPayments[i].PaymentID = nil
+		}
+	}
+	return payment, nil
+}
+
+type memScheduledPayments struct{ s *MemoryStore }
+
+func (r memScheduledPayments) ListByUser(ctx context.Context, userID int) ([]models.ScheduledPayment, error) {
+	defer r.s.lock()()
+	return filter(r.s.data.scheduledPayments, func(sp models.ScheduledPayment) bool { return sp.UserID == userID }), nil
+}
+
+func (r memScheduledPayments) ListByStatus(ctx context.Context, userID int, status string) ([]models.ScheduledPayment, error) {
+	defer r.s.lock()()
+	scheduled := filter(r.s.data.scheduledPayments, func(sp models.ScheduledPayment) bool {
+		return sp.UserID == userID && (status == "" || sp.Status == status)
+	})
+	slices.SortStableFunc(scheduled, func(a, b models.ScheduledPayment) int { return cmp.Compare(a.ScheduledDate, b.ScheduledDate) })
+	return scheduled, nil
+}
+
+func (r memScheduledPayments) ByIDForUpdate(ctx context.Context, userID, id int) (models.ScheduledPayment, error) {
+	defer r.s.lock()()
+	i := r.index(userID, id)
+	if i < 0 {
+		return models.ScheduledPayment{}, ErrNotFound
+	}
+	return r.s.data.scheduledPayments[i], nil
+}
+
+func (r memScheduledPayments) Create(ctx context.Context, sp models.ScheduledPayment) (models.ScheduledPayment, error) {
+	defer r.s.lock()()
+	sp.ID = r.s.data.id()
+	sp.Status = "pending"
+	sp.PaymentID = nil
+	sp.CreatedAt = now()
+	r.s.data.scheduledPayments = append(r.s.data.scheduledPayments, sp)
+	return sp, nil
+}
+
+func (r memScheduledPayments) DeletePending(ctx context.Context, userID int) error {
+	defer r.s.lock()()
+	r.s.data.scheduledPayments = filter(r.s.data.scheduledPayments, func(sp models.ScheduledPayment) bool {
+		return sp.UserID != userID || sp.Status != "pending"
+	})
+	return nil
+}
+
+func (r memScheduledPayments) Complete(ctx context.Context, userID, id, paymentID int) (models.ScheduledPayment, error) {
+	return r.update(userID, id, func(sp *models.ScheduledPayment) {
+		sp.Status = "completed"
+		sp.PaymentID = &paymentID
+	})
+}
+
+func (r memScheduledPayments) Skip(ctx context.Context, userID, id int) (models.ScheduledPayment, error) {
+	return r.update(userID, id, func(sp *models.ScheduledPayment) {
+		sp.Status = "skipped"
+	})
+}
+
+func (r memScheduledPayments) Reopen(ctx context.Context, userID, paymentID int) error {
+	defer r.s.lock()()
+	for i, sp := range r.s.data.scheduledPayments {
+		if sp.UserID == userID && sp.PaymentID != nil && *sp.PaymentID == paymentID {
+			r.s.data.scheduledPayments[i].Status = "pending"
+			r.s.data.scheduledPayments[i].PaymentID = nil
+		}
+	}
+	return nil
+}
+
+// index returns the position of one of a user's scheduled payments, or -1
+func (r memScheduledPayments) index(userID, id int) int {
+	return slices.IndexFunc(r.s.data.scheduledPayments, func(sp models.ScheduledPayment) bool {
+		return sp.ID == id && sp.UserID == userID
+	})
+}
+
+// update applies change to one of a user's scheduled payments and returns the result
+func (r memScheduledPayments) update(userID, id int, change func(*models.ScheduledPayment)) (models.ScheduledPayment, error) {
+	defer r.s.lock()()
+	i := r.index(userID, id)
+	if i < 0 {
+		return models.ScheduledPayment{}, ErrNotFound
+	}
+	change(&r.s.data.scheduledPayments[i])
+	return r.s.data.scheduledPayments[i], nil
+}
+
+type memExchangeRates struct{ s *MemoryStore }
+
+func (r memExchangeRates) List(ctx context.Context) ([]models.ExchangeRate, error) {
+	defer r.s.lock()()
+	rates := append([]models.ExchangeRate{}, r.s.data.exchangeRates...)
+	slices.SortFunc(rates, func(a, b models.ExchangeRate) int {
+		return cmp.Or(cmp.Compare(a.BaseCurrency, b.BaseCurrency), cmp.Compare(a.QuoteCurrency, b.QuoteCurrency))
+	})
+	return rates, nil
+}
+
+func (r memExchangeRates) ByPairForUpdate(ctx context.Context, base, quote string) (models.ExchangeRate, error) {
+	defer r.s.lock()()
+	i := r.index(base, quote)
+	if i < 0 {
+		return models.ExchangeRate{}, ErrNotFound
+	}
+	return r.s.data.exchangeRates[i], nil
+}
+
+func (r memExchangeRates) Save(ctx context.Context, base, quote string, rate money.ExchangeRate, updatedBy int) (models.ExchangeRate, error) {
+	defer r.s.lock()()
+	saved := models.ExchangeRate{BaseCurrency: base, QuoteCurrency: quote, Rate: rate, UpdatedAt: now()}
+	if i := r.index(base, quote); i >= 0 {
+		r.s.data.exchangeRates[i] = saved
+	} else {
+		r.s.data.exchangeRates = append(r.s.data.exchangeRates, saved)
+	}
+	return saved, nil
+}
+
+func (r memExchangeRates) Delete(ctx context.Context, base, quote string) (models.ExchangeRate, error) {
+	defer r.s.lock()()
+	i := r.index(base, quote)
+	if i < 0 {
+		return models.ExchangeRate{}, ErrNotFound
+	}
+	rate := r.s.data.exchangeRates[i]
+	r.s.data.exchangeRates = slices.Delete(r.s.data.exchangeRates, i, i+1)
+	return rate, nil
+}
+
+// index returns the position of the rate from base to quote, or -1
+func (r memExchangeRates) index(base, quote string) int {
+	return slices.IndexFunc(r.s.data.exchangeRates, func(rate models.ExchangeRate) bool {
+		return rate.BaseCurrency == base && rate.QuoteCurrency == quote
+	})
+}
+
+type memTokens struct{ s *MemoryStore }
+
+func (r memTokens) CreateRefreshToken(ctx context.Context, userID int, familyID, tokenHash string, ttl time.Duration) error {
+	defer r.s.lock()()
+	r.s.data.refreshTokens[tokenHash] = memoryRefreshToken{
+		RefreshToken: RefreshToken{ID: r.s.data.id(), UserID: userID, FamilyID: familyID},
+		expiresAt:    time.Now().Add(ttl),
+	}
+	return nil
+}
+
+func (r memTokens) RefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	defer r.s.lock()()
+	token, ok := r.s.data.refreshTokens[tokenHash]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+	token.Expired = !time.Now().Before(token.expiresAt)
+	return token.RefreshToken, nil
+}
+
+func (r memTokens) MarkRefreshTokenUsed(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	for hash, token := range r.s.data.refreshTokens {
+		if token.ID == id {
+			token.Used = true
+			r.s.data.refreshTokens[hash] = token
+		}
+	}
+	return nil
+}
+
+func (r memTokens) RevokeFamily(ctx context.Context, familyID string) error {
+	defer r.s.lock()()
+	for hash, token := range r.s.data.refreshTokens {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+			r.s.data.refreshTokens[hash] = token
+		}
+	}
+	if session, ok := r.s.data.sessions[familyID]; ok {
+		session.revoked = true
+		r.s.data.sessions[familyID] = session
+	}
+	return nil
+}
+
+func (r memTokens) RevokeAllForUser(ctx context.Context, userID int) (int, error) {
+	defer r.s.lock()()
+	for hash, token := range r.s.data.refreshTokens {
+		if token.UserID == userID {
+			token.Revoked = true
+			r.s.data.refreshTokens[hash] = token
+		}
+	}
+	revoked := 0
+	for id, session := range r.s.data.sessions {
+		if session.userID == userID && !session.revoked {
+			session.revoked = true
+			r.s.data.sessions[id] = session
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (r memTokens) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	defer r.s.lock()()
+	session, ok := r.s.data.sessions[sessionID]
+	if !ok || session.userID != userID || session.revoked {
+		return ErrNotFound
+	}
+	session.revoked = true
+	r.s.data.sessions[sessionID] = session
+	for hash, token := range r.s.data.refreshTokens {
+		if token.FamilyID == sessionID {
+			token.Revoked = true
+			r.s.data.refreshTokens[hash] = token
+		}
+	}
+	return nil
+}
+
+func (r memTokens) TouchSession(ctx context.Context, sessionID string, userID int, userAgent, ipAddress string) error {
+	defer r.s.lock()()
+	session, ok := r.s.data.sessions[sessionID]
+	if !ok {
+		session = memorySession{userID: userID, createdAt: time.Now()}
+	}
+	session.userAgent = userAgent
+	session.ipAddress = ipAddress
+	session.lastSeenAt = time.Now()
+	r.s.data.sessions[sessionID] = session
+	return nil
+}
+
+func (r memTokens) ListSessions(ctx context.Context, userID int, idle time.Duration) ([]models.Session, error) {
+	defer r.s.lock()()
+	var ids []string
+	for id, session := range r.s.data.sessions {
+		if session.userID == userID && !session.revoked && time.Since(session.lastSeenAt) < idle {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		return r.s.data.sessions[b].lastSeenAt.Compare(r.s.data.sessions[a].lastSeenAt)
+	})
+
+	sessions := []models.Session{}
+	for _, id := range ids {
+		session := r.s.data.sessions[id]
+		sessions = append(sessions, models.Session{
+			ID:         id,
+			UserAgent:  session.userAgent,
+			IPAddress:  session.ipAddress,
+			CreatedAt:  session.createdAt.UTC().Format(time.RFC3339),
+			LastSeenAt: session.lastSeenAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return sessions, nil
+}
+
+func (r memTokens) ReplaceEmailVerificationToken(ctx context.Context, userID int, tokenHash string, ttl time.Duration) error {
+	defer r.s.lock()()
+	replaceMemoryToken(r.s.data.verificationTokens, userID, tokenHash, ttl)
+	return nil
+}
+
+func (r memTokens) UseEmailVerificationToken(ctx context.Context, tokenHash string) (int, error) {
+	defer r.s.lock()()
+	return useMemoryToken(r.s.data.verificationTokens, tokenHash)
+}
+
+func (r memTokens) ReplacePasswordResetToken(ctx context.Context, userID int, tokenHash string, ttl time.Duration) error {
+	defer r.s.lock()()
+	replaceMemoryToken(r.s.data.resetTokens, userID, tokenHash, ttl)
+	return nil
+}
+
+func (r memTokens) UsePasswordResetToken(ctx context.Context, tokenHash string) (int, error) {
+	defer r.s.lock()()
+	return useMemoryToken(r.s.data.resetTokens, tokenHash)
+}
+
+// replaceMemoryToken retires a user's unused tokens and stores a new one
+func replaceMemoryToken(tokens map[string]memoryOneTimeToken, userID int, tokenHash string, ttl time.Duration) {
+	for hash, token := range tokens {
+		if token.userID == userID {
+			token.used = true
+			tokens[hash] = token
+		}
+	}
+	tokens[tokenHash] = memoryOneTimeToken{userID: userID, expiresAt: time.Now().Add(ttl)}
+}
+
+// useMemoryToken consumes an unused, unexpired token and returns its user's ID
+func useMemoryToken(tokens map[string]memoryOneTimeToken, tokenHash string) (int, error) {
+	token, ok := tokens[tokenHash]
+	if !ok || token.used || !time.Now().Before(token.expiresAt) {
+		return 0, ErrNotFound
+	}
+	token.used = true
+	tokens[tokenHash] = token
+	return token.userID, nil
+}
+
+type memMFA struct{ s *MemoryStore }
+
+func (r memMFA) StateForUpdate(ctx context.Context, userID int) (MFAState, error) {
+	defer r.s.lock()()
+	user, ok := r.s.data.users[userID]
+	if !ok {
+		return MFAState{}, ErrNotFound
+	}
+	mfa := r.s.data.mfa[userID]
+	return MFAState{Secret: mfa.secret, Enabled: user.MFAEnabled, LastStep: mfa.lastStep}, nil
+}
+
+func (r memMFA) StartEnrollment(ctx context.Context, userID int, secret string) error {
+	defer r.s.lock()()
+	if user, ok := r.s.data.users[userID]; ok && !user.MFAEnabled {
+		r.s.data.mfa[userID] = memoryMFA{secret: secret}
+	}
+	return nil
+}
+
+func (r memMFA) Enable(ctx context.Context, userID int, step int64) error {
+	_, err := memUsers(r).update(userID, func(user *models.User) {
+		user.MFAEnabled = true
+	})
+	if err != nil {
+		return err
+	}
+	return r.SetLastStep(ctx, userID, step)
+}
+
+func (r memMFA) Disable(ctx context.Context, userID int) error {
+	_, err := memUsers(r).update(userID, func(user *models.User) {
+		user.MFAEnabled = false
+	})
+	if err != nil {
+		return err
+	}
+
+	defer r.s.lock()()
+	delete(r.s.data.mfa, userID)
+	r.s.data.recoveryCodes = filter(r.s.data.recoveryCodes, func(code memoryRecoveryCode) bool { return code.userID != userID })
+	return nil
+}
+
+func (r memMFA) SetLastStep(ctx context.Context, userID int, step int64) error {
+	defer r.s.lock()()
+	mfa := r.s.data.mfa[userID]
+	mfa.lastStep = step
+	r.s.data.mfa[userID] = mfa
+	return nil
+}
+
+func (r memMFA) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	defer r.s.lock()()
+	r.s.data.recoveryCodes = filter(r.s.data.recoveryCodes, func(code memoryRecoveryCode) bool { return code.userID != userID })
+	for _, codeHash := range codeHashes {
+		r.s.data.recoveryCodes = append(r.s.data.recoveryCodes, memoryRecoveryCode{userID: userID, codeHash: codeHash})
+	}
+	return nil
+}
+
+func (r memMFA) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	defer r.s.lock()()
+	for i, code := range r.s.data.recoveryCodes {
+		if code.userID == userID && code.codeHash == codeHash && !code.used {
+			r.s.data.recoveryCodes[i].used = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type memIdentities struct{ s *MemoryStore }
+
+func (r memIdentities) ListByUser(ctx context.Context, userID int) ([]models.Identity, error) {
+	defer r.s.lock()()
+	identities := []models.Identity{}
+	for _, identity := range r.s.data.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity.Identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r memIdentities) Owner(ctx context.Context, provider, subject string) (int, error) {
+	defer r.s.lock()()
+	for _, identity := range r.s.data.identities {
+		if identity.Provider == provider && identity.subject == subject {
+			return identity.UserID, nil
+		}
+	}
+	return 0, ErrNotFound
+}
+
+func (r memIdentities) Link(ctx context.Context, userID int, provider, subject, email string) (models.Identity, error) {
+	defer r.s.lock()()
+	for _, identity := range r.s.data.identities {
+		if identity.Provider == provider && (identity.subject == subject || identity.UserID == userID) {
+			return models.Identity{}, ErrAlreadyLinked
+		}
+	}
+
+	identity := memoryIdentity{
+		Identity: models.Identity{
+			ID:        r.s.data.id(),
+			UserID:    userID,
+			Provider:  provider,
+			Email:     email,
+			CreatedAt: now(),
+		},
+		subject: subject,
+	}
+	r.s.data.identities = append(r.s.data.identities, identity)
+	return identity.Identity, nil
+}
+
+func (r memIdentities) RecordLogin(ctx context.Context, provider, subject, email string) (int, error) {
+	defer r.s.lock()()
+	for i, identity := range r.s.data.identities {
+		if identity.Provider == provider && identity.subject == subject {
+			loggedIn := now()
+			identity.Email = email
+			identity.LastLoginAt = &loggedIn
+			r.s.data.identities[i] = identity
+			return identity.UserID, nil
+		}
+	}
+	return 0, ErrNotFound
+}
+
+func (r memIdentities) Unlink(ctx context.Context, id, userID int) error {
+	defer r.s.lock()()
+	for i, identity := range r.s.data.identities {
+		if identity.ID == id && identity.UserID == userID {
+			r.s.data.identities = slices.Delete(r.s.data.identities, i, i+1)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+type memLoginStates struct{ s *MemoryStore }
+
+func (r memLoginStates) Create(ctx context.Context, state LoginState, ttl time.Duration) error {
+	defer r.s.lock()()
+	maps.DeleteFunc(r.s.data.loginStates, func(_ string, state memoryLoginState) bool {
+		return !time.Now().Before(state.expiresAt)
+	})
+	r.s.data.loginStates[state.StateHash] = memoryLoginState{LoginState: state, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (r memLoginStates) Take(ctx context.Context, stateHash, provider string) (LoginState, error) {
+	defer r.s.lock()()
+	state, ok := r.s.data.loginStates[stateHash]
+	if !ok || state.Provider != provider {
+		return LoginState{}, ErrNotFound
+	}
+	delete(r.s.data.loginStates, stateHash)
+	state.Expired = !time.Now().Before(state.expiresAt)
+	return state.LoginState, nil
+}
+
+type memAuditEvents struct{ s *MemoryStore }
+
+func (r memAuditEvents) Record(ctx context.Context, event audit.Event) error {
+	before, err := marshalState(event.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalState(event.After)
+	if err != nil {
+		return err
+	}
+
+	defer r.s.lock()()
+	r.s.data.auditEvents = append(r.s.data.auditEvents, memoryAuditEvent{
+		Event:     event,
+		id:        int64(r.s.data.id()),
+		before:    before,
+		after:     after,
+		createdAt: time.Now(),
+	})
+	return nil
+}
+
+func (r memAuditEvents) List(ctx context.Context, filter AuditFilter, limit int) ([]models.AuditEvent, error) {
+	defer r.s.lock()()
+	events := []models.AuditEvent{}
+	for _, event := range slices.Backward(r.s.data.auditEvents) {
+		if len(events) == limit {
+			break
+		}
+		if event.UserID != filter.UserID ||
+			(filter.BeforeID != 0 && event.id >= filter.BeforeID) ||
+			(filter.Action != "" && event.Action != filter.Action) ||
+			(filter.EntityType != "" && event.EntityType != filter.EntityType) ||
+			(filter.EntityID != "" && event.EntityID != filter.EntityID) ||
+			(!filter.From.IsZero() && event.createdAt.Before(filter.From)) ||
+			(!filter.To.IsZero() && !event.createdAt.Before(filter.To)) {
+			continue
+		}
+
+		listed := models.AuditEvent{
+			ID:         event.id,
+			Action:     event.Action,
+			EntityType: event.EntityType,
+			EntityID:   event.EntityID,
+			Before:     event.before,
+			After:      event.after,
+			RequestID:  event.RequestID,
+			CreatedAt:  event.createdAt.UTC().Format(time.RFC3339),
+		}
+		if event.ActorID != 0 {
+			actorID := event.ActorID
+			listed.ActorID = &actorID
+		}
+		if event.ActorID == filter.UserID {
+			listed.IPAddress = event.IPAddress
+		}
+		events = append(events, listed)
+	}
+	return events, nil
+}
+
+// marshalState encodes an audited state as JSON, keeping nil as null
+func marshalState(state interface{}) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	return json.Marshal(state)
+}
+
+type memStats struct{ s *MemoryStore }
+
+func (r memStats) Get(ctx context.Context) (Stats, error) {
+	defer r.s.lock()()
+	d := r.s.data
+	stats := Stats{UsersByRole: map[string]int{}, ActiveDebtByCurrency: map[string]money.Amount{}}
+	for _, user := range d.users {
+		stats.Users++
+		stats.UsersByRole[user.Role]++
+		if user.EmailVerified {
+			stats.VerifiedUsers++
+		}
+		if user.MFAEnabled {
+			stats.TwoFactorUsers++
+		}
+		if user.DisabledAt != nil {
+			stats.DisabledUsers++
+		}
+		if createdAt, err := time.Parse(time.RFC3339, user.CreatedAt); err == nil && time.Since(createdAt) < 30*24*time.Hour {
+			stats.NewUsers++
+		}
+	}
+	for _, session := range d.sessions {
+		if !session.revoked && time.Since(session.lastSeenAt) < 24*time.Hour {
+			stats.ActiveSessions++
+		}
+	}
+	for _, debt := range d.debts {
+		switch debt.Status {
+		case "active":
+			stats.ActiveDebts++
+			stats.ActiveDebtByCurrency[debt.Currency] += debt.Amount
+		case "paid_off":
+			stats.PaidOffDebts++
+		}
+	}
+	stats.IncomeSources = len(d.incomeSources)
+	stats.Payments = len(d.payments)
+	return stats, nil
+}
+
+// filter returns the items keep accepts, as a new non-nil slice
+func filter[T any](items []T, keep func(T) bool) []T {
+	kept := []T{}
+	for _, item := range items {
+		if keep(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,1024 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kevinlucasklein/zero-balance/audit"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/money"
+	"github.com/lib/pq"
+)
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// PostgresStore keeps the models in Postgres
+type PostgresStore struct {
+	// db starts transactions, and is nil for a store inside one
+	db *sql.DB
+	q  DBTX
+}
+
+// NewPostgresStore returns a store running each statement on its own
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db, q: db}
+}
+
+// NewPostgresTxStore returns a store running every statement in tx, for
+// handlers that already have a transaction open
+func NewPostgresTxStore(tx *sql.Tx) *PostgresStore {
+	return &PostgresStore{q: tx}
+}
+
+// InTx implements Store
+func (s *PostgresStore) InTx(ctx context.Context, fn func(Store) error) error {
+	if s.db == nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(NewPostgresTxStore(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Users implements Store
+func (s *PostgresStore) Users() UserRepository { return pgUsers{s.q} }
+
+// Debts implements Store
+func (s *PostgresStore) Debts() DebtRepository { return pgDebts{s.q} }
+
+// IncomeSources implements Store
+func (s *PostgresStore) IncomeSources() IncomeSourceRepository { return pgIncomeSources{s.q} }
+
+// Payments implements Store
+func (s *PostgresStore) Payments() PaymentRepository { return pgPayments{s.q} }
+
+// ScheduledPayments implements Store
+func (s *PostgresStore) ScheduledPayments() ScheduledPaymentRepository {
+	return pgScheduledPayments{s.q}
+}
+
+// ExchangeRates implements Store
+func (s *PostgresStore) ExchangeRates() ExchangeRateRepository { return pgExchangeRates{s.q} }
+
+// Tokens implements Store
+func (s *PostgresStore) Tokens() TokenRepository { return pgTokens{s.q} }
+
+// MFA implements Store
+func (s *PostgresStore) MFA() MFARepository { return pgMFA{s.q} }
+
+// Identities implements Store
+func (s *PostgresStore) Identities() IdentityRepository { return pgIdentities{s.q} }
+
+// LoginStates implements Store
+func (s *PostgresStore) LoginStates() LoginStateRepository { return pgLoginStates{s.q} }
+
+// AuditEvents implements Store
+func (s *PostgresStore) AuditEvents() AuditRepository { return pgAuditEvents{s.q} }
+
+// Stats implements Store
+func (s *PostgresStore) Stats() StatsRepository { return pgStats{s.q} }
+
+type pgUsers struct{ q DBTX }
+
+func (r pgUsers) Create(ctx context.Context, user models.User) (models.User, error) {
+	created, err := ScanUser(r.q.QueryRowContext(ctx,
+		`INSERT INTO users (name, email, password_hash, email_verified, email_verified_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, CASE WHEN $4 THEN CURRENT_TIMESTAMP END)
+		RETURNING `+UserColumns,
+		user.Name, user.Email, user.PasswordHash, user.EmailVerified,
+	))
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key" {
+		return models.User{}, ErrEmailTaken
+	}
+	return created, err
+}
+
+func (r pgUsers) ByID(ctx context.Context, id int) (models.User, error) {
+	user, err := ScanUser(r.q.QueryRowContext(ctx, "SELECT "+UserColumns+" FROM users WHERE id = $1", id))
+	return user, notFound(err)
+}
+
+func (r pgUsers) ByEmail(ctx context.Context, email string) (models.User, error) {
+	user, err := ScanUser(r.q.QueryRowContext(ctx, "SELECT "+UserColumns+" FROM users WHERE email = $1", email))
+	return user, notFound(err)
+}
+
+func (r pgUsers) ByIDForUpdate(ctx context.Context, id int) (models.User, error) {
+	user, err := ScanUser(r.q.QueryRowContext(ctx, "SELECT "+UserColumns+" FROM users WHERE id = $1 FOR UPDATE", id))
+	return user, notFound(err)
+}
+
+func (r pgUsers) ByEmailForUpdate(ctx context.Context, email string) (models.User, error) {
+	user, err := ScanUser(r.q.QueryRowContext(ctx,
+		"SELECT "+UserColumns+" FROM users WHERE LOWER(email) = LOWER($1) ORDER BY id LIMIT 1 FOR UPDATE",
+		email,
+	))
+	return user, notFound(err)
+}
+
+func (r pgUsers) UpdateProfile(ctx context.Context, id int, name, baseCurrency string) (models.User, error) {
+	user, err := ScanUser(r.q.QueryRowContext(ctx,
+		`UPDATE users SET name = $1, base_currency = COALESCE(NULLIF($2, ''), base_currency)
+		WHERE id = $3
+		RETURNING `+UserColumns,
+		name, baseCurrency, id,
+	))
+	return user, notFound(err)
+}
+
+func (r pgUsers) SetPasswordHash(ctx context.Context, id int, hash string) error {
+	_, err := r.q.ExecContext(ctx,
+		`UPDATE users
+		SET password_hash = $1, password_changed_at = CURRENT_TIMESTAMP, password_reset_required = FALSE
+		WHERE id = $2`,
+		hash, id,
+	)
+	return err
+}
+
+func (r pgUsers) BumpTokenVersion(ctx context.Context, id int) (int, error) {
+	var tokenVersion int
+	err := r.q.QueryRowContext(ctx,
+		"UPDATE users SET token_version = token_version + 1 WHERE id = $1 RETURNING token_version",
+		id,
+	).Scan(&tokenVersion)
+	return tokenVersion, notFound(err)
+}
+
+func (r pgUsers) MarkEmailVerified(ctx context.Context, id int) error {
+	_, err := r.q.ExecContext(ctx,
+		"UPDATE users SET email_verified = TRUE, email_verified_at = CURRENT_TIMESTAMP WHERE id = $1 AND NOT email_verified",
+		id,
+	)
+	return err
+}
+
+func (r pgUsers) Search(ctx context.Context, filter UserFilter, limit, offset int) ([]models.User, int, error) {
+	where := " WHERE TRUE"
+	args := []interface{}{}
+	if filter.Search != "" {
+		args = append(args, "%"+escapeLike(filter.Search)+"%")
+		where += fmt.Sprintf(" AND (name ILIKE $%d OR email ILIKE $%d)", len(args), len(args))
+	}
+	if filter.Role != "" {
+		args = append(args, filter.Role)
+		where += fmt.Sprintf(" AND role = $%d", len(args))
+	}
+	switch filter.Status {
+	case "active":
+		where += " AND disabled_at IS NULL"
+	case "disabled":
+		where += " AND disabled_at IS NOT NULL"
+	}
+
+	var total int
+	if err := r.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + UserColumns + " FROM users" + where +
+		fmt.Sprintf(" ORDER BY id LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	users, err := QueryAll(ctx, r.q, ScanUser, query, append(args, limit, offset)...)
+	return users, total, err
+}
+
+func (r pgUsers) SetDisabled(ctx context.Context, id int, disabled bool) error {
+	_, err := r.q.ExecContext(ctx,
+		"UPDATE users SET disabled_at = CASE WHEN $1 THEN CURRENT_TIMESTAMP END WHERE id = $2",
+		disabled, id,
+	)
+	return err
+}
+
+func (r pgUsers) RequirePasswordReset(ctx context.Context, id int) error {
+	_, err := r.q.ExecContext(ctx, "UPDATE users SET password_reset_required = TRUE WHERE id = $1", id)
+	return err
+}
+
+func (r pgUsers) Delete(ctx context.Context, id int) error {
+	// Every table referencing users cascades, except the audit log
+	_, err := r.q.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+	return err
+}
+
+type pgDebts struct{ q DBTX }
+
+func (r pgDebts) ListByUser(ctx context.Context, userID int) ([]models.Debt, error) {
+	return QueryAll(ctx, r.q, ScanDebt, "SELECT "+DebtColumns+" FROM debts WHERE user_id = $1 ORDER BY id", userID)
+}
+
+func (r pgDebts) ListByStatus(ctx context.Context, userID int, status string) ([]models.Debt, error) {
+	return QueryAll(ctx, r.q, ScanDebt,
+		`SELECT `+DebtColumns+` FROM debts
+		WHERE user_id = $1 AND (status = $2 OR $2 = '')
+		ORDER BY created_at DESC, id DESC`,
+		userID, status,
+	)
+}
+
+func (r pgDebts) ByID(ctx context.Context, userID, id int) (models.Debt, error) {
+	debt, err := ScanDebt(r.q.QueryRowContext(ctx,
+		"SELECT "+DebtColumns+" FROM debts WHERE id = $1 AND user_id = $2",
+		id, userID,
+	))
+	return debt, notFound(err)
+}
+
+func (r pgDebts) ByIDForUpdate(ctx context.Context, userID, id int) (models.Debt, error) {
+	debt, err := ScanDebt(r.q.QueryRowContext(ctx,
+		"SELECT "+DebtColumns+" FROM debts WHERE id = $1 AND user_id = $2 FOR UPDATE",
+		id, userID,
+	))
+	return debt, notFound(err)
+}
+
+func (r pgDebts) LockByUser(ctx context.Context, userID int) error {
+	_, err := r.q.ExecContext(ctx, "SELECT id FROM debts WHERE user_id = $1 FOR UPDATE", userID)
+	return err
+}
+
+func (r pgDebts) Create(ctx context.Context, debt models.Debt) (models.Debt, error) {
+	return ScanDebt(r.q.QueryRowContext(ctx,
+		`INSERT INTO debts (user_id, creditor_name, amount, interest_rate, minimum_payment, due_date, status, currency)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE(NULLIF($8, ''), (SELECT base_currency FROM users WHERE id = $1)))
+		RETURNING `+DebtColumns,
+		debt.UserID, debt.CreditorName, debt.Amount, debt.InterestRate, debt.MinimumPayment, debt.DueDate, debt.Status,
+		debt.Currency,
+	))
+}
+
+func (r pgDebts) Update(ctx context.Context, debt models.Debt) (models.Debt, error) {
+	updated, err := ScanDebt(r.q.QueryRowContext(ctx,
+		`UPDATE debts
+		SET creditor_name = $1, amount = $2, interest_rate = $3, minimum_payment = $4, due_date = $5, status = $6
+		WHERE id = $7 AND user_id = $8
+		RETURNING `+DebtColumns,
+		debt.CreditorName, debt.Amount, debt.InterestRate, debt.MinimumPayment, debt.DueDate, debt.Status,
+		debt.ID, debt.UserID,
+	))
+	return updated, notFound(err)
+}
+
+func (r pgDebts) ApplyPayment(ctx context.Context, userID, id int, amount money.Amount) (models.Debt, error) {
+	debt, err := ScanDebt(r.q.QueryRowContext(ctx,
+		`UPDATE debts
+		SET amount = amount - $1,
+			status = CASE WHEN amount - $1 = 0 THEN 'paid_off' ELSE status END
+		WHERE id = $2 AND user_id = $3
+		RETURNING `+DebtColumns,
+		amount, id, userID,
+	))
+	return debt, notFound(err)
+}
+
+func (r pgDebts) ReversePayment(ctx context.Context, userID, id int, amount money.Amount) (models.Debt, error) {
+	debt, err := ScanDebt(r.q.QueryRowContext(ctx,
+		`UPDATE debts SET amount = amount + $1, status = 'active'
+		WHERE id = $2 AND user_id = $3
+		RETURNING `+DebtColumns,
+		amount, id, userID,
+	))
+	return debt, notFound(err)
+}
+
+func (r pgDebts) Delete(ctx context.Context, userID, id int) (models.Debt, error) {
+	// Payments and scheduled payments cascade
+	debt, err := ScanDebt(r.q.QueryRowContext(ctx,
+		"DELETE FROM debts WHERE id = $1 AND user_id = $2 RETURNING "+DebtColumns,
+		id, userID,
+	))
+	return debt, notFound(err)
+}
+
+func (r pgDebts) ActiveTotals(ctx context.Context, userID int) (Totals, error) {
+	return queryTotals(ctx, r.q,
+		"SELECT currency, COUNT(*), SUM(amount) FROM debts WHERE user_id = $1 AND status = 'active' GROUP BY currency",
+		userID,
+	)
+}
+
+type pgIncomeSources struct{ q DBTX }
+
+func (r pgIncomeSources) ListByUser(ctx context.Context, userID int) ([]models.IncomeSource, error) {
+	return QueryAll(ctx, r.q, ScanIncomeSource,
+		"SELECT "+IncomeSourceColumns+" FROM income_sources WHERE user_id = $1 ORDER BY id", userID)
+}
+
+func (r pgIncomeSources) ListByNextPayDate(ctx context.Context, userID int) ([]models.IncomeSource, error) {
+	return QueryAll(ctx, r.q, ScanIncomeSource,
+		"SELECT "+IncomeSourceColumns+" FROM income_sources WHERE user_id = $1 ORDER BY next_pay_date, id", userID)
+}
+
+func (r pgIncomeSources) ByID(ctx context.Context, userID, id int) (models.IncomeSource, error) {
+	source, err := ScanIncomeSource(r.q.QueryRowContext(ctx,
+		"SELECT "+IncomeSourceColumns+" FROM income_sources WHERE id = $1 AND user_id = $2",
+		id, userID,
+	))
+	return source, notFound(err)
+}
+
+func (r pgIncomeSources) ByIDForUpdate(ctx context.Context, userID, id int) (models.IncomeSource, error) {
+	source, err := ScanIncomeSource(r.q.QueryRowContext(ctx,
+		"SELECT "+IncomeSourceColumns+" FROM income_sources WHERE id = $1 AND user_id = $2 FOR UPDATE",
+		id, userID,
+	))
+	return source, notFound(err)
+}
+
+func (r pgIncomeSources) Create(ctx context.Context, source models.IncomeSource) (models.IncomeSource, error) {
+	return ScanIncomeSource(r.q.QueryRowContext(ctx,
+		`INSERT INTO income_sources (user_id, source_name, amount, frequency, next_pay_date, pay_day, currency)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE(NULLIF($7, ''), (SELECT base_currency FROM users WHERE id = $1)))
+		RETURNING `+IncomeSourceColumns,
+		source.UserID, source.SourceName, source.Amount, source.Frequency, source.NextPayDate, source.PayDay,
+		source.Currency,
+	))
+}
+
+func (r pgIncomeSources) Update(ctx context.Context, source models.IncomeSource) (models.IncomeSource, error) {
+	updated, err := ScanIncomeSource(r.q.QueryRowContext(ctx,
+		`UPDATE income_sources
+		SET source_name = $1, amount = $2, frequency = $3, next_pay_date = $4, pay_day = $5,
+			currency = COALESCE(NULLIF($6, ''), currency)
+		WHERE id = $7 AND user_id = $8
+		RETURNING `+IncomeSourceColumns,
+		source.SourceName, source.Amount, source.Frequency, source.NextPayDate, source.PayDay, source.Currency,
+		source.ID, source.UserID,
+	))
+	return updated, notFound(err)
+}
+
+func (r pgIncomeSources) SetNextPayDate(ctx context.Context, userID, id int, nextPayDate string) (models.IncomeSource, error) {
+	source, err := ScanIncomeSource(r.q.QueryRowContext(ctx,
+		`UPDATE income_sources SET next_pay_date = $1
+		WHERE id = $2 AND user_id = $3
+		RETURNING `+IncomeSourceColumns,
+		nextPayDate, id, userID,
+	))
+	return source, notFound(err)
+}
+
+func (r pgIncomeSources) Delete(ctx context.Context, userID, id int) (models.IncomeSource, error) {
+	source, err := ScanIncomeSource(r.q.QueryRowContext(ctx,
+		"DELETE FROM income_sources WHERE id = $1 AND user_id = $2 RETURNING "+IncomeSourceColumns,
+		id, userID,
+	))
+	return source, notFound(err)
+}
+
+func (r pgIncomeSources) Totals(ctx context.Context, userID int) (Totals, error) {
+	return queryTotals(ctx, r.q,
+		"SELECT currency, COUNT(*), SUM(amount) FROM income_sources WHERE user_id = $1 GROUP BY currency",
+		userID,
+	)
+}
+
+type pgPayments struct{ q DBTX }
+
+func (r pgPayments) ListByUser(ctx context.Context, userID int) ([]models.Payment, error) {
+	return QueryAll(ctx, r.q, ScanPayment, "SELECT "+PaymentColumns+" FROM payments WHERE user_id = $1 ORDER BY id", userID)
+}
+
+func (r pgPayments) ListByDebt(ctx context.Context, userID, debtID int) ([]models.Payment, error) {
+	return QueryAll(ctx, r.q, ScanPayment,
+		"SELECT "+PaymentColumns+" FROM payments WHERE debt_id = $1 AND user_id = $2 ORDER BY payment_date DESC, id DESC",
+		debtID, userID,
+	)
+}
+
+func (r pgPayments) Create(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	return ScanPayment(r.q.QueryRowContext(ctx,
+		`INSERT INTO payments (user_id, debt_id, amount, currency, payment_date, method)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+PaymentColumns,
+		payment.UserID, payment.DebtID, payment.Amount, payment.Currency, payment.PaymentDate, payment.Method,
+	))
+}
+
+func (r pgPayments) Delete(ctx context.Context, userID, debtID, id int) (models.Payment, error) {
+	payment, err := ScanPayment(r.q.QueryRowContext(ctx,
+		"DELETE FROM payments WHERE id = $1 AND debt_id = $2 AND user_id = $3 RETURNING "+PaymentColumns,
+		id, debtID, userID,
+	))
+	return payment, notFound(err)
+}
+
+type pgScheduledPayments struct{ q DBTX }
+
+func (r pgScheduledPayments) ListByUser(ctx context.Context, userID int) ([]models.ScheduledPayment, error) {
+	return QueryAll(ctx, r.q, ScanScheduledPayment,
+		"SELECT "+ScheduledPaymentColumns+" FROM scheduled_payments WHERE user_id = $1 ORDER BY id", userID)
+}
+
+func (r pgScheduledPayments) ListByStatus(ctx context.Context, userID int, status string) ([]models.ScheduledPayment, error) {
+	return QueryAll(ctx, r.q, ScanScheduledPayment,
+		`SELECT `+ScheduledPaymentColumns+` FROM scheduled_payments
+		WHERE user_id = $1 AND (status = $2 OR $2 = '')
+		ORDER BY scheduled_date, id`,
+		userID, status,
+	)
+}
+
+func (r pgScheduledPayments) ByIDForUpdate(ctx context.Context, userID, id int) (models.ScheduledPayment, error) {
+	sp, err := ScanScheduledPayment(r.q.QueryRowContext(ctx,
+		"SELECT "+ScheduledPaymentColumns+" FROM scheduled_payments WHERE id = $1 AND user_id = $2 FOR UPDATE",
+		id, userID,
+	))
+	return sp, notFound(err)
+}
+
+func (r pgScheduledPayments) Create(ctx context.Context, sp models.ScheduledPayment) (models.ScheduledPayment, error) {
+	return ScanScheduledPayment(r.q.QueryRowContext(ctx,
+		`INSERT INTO scheduled_payments (user_id, debt_id, recommended_amount, currency, scheduled_date, status)
+		VALUES ($1, $2, $3, $4, $5, 'pending')
+		RETURNING `+ScheduledPaymentColumns,
+		sp.UserID, sp.DebtID, sp.RecommendedAmount, sp.Currency, sp.ScheduledDate,
+	))
+}
+
+func (r pgScheduledPayments) DeletePending(ctx context.Context, userID int) error {
+	_, err := r.q.ExecContext(ctx, "DELETE FROM scheduled_payments WHERE user_id = $1 AND status = 'pending'", userID)
+	return err
+}
+
+func (r pgScheduledPayments) Complete(ctx context.Context, userID, id, paymentID int) (models.ScheduledPayment, error) {
+	sp, err := ScanScheduledPayment(r.q.QueryRowContext(ctx,
+		`UPDATE scheduled_payments SET status = 'completed', payment_id = $1
+		WHERE id = $2 AND user_id = $3
+		RETURNING `+ScheduledPaymentColumns,
+		paymentID, id, userID,
+	))
+	return sp, notFound(err)
+}
+
+func (r pgScheduledPayments) Skip(ctx context.Context, userID, id int) (models.ScheduledPayment, error) {
+	sp, err := ScanScheduledPayment(r.q.QueryRowContext(ctx,
+		`UPDATE scheduled_payments SET status = 'skipped'
+		WHERE id = $1 AND user_id = $2
+		RETURNING `+ScheduledPaymentColumns,
+		id, userID,
+	))
+	return sp, notFound(err)
+}
+
+func (r pgScheduledPayments) Reopen(ctx context.Context, userID, paymentID int) error {
+	_, err := r.q.ExecContext(ctx,
+		"UPDATE scheduled_payments SET status = 'pending', payment_id = NULL WHERE payment_id = $1 AND user_id = $2",
+		paymentID, userID,
+	)
+	return err
+}
+
+type pgExchangeRates struct{ q DBTX }
+
+func (r pgExchangeRates) List(ctx context.Context) ([]models.ExchangeRate, error) {
+	return QueryAll(ctx, r.q, ScanExchangeRate,
+		"SELECT "+ExchangeRateColumns+" FROM exchange_rates ORDER BY base_currency, quote_currency")
+}
+
+func (r pgExchangeRates) ByPairForUpdate(ctx context.Context, base, quote string) (models.ExchangeRate, error) {
+	rate, err := ScanExchangeRate(r.q.QueryRowContext(ctx,
+		"SELECT "+ExchangeRateColumns+" FROM exchange_rates WHERE base_currency = $1 AND quote_currency = $2 FOR UPDATE",
+		base, quote,
+	))
+	return rate, notFound(err)
+}
+
+func (r pgExchangeRates) Save(ctx context.Context, base, quote string, rate money.ExchangeRate, updatedBy int) (models.ExchangeRate, error) {
+	return ScanExchangeRate(r.q.QueryRowContext(ctx,
+		`INSERT INTO exchange_rates (base_currency, quote_currency, rate, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (base_currency, quote_currency)
+		DO UPDATE SET rate = EXCLUDED.rate, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+		RETURNING `+ExchangeRateColumns,
+		base, quote, rate, updatedBy,
+	))
+}
+
+func (r pgExchangeRates) Delete(ctx context.Context, base, quote string) (models.ExchangeRate, error) {
+	rate, err := ScanExchangeRate(r.q.QueryRowContext(ctx,
+		`DELETE FROM exchange_rates WHERE base_currency = $1 AND quote_currency = $2
+		RETURNING `+ExchangeRateColumns,
+		base, quote,
+	))
+	return rate, notFound(err)
+}
+
+type pgTokens struct{ q DBTX }
+
+func (r pgTokens) CreateRefreshToken(ctx context.Context, userID int, familyID, tokenHash string, ttl time.Duration) error {
+	_, err := r.q.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(secs => $4))`,
+		userID, familyID, tokenHash, int(ttl.Seconds()),
+	)
+	return err
+}
+
+func (r pgTokens) RefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	var token RefreshToken
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id, user_id, family_id, used_at IS NOT NULL, revoked_at IS NOT NULL, expires_at <= CURRENT_TIMESTAMP
+		FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`,
+		tokenHash,
+	).Scan(&token.ID, &token.UserID, &token.FamilyID, &token.Used, &token.Revoked, &token.Expired)
+	return token, notFound(err)
+}
+
+func (r pgTokens) MarkRefreshTokenUsed(ctx context.Context, id int) error {
+	_, err := r.q.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1", id)
+	return err
+}
+
+func (r pgTokens) RevokeFamily(ctx context.Context, familyID string) error {
+	_, err := r.q.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL",
+		familyID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.q.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL",
+		familyID,
+	)
+	return err
+}
+
+func (r pgTokens) RevokeAllForUser(ctx context.Context, userID int) (int, error) {
+	_, err := r.q.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.q.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	revoked, err := result.RowsAffected()
+	return int(revoked), err
+}
+
+func (r pgTokens) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	result, err := r.q.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		sessionID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return ErrNotFound
+	}
+
+	_, err = r.q.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL",
+		sessionID,
+	)
+	return err
+}
+
+func (r pgTokens) TouchSession(ctx context.Context, sessionID string, userID int, userAgent, ipAddress string) error {
+	_, err := r.q.ExecContext(ctx,
+		`INSERT INTO sessions (id, user_id, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET
+			user_agent = EXCLUDED.user_agent,
+			ip_address = EXCLUDED.ip_address,
+			last_seen_at = CURRENT_TIMESTAMP`,
+		sessionID, userID, userAgent, ipAddress,
+	)
+	return err
+}
+
+func (r pgTokens) ListSessions(ctx context.Context, userID int, idle time.Duration) ([]models.Session, error) {
+	return QueryAll(ctx, r.q, scanSession,
+		`SELECT id, user_agent, ip_address, created_at, last_seen_at FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND last_seen_at > CURRENT_TIMESTAMP - make_interval(secs => $2)
+		ORDER BY last_seen_at DESC`,
+		userID, int(idle.Seconds()),
+	)
+}
+
+// scanSession scans a row of ListSessions
+func scanSession(row RowScanner) (models.Session, error) {
+	var session models.Session
+	var createdAt, lastSeenAt time.Time
+	if err := row.Scan(&session.ID, &session.UserAgent, &session.IPAddress, &createdAt, &lastSeenAt); err != nil {
+		return models.Session{}, err
+	}
+	session.CreatedAt = createdAt.Format(time.RFC3339)
+	session.LastSeenAt = lastSeenAt.Format(time.RFC3339)
+	return session, nil
+}
+
+func (r pgTokens) ReplaceEmailVerificationToken(ctx context.Context, userID int, tokenHash string, ttl time.Duration) error {
+	return replaceOneTimeToken(ctx, r.q, "email_verification_tokens", userID, tokenHash, ttl)
+}
+
+func (r pgTokens) UseEmailVerificationToken(ctx context.Context, tokenHash string) (int, error) {
+	return useOneTimeToken(ctx, r.q, "email_verification_tokens", tokenHash)
+}
+
+func (r pgTokens) ReplacePasswordResetToken(ctx context.Context, userID int, tokenHash string, ttl time.Duration) error {
+	return replaceOneTimeToken(ctx, r.q, "password_reset_tokens", userID, tokenHash, ttl)
+}
+
+func (r pgTokens) UsePasswordResetToken(ctx context.Context, tokenHash string) (int, error) {
+	return useOneTimeToken(ctx, r.q, "password_reset_tokens", tokenHash)
+}
+
+// replaceOneTimeToken retires a user's unused tokens in table and stores a
+// new one. Table names are constants of this package, never user input.
+func replaceOneTimeToken(ctx context.Context, q DBTX, table string, userID int, tokenHash string, ttl time.Duration) error {
+	_, err := q.ExecContext(ctx,
+		"UPDATE "+table+" SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx,
+		"INSERT INTO "+table+" (user_id, token_hash, expires_at) VALUES ($1, $2, CURRENT_TIMESTAMP + make_interval(secs => $3))",
+		userID, tokenHash, int(ttl.Seconds()),
+	)
+	return err
+}
+
+// useOneTimeToken consumes a token in table in one statement, so it cannot be
+// used twice, and returns its user's ID
+func useOneTimeToken(ctx context.Context, q DBTX, table, tokenHash string) (int, error) {
+	var userID int
+	err := q.QueryRowContext(ctx,
+		"UPDATE "+table+" SET used_at = CURRENT_TIMESTAMP "+
+			"WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP RETURNING user_id",
+		tokenHash,
+	).Scan(&userID)
+	return userID, notFound(err)
+}
+
+type pgMFA struct{ q DBTX }
+
+func (r pgMFA) StateForUpdate(ctx context.Context, userID int) (MFAState, error) {
+	var state MFAState
+	err := r.q.QueryRowContext(ctx,
+		"SELECT COALESCE(totp_secret, ''), totp_enabled, COALESCE(totp_last_step, 0) FROM users WHERE id = $1 FOR UPDATE",
+		userID,
+	).Scan(&state.Secret, &state.Enabled, &state.LastStep)
+	return state, notFound(err)
+}
+
+func (r pgMFA) StartEnrollment(ctx context.Context, userID int, secret string) error {
+	_, err := r.q.ExecContext(ctx,
+		"UPDATE users SET totp_secret = $1, totp_last_step = NULL WHERE id = $2 AND NOT totp_enabled",
+		secret, userID,
+	)
+	return err
+}
+
+func (r pgMFA) Enable(ctx context.Context, userID int, step int64) error {
+	_, err := r.q.ExecContext(ctx,
+		"UPDATE users SET totp_enabled = TRUE, totp_last_step = $1 WHERE id = $2",
+		step, userID,
+	)
+	return err
+}
+
+func (r pgMFA) Disable(ctx context.Context, userID int) error {
+	_, err := r.q.ExecContext(ctx,
+		"UPDATE users SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = NULL WHERE id = $1",
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.q.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID)
+	return err
+}
+
+func (r pgMFA) SetLastStep(ctx context.Context, userID int, step int64) error {
+	_, err := r.q.ExecContext(ctx, "UPDATE users SET totp_last_step = $1 WHERE id = $2", step, userID)
+	return err
+}
+
+func (r pgMFA) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	if _, err := r.q.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err := r.q.ExecContext(ctx,
+			"INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID, codeHash,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r pgMFA) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	result, err := r.q.ExecContext(ctx,
+		"UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+	used, err := result.RowsAffected()
+	return used == 1, err
+}
+
+type pgIdentities struct{ q DBTX }
+
+func (r pgIdentities) ListByUser(ctx context.Context, userID int) ([]models.Identity, error) {
+	return QueryAll(ctx, r.q, ScanIdentity,
+		"SELECT "+IdentityColumns+" FROM user_identities WHERE user_id = $1 ORDER BY id", userID)
+}
+
+func (r pgIdentities) Owner(ctx context.Context, provider, subject string) (int, error) {
+	var userID int
+	err := r.q.QueryRowContext(ctx,
+		"SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2",
+		provider, subject,
+	).Scan(&userID)
+	return userID, notFound(err)
+}
+
+func (r pgIdentities) Link(ctx context.Context, userID int, provider, subject, email string) (models.Identity, error) {
+	// Both the (provider, subject) and (user_id, provider) constraints skip the insert
+	identity, err := ScanIdentity(r.q.QueryRowContext(ctx,
+		`INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+		RETURNING `+IdentityColumns,
+		userID, provider, subject, email,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Identity{}, ErrAlreadyLinked
+	}
+	return identity, err
+}
+
+func (r pgIdentities) RecordLogin(ctx context.Context, provider, subject, email string) (int, error) {
+	var userID int
+	err := r.q.QueryRowContext(ctx,
+		`UPDATE user_identities SET last_login_at = CURRENT_TIMESTAMP, email = $3
+		WHERE provider = $1 AND subject = $2
+		RETURNING user_id`,
+		provider, subject, email,
+	).Scan(&userID)
+	return userID, notFound(err)
+}
+
+func (r pgIdentities) Unlink(ctx context.Context, id, userID int) error {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM user_identities WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type pgLoginStates struct{ q DBTX }
+
+func (r pgLoginStates) Create(ctx context.Context, state LoginState, ttl time.Duration) error {
+	if _, err := r.q.ExecContext(ctx, "DELETE FROM oidc_login_states WHERE expires_at <= CURRENT_TIMESTAMP"); err != nil {
+		return err
+	}
+
+	_, err := r.q.ExecContext(ctx,
+		`INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, link_user_id, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), CURRENT_TIMESTAMP + make_interval(secs => $6))`,
+		state.StateHash, state.Provider, state.Nonce, state.CodeVerifier, state.LinkUserID, int(ttl.Seconds()),
+	)
+	return err
+}
+
+func (r pgLoginStates) Take(ctx context.Context, stateHash, provider string) (LoginState, error) {
+	state := LoginState{StateHash: stateHash, Provider: provider}
+	var linkUserID sql.NullInt64
+	err := r.q.QueryRowContext(ctx,
+		`DELETE FROM oidc_login_states WHERE state_hash = $1 AND provider = $2
+		RETURNING nonce, code_verifier, link_user_id, expires_at <= CURRENT_TIMESTAMP`,
+		stateHash, provider,
+	).Scan(&state.Nonce, &state.CodeVerifier, &linkUserID, &state.Expired)
+	state.LinkUserID = int(linkUserID.Int64)
+	return state, notFound(err)
+}
+
+type pgAuditEvents struct{ q DBTX }
+
+func (r pgAuditEvents) Record(ctx context.Context, event audit.Event) error {
+	return audit.Record(ctx, r.q, event)
+}
+
+// auditEventColumns selects an AuditEvent for the user in $1. The IP address
+// of staff acting on the account is not the user's to see.
+const auditEventColumns = "id, actor_id, action, entity_type, entity_id, before, after, " +
+	"CASE WHEN actor_id = $1 THEN ip_address ELSE '' END, request_id, created_at"
+
+func (r pgAuditEvents) List(ctx context.Context, filter AuditFilter, limit int) ([]models.AuditEvent, error) {
+	where := " WHERE user_id = $1"
+	args := []interface{}{filter.UserID}
+	if filter.BeforeID != 0 {
+		args = append(args, filter.BeforeID)
+		where += fmt.Sprintf(" AND id < $%d", len(args))
+	}
+	for _, match := range []struct{ column, value string }{
+		{"action", filter.Action},
+		{"entity_type", filter.EntityType},
+		{"entity_id", filter.EntityID},
+	} {
+		if match.value != "" {
+			args = append(args, match.value)
+			where += fmt.Sprintf(" AND %s = $%d", match.column, len(args))
+		}
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		where += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		where += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+
+	query := "SELECT " + auditEventColumns + " FROM audit_events" + where +
+		fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args)+1)
+	return QueryAll(ctx, r.q, scanAuditEvent, query, append(args, limit)...)
+}
+
+// scanAuditEvent scans a row selected with auditEventColumns into an AuditEvent
+func scanAuditEvent(row RowScanner) (models.AuditEvent, error) {
+	var event models.AuditEvent
+	var actorID sql.NullInt64
+	var before, after []byte
+	var createdAt time.Time
+	err := row.Scan(
+		&event.ID, &actorID, &event.Action, &event.EntityType, &event.EntityID,
+		&before, &after, &event.IPAddress, &event.RequestID, &createdAt,
+	)
+	if err != nil {
+		return models.AuditEvent{}, err
+	}
+	if actorID.Valid {
+		id := int(actorID.Int64)
+		event.ActorID = &id
+	}
+	event.Before = before
+	event.After = after
+	event.CreatedAt = createdAt.Format(time.RFC3339)
+	return event, nil
+}
+
+type pgStats struct{ q DBTX }
+
+func (r pgStats) Get(ctx context.Context) (Stats, error) {
+	var stats Stats
+	err := r.q.QueryRowContext(ctx,
+		`SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE email_verified),
+			COUNT(*) FILTER (WHERE totp_enabled),
+			COUNT(*) FILTER (WHERE disabled_at IS NOT NULL),
+			COUNT(*) FILTER (WHERE created_at > CURRENT_TIMESTAMP - INTERVAL '30 days')
+		FROM users`,
+	).Scan(&stats.Users, &stats.VerifiedUsers, &stats.TwoFactorUsers, &stats.DisabledUsers, &stats.NewUsers)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats.UsersByRole, err = countBy(ctx, r.q, "SELECT role, COUNT(*) FROM users GROUP BY role")
+	if err != nil {
+		return Stats{}, err
+	}
+
+	err = r.q.QueryRowContext(ctx,
+		`SELECT
+			(SELECT COUNT(*) FROM debts WHERE status = 'paid_off'),
+			(SELECT COUNT(*) FROM income_sources),
+			(SELECT COUNT(*) FROM payments),
+			(SELECT COUNT(*) FROM sessions WHERE revoked_at IS NULL AND last_seen_at > CURRENT_TIMESTAMP - INTERVAL '1 day')`,
+	).Scan(&stats.PaidOffDebts, &stats.IncomeSources, &stats.Payments, &stats.ActiveSessions)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	// Amounts in different currencies cannot be added up, so they are summed per currency
+	active, err := queryTotals(ctx, r.q, "SELECT currency, COUNT(*), SUM(amount) FROM debts WHERE status = 'active' GROUP BY currency")
+	if err != nil {
+		return Stats{}, err
+	}
+	stats.ActiveDebts = active.Count
+	stats.ActiveDebtByCurrency = active.ByCurrency
+	return stats, nil
+}
+
+// countBy runs a "key, COUNT(*)" query into a map
+func countBy(ctx context.Context, q DBTX, query string) (map[string]int, error) {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var key string
+		var count int
+		if err := rows.Scan(&key, &count); err != nil {
+			return nil, err
+		}
+		counts[key] = count
+	}
+	return counts, rows.Err()
+}
+
+// QueryAll runs a query and scans every row with scan, returning an empty
+// slice rather than nil when there are none
+func QueryAll[T any](ctx context.Context, q DBTX, scan func(RowScanner) (T, error), query string, args ...interface{}) ([]T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []T{}
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// queryTotals runs a "currency, COUNT(*), SUM(amount)" query
+func queryTotals(ctx context.Context, q DBTX, query string, args ...interface{}) (Totals, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return Totals{}, err
+	}
+	defer rows.Close()
+
+	totals := Totals{ByCurrency: map[string]money.Amount{}}
+	for rows.Next() {
+		var currency string
+		var count int
+		var sum money.Amount
+		if err := rows.Scan(&currency, &count, &sum); err != nil {
+			return Totals{}, err
+		}
+		totals.Count += count
+		totals.ByCurrency[currency] = sum
+	}
+	return totals, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in user input
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// notFound translates sql.ErrNoRows into ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
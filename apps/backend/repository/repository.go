@@ -0,0 +1,355 @@
+// Package repository loads and stores the domain models. Every repository is
+// an interface with a Postgres implementation for the server and an
+// in-memory one, so handlers can be exercised without a database.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kevinlucasklein/zero-balance/audit"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/money"
+)
+
+var (
+	// ErrNotFound is returned when the requested row does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrEmailTaken is returned when another account already has the email address
+	ErrEmailTaken = errors.New("email address already in use")
+	// ErrAlreadyLinked is returned when linking a provider account that is
+	// linked already, or a second account with the same provider
+	ErrAlreadyLinked = errors.New("sign-in provider account already linked")
+)
+
+// Store gives access to every repository. Lists are in the order the rows
+// were created.
+type Store interface {
+	Users() UserRepository
+	Debts() DebtRepository
+	IncomeSources() IncomeSourceRepository
+	Payments() PaymentRepository
+	ScheduledPayments() ScheduledPaymentRepository
+	ExchangeRates() ExchangeRateRepository
+	Tokens() TokenRepository
+	MFA() MFARepository
+	Identities() IdentityRepository
+	LoginStates() LoginStateRepository
+	AuditEvents() AuditRepository
+	Stats() StatsRepository
+
+	// InTx runs fn with a store whose changes are committed together when fn
+	// returns nil and discarded otherwise. Inside a transaction fn just runs.
+	InTx(ctx context.Context, fn func(Store) error) error
+}
+
+// UserRepository stores accounts
+type UserRepository interface {
+	// Create inserts a user from its name, email, password hash and email
+	// verification, and returns the stored user. The password hash may be
+	// empty, as for accounts created through a sign-in provider.
+	Create(ctx context.Context, user models.User) (models.User, error)
+	ByID(ctx context.Context, id int) (models.User, error)
+	ByEmail(ctx context.Context, email string) (models.User, error)
+	// ByIDForUpdate is ByID that also locks the user until the transaction ends
+	ByIDForUpdate(ctx context.Context, id int) (models.User, error)
+	// ByEmailForUpdate finds the oldest account with the email address in
+	// any letter case, as providers may report it, and locks it until the
+	// transaction ends
+	ByEmailForUpdate(ctx context.Context, email string) (models.User, error)
+	// UpdateProfile sets the name, and the base currency unless it is empty
+	UpdateProfile(ctx context.Context, id int, name, baseCurrency string) (models.User, error)
+	// SetPasswordHash stores a new password hash, which satisfies a forced reset
+	SetPasswordHash(ctx context.Context, id int, hash string) error
+	// BumpTokenVersion revokes every access token of a user and returns the
+	// new token version
+	BumpTokenVersion(ctx context.Context, id int) (int, error)
+	// MarkEmailVerified records that the user has verified their email address
+	MarkEmailVerified(ctx context.Context, id int) error
+	// Search returns one page of the accounts matching filter, by ID, and how
+	// many match in all
+	Search(ctx context.Context, filter UserFilter, limit, offset int) ([]models.User, int, error)
+	// SetDisabled disables an account, or enables it again
+	SetDisabled(ctx context.Context, id int, disabled bool) error
+	// RequirePasswordReset makes a user choose a new password before they can
+	// log in again
+	RequirePasswordReset(ctx context.Context, id int) error
+	// Delete deletes a user along with all of their data, except the audit log
+	Delete(ctx context.Context, id int) error
+}
+
+// UserFilter selects accounts for UserRepository.Search. Empty fields match
+// every account.
+type UserFilter struct {
+	// Search matches part of the name or email address in any letter case
+	Search string
+	Role   string
+	// Status is "active" or "disabled"
+	Status string
+}
+
+// Totals sums a user's amounts per currency
+type Totals struct {
+	Count      int
+	ByCurrency map[string]money.Amount
+}
+
+// DebtRepository stores debts
+type DebtRepository interface {
+	ListByUser(ctx context.Context, userID int) ([]models.Debt, error)
+	// ListByStatus lists a user's debts newest first, only those with status
+	// unless it is empty
+	ListByStatus(ctx context.Context, userID int, status string) ([]models.Debt, error)
+	ByID(ctx context.Context, userID, id int) (models.Debt, error)
+	// ByIDForUpdate is ByID that also locks the debt until the transaction ends
+	ByIDForUpdate(ctx context.Context, userID, id int) (models.Debt, error)
+	// LockByUser locks all of a user's debts until the transaction ends
+	LockByUser(ctx context.Context, userID int) error
+	// Create inserts a debt, in the user's base currency when it has none
+	Create(ctx context.Context, debt models.Debt) (models.Debt, error)
+	// Update stores a debt's creditor, amount, interest rate, minimum payment,
+	// due date and status. Its currency never changes.
+	Update(ctx context.Context, debt models.Debt) (models.Debt, error)
+	// ApplyPayment takes amount off a debt's balance, marking the debt paid
+	// off when nothing is left
+	ApplyPayment(ctx context.Context, userID, id int, amount money.Amount) (models.Debt, error)
+	// ReversePayment adds amount back onto a debt's balance, making the debt
+	// active again
+	ReversePayment(ctx context.Context, userID, id int, amount money.Amount) (models.Debt, error)
+	// Delete deletes a debt along with its payments and scheduled payments
+	Delete(ctx context.Context, userID, id int) (models.Debt, error)
+	// ActiveTotals sums the user's active debts
+	ActiveTotals(ctx context.Context, userID int) (Totals, error)
+}
+
+// IncomeSourceRepository stores income sources
+type IncomeSourceRepository interface {
+	ListByUser(ctx context.Context, userID int) ([]models.IncomeSource, error)
+	// ListByNextPayDate lists a user's income sources by their next payday
+	ListByNextPayDate(ctx context.Context, userID int) ([]models.IncomeSource, error)
+	ByID(ctx context.Context, userID, id int) (models.IncomeSource, error)
+	// ByIDForUpdate is ByID that also locks the income source until the
+	// transaction ends
+	ByIDForUpdate(ctx context.Context, userID, id int) (models.IncomeSource, error)
+	// Create inserts an income source, in the user's base currency when it
+	// has none
+	Create(ctx context.Context, source models.IncomeSource) (models.IncomeSource, error)
+	// Update stores an income source's name, amount, frequency, next pay date
+	// and pay day, and its currency unless that is empty
+	Update(ctx context.Context, source models.IncomeSource) (models.IncomeSource, error)
+	// SetNextPayDate moves an income source to its next payday
+	SetNextPayDate(ctx context.Context, userID, id int, nextPayDate string) (models.IncomeSource, error)
+	Delete(ctx context.Context, userID, id int) (models.IncomeSource, error)
+	Totals(ctx context.Context, userID int) (Totals, error)
+}
+
+// PaymentRepository stores payments
+type PaymentRepository interface {
+	ListByUser(ctx context.Context, userID int) ([]models.Payment, error)
+	// ListByDebt lists the payments made against one of a user's debts,
+	// latest first
+	ListByDebt(ctx context.Context, userID, debtID int) ([]models.Payment, error)
+	// Create inserts a payment, whose date is in RFC 3339 format
+	Create(ctx context.Context, payment models.Payment) (models.Payment, error)
+	// Delete deletes a payment made against one of a user's debts. The
+	// scheduled payment it completed, if any, loses its link to it.
+	Delete(ctx context.Context, userID, debtID, id int) (models.Payment, error)
+}
+
+// ScheduledPaymentRepository stores scheduled payments
+type ScheduledPaymentRepository interface {
+	ListByUser(ctx context.Context, userID int) ([]models.ScheduledPayment, error)
+	// ListByStatus lists a user's scheduled payments by date, only those with
+	// status unless it is empty
+	ListByStatus(ctx context.Context, userID int, status string) ([]models.ScheduledPayment, error)
+	// ByIDForUpdate finds one of a user's scheduled payments and locks it
+	// until the transaction ends
+	ByIDForUpdate(ctx context.Context, userID, id int) (models.ScheduledPayment, error)
+	// Create inserts a pending scheduled payment
+	Create(ctx context.Context, sp models.ScheduledPayment) (models.ScheduledPayment, error)
+	// DeletePending deletes a user's pending scheduled payments, keeping the
+	// completed and skipped ones as history
+	DeletePending(ctx context.Context, userID int) error
+	// Complete marks a scheduled payment completed by a payment
+	Complete(ctx context.Context, userID, id, paymentID int) (models.ScheduledPayment, error)
+	// Skip marks a scheduled payment skipped
+	Skip(ctx context.Context, userID, id int) (models.ScheduledPayment, error)
+	// Reopen makes the scheduled payment a payment completed pending again
+	Reopen(ctx context.Context, userID, paymentID int) error
+}
+
+// ExchangeRateRepository stores exchange rates
+type ExchangeRateRepository interface {
+	List(ctx context.Context) ([]models.ExchangeRate, error)
+	// ByPairForUpdate finds the rate from base to quote and locks it until
+	// the transaction ends
+	ByPairForUpdate(ctx context.Context, base, quote string) (models.ExchangeRate, error)
+	// Save creates or replaces the rate from base to quote
+	Save(ctx context.Context, base, quote string, rate money.ExchangeRate, updatedBy int) (models.ExchangeRate, error)
+	Delete(ctx context.Context, base, quote string) (models.ExchangeRate, error)
+}
+
+// RefreshToken is a stored refresh token. Only its hash is kept.
+type RefreshToken struct {
+	ID     int
+	UserID int
+	// FamilyID is shared by the tokens rotated from one login, and is the
+	// ID of its session
+	FamilyID string
+	Used     bool
+	Revoked  bool
+	Expired  bool
+}
+
+// TokenRepository stores refresh tokens, login sessions and email
+// verification tokens
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, userID int, familyID, tokenHash string, ttl time.Duration) error
+	// RefreshToken finds a refresh token by hash, locking it until the
+	// transaction ends so concurrent rotations are serialized
+	RefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id int) error
+	// RevokeFamily revokes every live refresh token in a family and the
+	// session it belongs to
+	RevokeFamily(ctx context.Context, familyID string) error
+	// RevokeAllForUser revokes every refresh token and session of a user, and
+	// returns how many sessions were live
+	RevokeAllForUser(ctx context.Context, userID int) (int, error)
+	// RevokeSession revokes one of a user's live sessions and its refresh
+	// tokens
+	RevokeSession(ctx context.Context, userID int, sessionID string) error
+	// TouchSession records a session for a new login, or updates the device
+	// details of an existing one
+	TouchSession(ctx context.Context, sessionID string, userID int, userAgent, ipAddress string) error
+	// ListSessions lists a user's live sessions used within idle, most
+	// recently used first
+	ListSessions(ctx context.Context, userID int, idle time.Duration) ([]models.Session, error)
+	// ReplaceEmailVerificationToken retires a user's outstanding verification
+	// tokens and stores a new one
+	ReplaceEmailVerificationToken(ctx context.Context, userID int, tokenHash string, ttl time.Duration) error
+	// UseEmailVerificationToken consumes an unused, unexpired verification
+	// token and returns its user's ID
+	UseEmailVerificationToken(ctx context.Context, tokenHash string) (int, error)
+	// ReplacePasswordResetToken retires a user's outstanding reset tokens and
+	// stores a new one
+	ReplacePasswordResetToken(ctx context.Context, userID int, tokenHash string, ttl time.Duration) error
+	// UsePasswordResetToken consumes an unused, unexpired reset token and
+	// returns its user's ID
+	UsePasswordResetToken(ctx context.Context, tokenHash string) (int, error)
+}
+
+// MFAState is a user's two-factor authentication state
+type MFAState struct {
+	// Secret is the TOTP secret, empty until enrollment starts
+	Secret  string
+	Enabled bool
+	// LastStep is the time step of the last accepted code, 0 if there is none
+	LastStep int64
+}
+
+// MFARepository stores TOTP secrets and recovery codes
+type MFARepository interface {
+	// StateForUpdate returns a user's two-factor state, locking the user
+	// until the transaction ends
+	StateForUpdate(ctx context.Context, userID int) (MFAState, error)
+	// StartEnrollment stores a new secret unless two-factor authentication
+	// is enabled, replacing an unconfirmed one
+	StartEnrollment(ctx context.Context, userID int, secret string) error
+	// Enable confirms enrollment with the code accepted at step
+	Enable(ctx context.Context, userID int, step int64) error
+	// Disable turns two-factor authentication off and deletes the recovery codes
+	Disable(ctx context.Context, userID int) error
+	// SetLastStep records the time step of the last accepted code
+	SetLastStep(ctx context.Context, userID int, step int64) error
+	// ReplaceRecoveryCodes replaces a user's recovery codes with new ones,
+	// given by hash
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	// UseRecoveryCode consumes an unused recovery code, reporting whether
+	// there was one
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+}
+
+// IdentityRepository stores the sign-in provider accounts linked to users
+type IdentityRepository interface {
+	ListByUser(ctx context.Context, userID int) ([]models.Identity, error)
+	// Owner returns the ID of the user a provider account is linked to
+	Owner(ctx context.Context, provider, subject string) (int, error)
+	// Link links a provider account to a user. A user has at most one
+	// account per provider.
+	Link(ctx context.Context, userID int, provider, subject, email string) (models.Identity, error)
+	// RecordLogin notes a sign-in with a linked provider account, updates
+	// the email address the provider reports and returns the user's ID
+	RecordLogin(ctx context.Context, provider, subject, email string) (int, error)
+	// Unlink removes one of a user's provider accounts
+	Unlink(ctx context.Context, id, userID int) error
+}
+
+// LoginState is a sign-in started with a provider but not finished yet
+type LoginState struct {
+	// StateHash is the hash of the state parameter
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	// LinkUserID is the user adding the provider to their account, 0 when
+	// signing in
+	LinkUserID int
+	Expired    bool
+}
+
+// LoginStateRepository stores started sign-ins
+type LoginStateRepository interface {
+	// Create stores a sign-in that expires after ttl, forgetting the
+	// abandoned ones while at it
+	Create(ctx context.Context, state LoginState, ttl time.Duration) error
+	// Take removes a provider's sign-in and returns it, so each works once
+	Take(ctx context.Context, stateHash, provider string) (LoginState, error)
+}
+
+// AuditFilter selects the audit events concerning a user. Empty fields
+// match every event.
+type AuditFilter struct {
+	UserID int
+	// BeforeID only matches events older than the one with this ID
+	BeforeID   int64
+	Action     string
+	EntityType string
+	EntityID   string
+	// From and To bound when the event happened, From inclusive and To exclusive
+	From time.Time
+	To   time.Time
+}
+
+// AuditRepository stores audit events
+type AuditRepository interface {
+	Record(ctx context.Context, event audit.Event) error
+	// List lists up to limit of the events matching filter, newest first.
+	// The IP address of events the user did not cause themselves is left out.
+	List(ctx context.Context, filter AuditFilter, limit int) ([]models.AuditEvent, error)
+}
+
+// Stats are aggregate statistics across every account
+type Stats struct {
+	Users          int
+	UsersByRole    map[string]int
+	VerifiedUsers  int
+	TwoFactorUsers int
+	DisabledUsers  int
+	// NewUsers signed up in the last 30 days
+	NewUsers int
+	// ActiveSessions were used in the last day
+	ActiveSessions int
+	ActiveDebts    int
+	PaidOffDebts   int
+	// ActiveDebtByCurrency sums the active debts per currency, as amounts in
+	// different currencies cannot be added up
+	ActiveDebtByCurrency map[string]money.Amount
+	IncomeSources        int
+	Payments             int
+}
+
+// StatsRepository computes statistics across every account
+type StatsRepository interface {
+	Get(ctx context.Context) (Stats, error)
+}
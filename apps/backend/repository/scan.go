@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/kevinlucasklein/zero-balance/models"
+)
+
+// RowScanner is satisfied by both *sql.Row and *sql.Rows
+type RowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Columns selected for each model, in the order its Scan function reads them
+const (
+	UserColumns = "id, name, email, email_verified, base_currency, created_at, COALESCE(password_hash, ''), role, " +
+		"token_version, totp_enabled, disabled_at, password_reset_required"
+	DebtColumns             = "id, user_id, creditor_name, amount, currency, interest_rate, minimum_payment, due_date, status, created_at"
+	IncomeSourceColumns     = "id, user_id, source_name, amount, currency, frequency, next_pay_date, pay_day, created_at"
+	PaymentColumns          = "id, user_id, debt_id, amount, currency, payment_date, method"
+	ScheduledPaymentColumns = "id, user_id, debt_id, recommended_amount, currency, scheduled_date, status, payment_id, created_at"
+	ExchangeRateColumns     = "base_currency, quote_currency, rate, updated_at"
+	IdentityColumns         = "id, user_id, provider, email, created_at, last_login_at"
+)
+
+// ScanUser scans a row selected with UserColumns into a User
+func ScanUser(row RowScanner) (models.User, error) {
+	var user models.User
+	var createdAt time.Time
+	var disabledAt sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.Name, &user.Email, &user.EmailVerified, &user.BaseCurrency, &createdAt, &user.PasswordHash,
+		&user.Role, &user.TokenVersion, &user.MFAEnabled, &disabledAt, &user.PasswordResetRequired,
+	)
+	if err != nil {
+		return models.User{}, err
+	}
+	user.CreatedAt = createdAt.Format(time.RFC3339)
+	if disabledAt.Valid {
+		formatted := disabledAt.Time.Format(time.RFC3339)
+		user.DisabledAt = &formatted
+	}
+	return user, nil
+}
+
+// ScanDebt scans a row selected with DebtColumns into a Debt
+func ScanDebt(row RowScanner) (models.Debt, error) {
+	var debt models.Debt
+	var dueDate, createdAt time.Time
+	err := row.Scan(
+		&debt.ID, &debt.UserID, &debt.CreditorName, &debt.Amount, &debt.Currency, &debt.InterestRate,
+		&debt.MinimumPayment, &dueDate, &debt.Status, &createdAt,
+	)
+	if err != nil {
+		return models.Debt{}, err
+	}
+	debt.DueDate = dueDate.Format(models.DateLayout)
+	debt.CreatedAt = createdAt.Format(time.RFC3339)
+	return debt, nil
+}
+
+// ScanIncomeSource scans a row selected with IncomeSourceColumns into an IncomeSource
+func ScanIncomeSource(row RowScanner) (models.IncomeSource, error) {
+	var source models.IncomeSource
+	var nextPayDate, createdAt time.Time
+	var payDay sql.NullInt64
+	err := row.Scan(
+		&source.ID, &source.UserID, &source.SourceName, &source.Amount, &source.Currency, &source.Frequency,
+		&nextPayDate, &payDay, &createdAt,
+	)
+	if err != nil {
+		return models.IncomeSource{}, err
+	}
+	source.NextPayDate = nextPayDate.Format(models.DateLayout)
+	source.CreatedAt = createdAt.Format(time.RFC3339)
+	if payDay.Valid {
+		day := int(payDay.Int64)
+		source.PayDay = &day
+	}
+	return source, nil
+}
+
+// ScanPayment scans a row selected with PaymentColumns into a Payment
+func ScanPayment(row RowScanner) (models.Payment, error) {
+	var payment models.Payment
+	var paymentDate time.Time
+	err := row.Scan(
+		&payment.ID, &payment.UserID, &payment.DebtID, &payment.Amount, &payment.Currency, &paymentDate, &payment.Method,
+	)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	payment.PaymentDate = paymentDate.Format(time.RFC3339)
+	return payment, nil
+}
+
+// ScanScheduledPayment scans a row selected with ScheduledPaymentColumns into a ScheduledPayment
+func ScanScheduledPayment(row RowScanner) (models.ScheduledPayment, error) {
+	var sp models.ScheduledPayment
+	var scheduledDate, createdAt time.Time
+	var paymentID sql.NullInt64
+	err := row.Scan(
+		&sp.ID, &sp.UserID, &sp.DebtID, &sp.RecommendedAmount, &sp.Currency, &scheduledDate, &sp.Status,
+		&paymentID, &createdAt,
+	)
+	if err != nil {
+		return models.ScheduledPayment{}, err
+	}
+	sp.ScheduledDate = scheduledDate.Format(models.DateLayout)
+	sp.CreatedAt = createdAt.Format(time.RFC3339)
+	if paymentID.Valid {
+		id := int(paymentID.Int64)
+		sp.PaymentID = &id
+	}
+	return sp, nil
+}
+
+// ScanExchangeRate scans a row selected with ExchangeRateColumns into an ExchangeRate
+func ScanExchangeRate(row RowScanner) (models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	var updatedAt time.Time
+	if err := row.Scan(&rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate, &updatedAt); err != nil {
+		return models.ExchangeRate{}, err
+	}
+	rate.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return rate, nil
+}
+
+// ScanIdentity scans a row selected with IdentityColumns into an Identity
+func ScanIdentity(row RowScanner) (models.Identity, error) {
+	var identity models.Identity
+	var createdAt time.Time
+	var lastLoginAt sql.NullTime
+	err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Email, &createdAt, &lastLoginAt)
+	if err != nil {
+		return models.Identity{}, err
+	}
+	identity.CreatedAt = createdAt.Format(time.RFC3339)
+	if lastLoginAt.Valid {
+		formatted := lastLoginAt.Time.Format(time.RFC3339)
+		identity.LastLoginAt = &formatted
+	}
+	return identity, nil
+}
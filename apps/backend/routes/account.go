@@ -0,0 +1,168 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/repository"
+	"github.com/kevinlucasklein/zero-balance/utils"
+)
+
+// registerAccountRoutes registers data export and account deletion under the
+// profile group. Both require a verified email address.
+func registerAccountRoutes(profileGroup fiber.Router, store repository.Store) {
+	verified := middleware.VerifiedEmailMiddleware(func(ctx context.Context, userID int) (bool, error) {
+		user, err := store.Users().ByID(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return user.EmailVerified, err
+	})
+
+	// Export all of the user's data
+	profileGroup.Get("/export", verified, func(c *fiber.Ctx) error {
+		// Get user ID from context (set by AuthMiddleware)
+		userID := middleware.CurrentPrincipal(c).UserID
+
+		user, err := store.Users().ByID(c.UserContext(), userID)
+		if err != nil {
+			log.Printf("Error querying user profile: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error exporting data",
+			})
+		}
+
+		debts, err := store.Debts().ListByUser(c.UserContext(), userID)
+		if err != nil {
+			log.Printf("Error exporting debts: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error exporting data",
+			})
+		}
+
+		incomeSources, err := store.IncomeSources().ListByUser(c.UserContext(), userID)
+		if err != nil {
+			log.Printf("Error exporting income sources: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error exporting data",
+			})
+		}
+
+		payments, err := store.Payments().ListByUser(c.UserContext(), userID)
+		if err != nil {
+			log.Printf("Error exporting payments: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error exporting data",
+			})
+		}
+
+		scheduledPayments, err := store.ScheduledPayments().ListByUser(c.UserContext(), userID)
+		if err != nil {
+			log.Printf("Error exporting scheduled payments: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error exporting data",
+			})
+		}
+
+		identities, err := store.Identities().ListByUser(c.UserContext(), userID)
+		if err != nil {
+			log.Printf("Error exporting identities: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error exporting data",
+			})
+		}
+
+		// Offer the export as a file download
+		c.Attachment("zero-balance-export.json")
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"exported_at": time.Now().UTC().Format(time.RFC3339),
+			"profile": fiber.Map{
+				"id":            user.ID,
+				"name":          user.Name,
+				"email":         user.Email,
+				"base_currency": user.BaseCurrency,
+				"created_at":    user.CreatedAt,
+			},
+			"debts":              debts,
+			"income_sources":     incomeSources,
+			"payments":           payments,
+			"scheduled_payments": scheduledPayments,
+			"linked_accounts":    identities,
+		})
+	})
+
+	// Permanently delete the account and all of its data
+	profileGroup.Delete("/", verified, func(c *fiber.Ctx) error {
+		// Get user ID from context (set by AuthMiddleware)
+		userID := middleware.CurrentPrincipal(c).UserID
+
+		// Parse request body
+		type DeleteAccountRequest struct {
+			Password string `json:"password"`
+		}
+
+		var req DeleteAccountRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request format",
+			})
+		}
+
+		// Validate input
+		if req.Password == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Password is required to delete your account",
+			})
+		}
+
+		user, err := store.Users().ByID(c.UserContext(), userID)
+		if err != nil {
+			log.Printf("Error querying user password: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+
+		// Confirm it is really the account holder
+		if !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Password is incorrect",
+			})
+		}
+
+		err = store.InTx(c.UserContext(), func(tx repository.Store) error {
+			// This removes all of the user's data. The audit log is kept, as
+			// the record of their finances.
+			if err := tx.Users().Delete(c.UserContext(), userID); err != nil {
+				return err
+			}
+
+			event := auditEvent(c, userID, "account.delete", "user", strconv.Itoa(userID))
+			event.Before = deletedAccount{ID: user.ID, Name: user.Name, Email: user.Email, CreatedAt: user.CreatedAt}
+			return tx.AuditEvents().Record(c.UserContext(), event)
+		})
+		if err != nil {
+			log.Printf("Error deleting account: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error deleting account",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Account deleted successfully",
+		})
+	})
+}
+
+// deletedAccount is the audit log's record of a deleted account
+type deletedAccount struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	CreatedAt string `json:"created_at"`
+}
@@ -0,0 +1,167 @@
+package routes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+// newProfileTest returns an app serving a ProfileService over store
+func newProfileTest(store repository.Store) *fiber.App {
+	app := newTestApp()
+	NewProfileService(store).Register(app.Group("/api/profile", middleware.AuthMiddleware()))
+	return app
+}
+
+func TestExportAccount(t *testing.T) {
+	tests := []struct {
+		name       string
+		verified   bool
+		wantStatus int
+	}{
+		{name: "verified account", verified: true, wantStatus: fiber.StatusOK},
+		{name: "unverified account", wantStatus: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := repository.NewMemoryStore()
+			app := newProfileTest(store)
+			user := store.AddUser(models.User{Name: "Ada", Email: "ada@example.com", EmailVerified: tt.verified})
+			other := store.AddUser(models.User{Name: "Bob", Email: "bob@example.com", EmailVerified: true})
+			store.AddDebt(models.Debt{UserID: user.ID, CreditorName: "Bank", Currency: "USD", Status: "active"})
+			store.AddDebt(models.Debt{UserID: other.ID, CreditorName: "Other bank", Currency: "USD", Status: "active"})
+
+			status, body := request(t, app, fiber.MethodGet, "/api/profile/export", accessToken(t, store, user.ID), nil)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %v", status, tt.wantStatus, body)
+			}
+			if status != fiber.StatusOK {
+				return
+			}
+
+			if email := body["profile"].(map[string]interface{})["email"]; email != user.Email {
+				t.Fatalf("exported profile email %v, want %s", email, user.Email)
+			}
+			debts := body["debts"].([]interface{})
+			if len(debts) != 1 || debts[0].(map[string]interface{})["creditor_name"] != "Bank" {
+				t.Fatalf("exported debts %v, want only the user's own", debts)
+			}
+		})
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	tests := []struct {
+		name       string
+		verified   bool
+		password   string
+		wantStatus int
+	}{
+		{name: "correct password", verified: true, password: "secret", wantStatus: fiber.StatusOK},
+		{name: "wrong password", verified: true, password: "wrong", wantStatus: fiber.StatusUnauthorized},
+		{name: "no password", verified: true, wantStatus: fiber.StatusBadRequest},
+		{name: "unverified account", password: "secret", wantStatus: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := repository.NewMemoryStore()
+			app := newProfileTest(store)
+			user := store.AddUser(models.User{
+				Name:          "Ada",
+				Email:         "ada@example.com",
+				EmailVerified: tt.verified,
+				PasswordHash:  passwordHash(t, "secret"),
+			})
+			other := store.AddUser(models.User{Name: "Bob", Email: "bob@example.com", EmailVerified: true})
+			store.AddDebt(models.Debt{UserID: user.ID, CreditorName: "Bank", Currency: "USD", Status: "active"})
+			store.AddDebt(models.Debt{UserID: other.ID, CreditorName: "Other bank", Currency: "USD", Status: "active"})
+
+			status, body := request(t, app, fiber.MethodDelete, "/api/profile", accessToken(t, store, user.ID), fiber.Map{"password": tt.password})
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %v", status, tt.wantStatus, body)
+			}
+
+			deleted := status == fiber.StatusOK
+			if _, err := store.Users().ByID(ctx, user.ID); (err == repository.ErrNotFound) != deleted {
+				t.Fatalf("looking up the user: %v, want it deleted = %v", err, deleted)
+			}
+			debts, err := store.Debts().ListByUser(ctx, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(debts) == 0) != deleted {
+				t.Fatalf("user has %d debts, want them deleted = %v", len(debts), deleted)
+			}
+			if debts, err := store.Debts().ListByUser(ctx, other.ID); err != nil || len(debts) != 1 {
+				t.Fatalf("other user's debts %v (%v), want them untouched", debts, err)
+			}
+
+			// The audit log outlives the account, with a record of who it was
+			var recorded bool
+			for _, event := range store.AuditLog() {
+				if event.Action == "account.delete" {
+					account, ok := event.Before.(deletedAccount)
+					recorded = ok && account.ID == user.ID && account.Email == user.Email
+				}
+			}
+			if recorded != deleted {
+				t.Fatalf("deletion recorded in the audit log = %v, want %v", recorded, deleted)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	tests := []struct {
+		name            string
+		currentPassword string
+		wantStatus      int
+	}{
+		{name: "correct password", currentPassword: "secret", wantStatus: fiber.StatusOK},
+		{name: "wrong password", currentPassword: "wrong", wantStatus: fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := repository.NewMemoryStore()
+			app := newProfileTest(store)
+			user := store.AddUser(models.User{Name: "Ada", Email: "ada@example.com", PasswordHash: passwordHash(t, "secret")})
+			token := accessToken(t, store, user.ID)
+			otherDevice := accessToken(t, store, user.ID)
+
+			status, body := request(t, app, fiber.MethodPut, "/api/profile/password", token, fiber.Map{
+				"current_password": tt.currentPassword,
+				"new_password":     "correct-horse-battery-9",
+			})
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %v", status, tt.wantStatus, body)
+			}
+
+			// A changed password revokes every token issued before it, the
+			// caller carries on with the fresh one
+			changed := status == fiber.StatusOK
+			wantOld := fiber.StatusOK
+			if changed {
+				wantOld = fiber.StatusUnauthorized
+			}
+			for name, old := range map[string]string{"caller's": token, "other device's": otherDevice} {
+				if status, body := request(t, app, fiber.MethodGet, "/api/profile", old, nil); status != wantOld {
+					t.Fatalf("%s old token: status %d, want %d, body %v", name, status, wantOld, body)
+				}
+			}
+			if !changed {
+				return
+			}
+			if status, body := request(t, app, fiber.MethodGet, "/api/profile", body["token"].(string), nil); status != fiber.StatusOK {
+				t.Fatalf("new token: status %d, want %d, body %v", status, fiber.StatusOK, body)
+			}
+		})
+	}
+}
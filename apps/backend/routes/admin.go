@@ -0,0 +1,336 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/mailer"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+// Page sizes of the admin user list
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+)
+
+// AdminUser is a user account as shown to support staff and admins
+type AdminUser struct {
+	ID                    int     `json:"id"`
+	Name                  string  `json:"name"`
+	Email                 string  `json:"email"`
+	Role                  string  `json:"role"`
+	EmailVerified         bool    `json:"email_verified"`
+	TwoFactorEnabled      bool    `json:"two_factor_enabled"`
+	DisabledAt            *string `json:"disabled_at"`
+	PasswordResetRequired bool    `json:"password_reset_required"`
+	CreatedAt             string  `json:"created_at"`
+}
+
+// adminUser returns how support staff and admins see an account
+func adminUser(user models.User) AdminUser {
+	return AdminUser{
+		ID:                    user.ID,
+		Name:                  user.Name,
+		Email:                 user.Email,
+		Role:                  user.Role,
+		EmailVerified:         user.EmailVerified,
+		TwoFactorEnabled:      user.MFAEnabled,
+		DisabledAt:            user.DisabledAt,
+		PasswordResetRequired: user.PasswordResetRequired,
+		CreatedAt:             user.CreatedAt,
+	}
+}
+
+// AdminService serves the admin API, over every account
+type AdminService struct {
+	store repository.Store
+	mail  mailer.Mailer
+}
+
+// NewAdminService returns an AdminService keeping accounts in store and
+// emailing password reset links through mail
+func NewAdminService(store repository.Store, mail mailer.Mailer) *AdminService {
+	return &AdminService{store: store, mail: mail}
+}
+
+// RegisterAdminRoutes registers the admin API. Support staff can look users
+// up, only admins can change accounts. Every request is audit-logged.
+func RegisterAdminRoutes(app *fiber.App, db *sql.DB, mail mailer.Mailer) {
+	staff := middleware.RequireRole(middleware.RoleSupport, middleware.RoleAdmin)
+
+	// Create an admin users group with authentication middleware
+	usersGroup := app.Group("/api/admin/users")
+	usersGroup.Use(middleware.AuthMiddleware())
+	usersGroup.Use(staff)
+
+	s := NewAdminService(repository.NewPostgresStore(db), mail)
+	s.Register(usersGroup)
+
+	// Aggregate statistics across every account
+	app.Get("/api/admin/stats", middleware.AuthMiddleware(), staff, s.stats)
+}
+
+// Register registers the user routes on a group that already runs
+// AuthMiddleware and only lets support staff and admins through
+func (s *AdminService) Register(router fiber.Router) {
+	adminOnly := middleware.RequireRole(middleware.RoleAdmin)
+
+	router.Get("/", s.listUsers)
+	router.Post("/:id/disable", adminOnly, s.disable)
+	router.Post("/:id/enable", adminOnly, s.enable)
+	router.Post("/:id/force-password-reset", adminOnly, s.forcePasswordReset)
+}
+
+// listUsers lists users, optionally searching name and email and filtering
+// by role and status
+func (s *AdminService) listUsers(c *fiber.Ctx) error {
+	search := strings.TrimSpace(c.Query("search"))
+	role := c.Query("role")
+	status := c.Query("status")
+
+	// Validate input
+	if role != "" && !isValidRole(role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role must be 'user', 'support', or 'admin'",
+		})
+	}
+	if status != "" && status != "active" && status != "disabled" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Status must be 'active' or 'disabled'",
+		})
+	}
+	limit := c.QueryInt("limit", defaultAdminPageSize)
+	offset := c.QueryInt("offset", 0)
+	if limit < 1 || limit > maxAdminPageSize || offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Limit must be between 1 and %d and offset must not be negative", maxAdminPageSize),
+		})
+	}
+
+	ctx := c.UserContext()
+	found, total, err := s.store.Users().Search(ctx, repository.UserFilter{Search: search, Role: role, Status: status}, limit, offset)
+	if err != nil {
+		log.Printf("Error querying users: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving users",
+		})
+	}
+	users := make([]AdminUser, 0, len(found))
+	for _, user := range found {
+		users = append(users, adminUser(user))
+	}
+
+	// Looking accounts up exposes personal data, so it is audited too
+	event := auditEvent(c, 0, "user.search", "user", "")
+	event.After = fiber.Map{"search": search, "role": role, "status": status, "limit": limit, "offset": offset}
+	if err := s.store.AuditEvents().Record(ctx, event); err != nil {
+		log.Printf("Error recording audit event: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving users",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"users":  users,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// disable disables an account and logs it out everywhere
+func (s *AdminService) disable(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	user, err := s.updateAccount(c, "user.disable", func(tx repository.Store, user AdminUser) error {
+		if user.ID == middleware.CurrentPrincipal(c).UserID {
+			return accountConflict("You cannot disable your own account")
+		}
+		if user.DisabledAt != nil {
+			return accountConflict("Account is already disabled")
+		}
+		if err := tx.Users().SetDisabled(ctx, user.ID, true); err != nil {
+			return err
+		}
+		_, err := endAllSessions(ctx, tx, user.ID)
+		return err
+	})
+	if err == nil {
+		middleware.ForgetUserSessions(user.ID)
+	}
+	return accountResponse(c, user, err)
+}
+
+// enable re-enables a disabled account
+func (s *AdminService) enable(c *fiber.Ctx) error {
+	user, err := s.updateAccount(c, "user.enable", func(tx repository.Store, user AdminUser) error {
+		if user.DisabledAt == nil {
+			return accountConflict("Account is not disabled")
+		}
+		return tx.Users().SetDisabled(c.UserContext(), user.ID, false)
+	})
+	return accountResponse(c, user, err)
+}
+
+// forcePasswordReset logs an account out everywhere and makes it choose a
+// new password before logging in again, emailing it a reset link
+func (s *AdminService) forcePasswordReset(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	var token string
+	user, err := s.updateAccount(c, "user.force_password_reset", func(tx repository.Store, user AdminUser) error {
+		if err := tx.Users().RequirePasswordReset(ctx, user.ID); err != nil {
+			return err
+		}
+		if _, err := endAllSessions(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		var err error
+		token, err = createPasswordResetToken(ctx, tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return accountResponse(c, user, err)
+	}
+	middleware.ForgetUserSessions(user.ID)
+
+	// Only send the link once the token has been committed
+	sendPasswordResetEmail(s.mail, user.Email, token, "An administrator has asked you to choose a new password for your ZeroBalance account.")
+	return accountResponse(c, user, nil)
+}
+
+// stats returns aggregate statistics across every account
+func (s *AdminService) stats(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	stats, err := s.store.Stats().Get(ctx)
+	if err != nil {
+		log.Printf("Error querying stats: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving statistics",
+		})
+	}
+
+	if err := s.store.AuditEvents().Record(ctx, auditEvent(c, 0, "stats.view", "stats", "")); err != nil {
+		log.Printf("Error recording audit event: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving statistics",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"stats": fiber.Map{
+			"users":                    stats.Users,
+			"users_by_role":            stats.UsersByRole,
+			"verified_users":           stats.VerifiedUsers,
+			"two_factor_users":         stats.TwoFactorUsers,
+			"disabled_users":           stats.DisabledUsers,
+			"new_users_last_30_days":   stats.NewUsers,
+			"sessions_active_last_day": stats.ActiveSessions,
+			"active_debts":             stats.ActiveDebts,
+			"paid_off_debts":           stats.PaidOffDebts,
+			"active_debt_by_currency":  stats.ActiveDebtByCurrency,
+			"income_sources":           stats.IncomeSources,
+			"payments":                 stats.Payments,
+		},
+	})
+}
+
+var (
+	errInvalidUserID = errors.New("invalid user ID")
+	errUserNotFound  = errors.New("user not found")
+)
+
+// accountConflict is returned by an account change that does not apply to
+// the account, with the message to show
+type accountConflict string
+
+func (e accountConflict) Error() string {
+	return string(e)
+}
+
+// updateAccount runs an admin change to the account named by the :id param
+// in a transaction, audit-logging its before and after state, and returns
+// the account as changed. change returns an accountConflict when the change
+// does not apply to the account.
+func (s *AdminService) updateAccount(c *fiber.Ctx, action string, change func(tx repository.Store, user AdminUser) error) (AdminUser, error) {
+	userID, err := parseIDParam(c)
+	if err != nil {
+		return AdminUser{}, errInvalidUserID
+	}
+
+	ctx := c.UserContext()
+	var after AdminUser
+	err = s.store.InTx(ctx, func(tx repository.Store) error {
+		user, err := tx.Users().ByIDForUpdate(ctx, userID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errUserNotFound
+			}
+			return fmt.Errorf("querying user: %w", err)
+		}
+		before := adminUser(user)
+
+		if err := change(tx, before); err != nil {
+			return err
+		}
+
+		user, err = tx.Users().ByID(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("querying user: %w", err)
+		}
+		after = adminUser(user)
+
+		event := auditEvent(c, userID, action, "user", strconv.Itoa(userID))
+		event.Before = before
+		event.After = after
+		if err := tx.AuditEvents().Record(ctx, event); err != nil {
+			return fmt.Errorf("recording audit event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return AdminUser{}, err
+	}
+	return after, nil
+}
+
+// accountResponse responds with the result of updateAccount
+func accountResponse(c *fiber.Ctx, user AdminUser, err error) error {
+	var conflict accountConflict
+	switch {
+	case err == nil:
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Account updated successfully",
+			"user":    user,
+		})
+	case errors.Is(err, errInvalidUserID):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	case errors.Is(err, errUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	case errors.As(err, &conflict):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": conflict.Error(),
+		})
+	}
+
+	log.Printf("Error updating user account: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Error processing your request",
+	})
+}
+
+// isValidRole mirrors the CHECK constraint on users.role
+func isValidRole(role string) bool {
+	return role == middleware.RoleUser || role == middleware.RoleSupport || role == middleware.RoleAdmin
+}
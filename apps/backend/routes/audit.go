@@ -0,0 +1,143 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/audit"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+// Page sizes of the audit history
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// AuditEvent is an audit log entry as shown to the user it concerns
+type AuditEvent = models.AuditEvent
+
+// AuditService serves the signed-in user's own audit history
+type AuditService struct {
+	store repository.Store
+}
+
+// NewAuditService returns an AuditService reading events from store
+func NewAuditService(store repository.Store) *AuditService {
+	return &AuditService{store: store}
+}
+
+// RegisterAuditRoutes registers the route users read their own audit history from
+func RegisterAuditRoutes(app *fiber.App, db *sql.DB) {
+	// Create an audit group with authentication middleware
+	auditGroup := app.Group("/api/audit")
+	auditGroup.Use(middleware.AuthMiddleware())
+
+	NewAuditService(repository.NewPostgresStore(db)).Register(auditGroup)
+}
+
+// Register registers the service's routes on a group that already runs
+// AuthMiddleware
+func (s *AuditService) Register(router fiber.Router) {
+	router.Get("/", s.list)
+}
+
+// list lists the caller's audit events newest first, one page per request.
+// The next_cursor of a page is passed as cursor to fetch the one after it.
+func (s *AuditService) list(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	limit := c.QueryInt("limit", defaultAuditPageSize)
+	if limit < 1 || limit > maxAuditPageSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Limit must be between 1 and %d", maxAuditPageSize),
+		})
+	}
+
+	filter := repository.AuditFilter{
+		UserID:     userID,
+		Action:     c.Query("action"),
+		EntityType: c.Query("entity_type"),
+		EntityID:   c.Query("entity_id"),
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || id < 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		filter.BeforeID = id
+	}
+
+	// from and to are inclusive UTC dates
+	if from := c.Query("from"); from != "" {
+		date, err := time.Parse(dateLayout, from)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "From must be in YYYY-MM-DD format",
+			})
+		}
+		filter.From = date
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := time.Parse(dateLayout, to)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "To must be in YYYY-MM-DD format",
+			})
+		}
+		filter.To = date.AddDate(0, 0, 1)
+	}
+
+	// Fetch one extra event to learn whether there is a next page
+	events, err := s.store.AuditEvents().List(c.UserContext(), filter, limit+1)
+	if err != nil {
+		log.Printf("Error querying audit events: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving audit history",
+		})
+	}
+
+	var nextCursor *string
+	if len(events) > limit {
+		events = events[:limit]
+		cursor := strconv.FormatInt(events[limit-1].ID, 10)
+		nextCursor = &cursor
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"events":      events,
+		"next_cursor": nextCursor,
+	})
+}
+
+// auditEvent starts an audit event for an action the caller takes on an
+// entity belonging to userID
+func auditEvent(c *fiber.Ctx, userID int, action, entityType, entityID string) audit.Event {
+	return audit.Event{
+		ActorID:    middleware.CurrentPrincipal(c).UserID,
+		UserID:     userID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		IPAddress:  c.IP(),
+		RequestID:  c.GetRespHeader(fiber.HeaderXRequestID),
+	}
+}
+
+// changeEvent is the audit event for a change the caller made to one of
+// userID's entities. Pass a nil before for a creation and a nil after for a
+// deletion.
+func changeEvent(c *fiber.Ctx, userID int, action, entityType string, entityID int, before, after interface{}) audit.Event {
+	event := auditEvent(c, userID, action, entityType, strconv.Itoa(entityID))
+	event.Before = before
+	event.After = after
+	return event
+}
@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/audit"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+// newAuditTest returns an app serving an AuditService over store
+func newAuditTest(store repository.Store) *fiber.App {
+	app := newTestApp()
+	NewAuditService(store).Register(app.Group("/api/audit", middleware.AuthMiddleware()))
+	return app
+}
+
+func TestAuditPagination(t *testing.T) {
+	store := repository.NewMemoryStore()
+	app := newAuditTest(store)
+	user := store.AddUser(models.User{Name: "Ada", Email: "ada@example.com"})
+	other := store.AddUser(models.User{Name: "Bob", Email: "bob@example.com"})
+	token := accessToken(t, store, user.ID)
+
+	// Five debts for the user, with another user's event in between
+	for i := 1; i <= 5; i++ {
+		event := audit.Event{ActorID: user.ID, UserID: user.ID, Action: "debt.create", EntityType: "debt", EntityID: strconv.Itoa(i)}
+		if err := store.AuditEvents().Record(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+		if i == 3 {
+			event := audit.Event{ActorID: other.ID, UserID: other.ID, Action: "debt.create", EntityType: "debt", EntityID: "99"}
+			if err := store.AuditEvents().Record(context.Background(), event); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Pages run newest first, and the last one has no cursor
+	wantPages := [][]string{{"5", "4"}, {"3", "2"}, {"1"}}
+	path := "/api/audit/?limit=2"
+	for i, want := range wantPages {
+		status, body := request(t, app, fiber.MethodGet, path, token, nil)
+		if status != fiber.StatusOK {
+			t.Fatalf("page %d status = %d, want %d, body %v", i+1, status, fiber.StatusOK, body)
+		}
+		var got []string
+		for _, event := range body["events"].([]interface{}) {
+			got = append(got, event.(map[string]interface{})["entity_id"].(string))
+		}
+		if len(got) != len(want) || got[0] != want[0] || got[len(got)-1] != want[len(want)-1] {
+			t.Fatalf("page %d entities %v, want %v", i+1, got, want)
+		}
+
+		cursor, more := body["next_cursor"].(string)
+		if more != (i < len(wantPages)-1) {
+			t.Fatalf("page %d next_cursor %v, want one only before the last page", i+1, body["next_cursor"])
+		}
+		path = "/api/audit/?limit=2&cursor=" + cursor
+	}
+
+	if status, body := request(t, app, fiber.MethodGet, "/api/audit/?cursor=abc", token, nil); status != fiber.StatusBadRequest {
+		t.Fatalf("invalid cursor status = %d, want %d, body %v", status, fiber.StatusBadRequest, body)
+	}
+}
@@ -2,213 +2,485 @@ package routes
 
 import (
 	"database/sql"
+	"errors"
 	"log"
-	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/lockout"
+	"github.com/kevinlucasklein/zero-balance/mailer"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/repository"
 	"github.com/kevinlucasklein/zero-balance/utils"
 )
 
+// errInvalidRefreshToken is returned for a revoked or expired refresh token
+var errInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// AuthService serves signup, login, token refresh, logout, the current user,
+// password resets, email verification, sessions and two-factor authentication
+type AuthService struct {
+	store repository.Store
+	mail  mailer.Mailer
+	guard *loginGuard
+	// mfaAttempts counts wrong two-factor codes per user
+	mfaAttempts *lockout.Limiter
+	// limit rate limits every route, by user on those that need signing in
+	limit fiber.Handler
+}
+
+// NewAuthService returns an AuthService keeping accounts in store and failed
+// logins and two-factor attempts in attempts, and rate limiting requests with
+// limit
+func NewAuthService(store repository.Store, mail mailer.Mailer, attempts lockout.Store, limit fiber.Handler) *AuthService {
+	return &AuthService{
+		store:       store,
+		mail:        mail,
+		guard:       newLoginGuard(attempts),
+		mfaAttempts: lockout.New(attempts, "mfa:user:", lockout.EmailPolicy),
+		limit:       limit,
+	}
+}
+
 // RegisterAuthRoutes registers all authentication-related routes
-func RegisterAuthRoutes(app *fiber.App, db *sql.DB) {
-	// User signup endpoint
-	app.Post("/api/auth/signup", func(c *fiber.Ctx) error {
-		// Parse request body
-		type SignupRequest struct {
-			Name     string `json:"name"`
-			Email    string `json:"email"`
-			Password string `json:"password"`
-		}
+func RegisterAuthRoutes(app *fiber.App, db *sql.DB, mail mailer.Mailer, attempts lockout.Store, limit fiber.Handler) {
+	NewAuthService(repository.NewPostgresStore(db), mail, attempts, limit).Register(app)
+}
 
-		var req SignupRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid request format",
-			})
-		}
+// Register registers the service's routes
+func (s *AuthService) Register(router fiber.Router) {
+	// Routes for signing in are limited by client IP, the others after
+	// AuthMiddleware so each user has their own bucket
+	router.Post("/api/auth/signup", s.limit, s.signup)
+	router.Post("/api/auth/login", s.limit, s.login)
+	router.Post("/api/auth/refresh", s.limit, s.refresh)
+	router.Post("/api/auth/logout", s.limit, s.logout)
+	router.Get("/api/auth/me", middleware.AuthMiddleware(), s.limit, s.me)
 
-		// Validate input
-		if req.Name == "" || req.Email == "" || req.Password == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Name, email, and password are required",
-			})
-		}
+	// Register password reset routes
+	registerPasswordResetRoutes(router, s.store, s.mail, s.limit)
 
-		// Hash the password
-		hashedPassword, err := utils.HashPassword(req.Password)
-		if err != nil {
-			log.Printf("Error hashing password: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error processing your request",
-			})
-		}
+	// Register email verification routes
+	registerEmailVerificationRoutes(router, s.store, s.mail, s.limit)
 
-		// Insert user into database
-		var userID int
-		err = db.QueryRow(
-			"INSERT INTO users (name, email, password_hash) VALUES ($1, $2, $3) RETURNING id",
-			req.Name, req.Email, hashedPassword,
-		).Scan(&userID)
+	// Register session management routes
+	registerSessionRoutes(router, s.store, s.limit)
 
-		if err != nil {
-			log.Printf("Error creating user: %v", err)
-			// Check for duplicate email
-			if err.Error() == "pq: duplicate key value violates unique constraint \"users_email_key\"" {
-				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-					"error": "Email already in use",
-				})
-			}
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error creating user",
-			})
-		}
+	// Register two-factor authentication routes
+	registerMFARoutes(router, s.store, s.mfaAttempts, s.limit)
+}
 
-		// Generate JWT token
-		token, err := utils.GenerateJWT(userID)
-		if err != nil {
-			log.Printf("Error generating token: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error generating authentication token",
+// signup creates an account and signs it in
+func (s *AuthService) signup(c *fiber.Ctx) error {
+	// Parse request body
+	type SignupRequest struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	var req SignupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate input
+	if req.Name == "" || req.Email == "" || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Name, email, and password are required",
+		})
+	}
+	if err := utils.ValidatePassword(req.Password); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Hash the password
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
+
+	// Store the user
+	user, err := s.store.Users().Create(c.UserContext(), models.User{
+		Name:         req.Name,
+		Email:        req.Email,
+		PasswordHash: hashedPassword,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrEmailTaken) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Email already in use",
 			})
 		}
+		log.Printf("Error creating user: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error creating user",
+		})
+	}
 
-		// Return success with token
-		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-			"message": "User registered successfully",
-			"token":   token,
-			"user": fiber.Map{
-				"id":    userID,
-				"name":  req.Name,
-				"email": req.Email,
-			},
+	// Send the verification email, a failure here can be fixed with a resend
+	if err := sendVerificationEmail(c.UserContext(), s.store, s.mail, user.ID, user.Email); err != nil {
+		log.Printf("Error creating verification token: %v", err)
+	}
+
+	// Generate tokens, starting a new refresh token family
+	tokens, err := issueTokens(c, s.store, user.ID, user.TokenVersion, "")
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error generating authentication token",
 		})
+	}
+
+	// Return success with tokens
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":       "User registered successfully",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"user": fiber.Map{
+			"id":             user.ID,
+			"name":           user.Name,
+			"email":          user.Email,
+			"email_verified": user.EmailVerified,
+		},
 	})
+}
 
-	// User login endpoint
-	app.Post("/api/auth/login", func(c *fiber.Ctx) error {
-		// Parse request body
-		type LoginRequest struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
-		}
+// login signs a user in with their email address and password
+func (s *AuthService) login(c *fiber.Ctx) error {
+	// Parse request body
+	type LoginRequest struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
 
-		var req LoginRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid request format",
-			})
-		}
+	var req LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
 
-		// Validate input
-		if req.Email == "" || req.Password == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Email and password are required",
-			})
+	// Validate input
+	if req.Email == "" || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Email and password are required",
+		})
+	}
+
+	// Refuse locked out emails and IPs before spending time on bcrypt
+	wait, err := s.guard.wait(c.UserContext(), req.Email, c.IP())
+	if err != nil {
+		log.Printf("Error checking login lockout: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
+	if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
+	// Accounts created through a sign-in provider have no password until the
+	// user sets one, and never match
+	user, err := s.store.Users().ByEmail(c.UserContext(), req.Email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Printf("Error querying user: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
+
+	// Verify password, unknown emails count as failures too
+	if err != nil || !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
+		wait, err := s.guard.fail(c.UserContext(), req.Email, c.IP())
+		if err != nil {
+			log.Printf("Error recording failed login: %v", err)
+		}
+		// Say so as soon as the lock starts, not only on the next attempt
+		if wait > 0 {
+			return tooManyAttempts(c, wait)
 		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid email or password",
+		})
+	}
+
+	if err := s.guard.succeed(c.UserContext(), req.Email); err != nil {
+		log.Printf("Error clearing failed logins: %v", err)
+	}
+
+	// Only reveal the account's status to someone who knows its password
+	return finishLogin(c, s.store, user, fiber.StatusOK, "Login successful")
+}
 
-		// Query user from database
-		var userID int
-		var name string
-		var email string
-		var hashedPassword string
-		err := db.QueryRow(
-			"SELECT id, name, email, password_hash FROM users WHERE email = $1",
-			req.Email,
-		).Scan(&userID, &name, &email, &hashedPassword)
+// refresh exchanges a refresh token for a new access and refresh token
+func (s *AuthService) refresh(c *fiber.Ctx) error {
+	// Parse request body
+	type RefreshRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
 
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate input
+	if req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Refresh token is required",
+		})
+	}
+
+	ctx := c.UserContext()
+	var token repository.RefreshToken
+	var tokens authTokens
+	err := s.store.InTx(ctx, func(tx repository.Store) error {
+		// Lock the token so concurrent refreshes with it are serialized
+		var err error
+		token, err = tx.Tokens().RefreshToken(ctx, utils.HashToken(req.RefreshToken))
 		if err != nil {
-			if err == sql.ErrNoRows {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error": "Invalid email or password",
-				})
-			}
-			log.Printf("Error querying user: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error processing your request",
-			})
+			return err
 		}
 
-		// Verify password
-		if !utils.CheckPasswordHash(req.Password, hashedPassword) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid email or password",
-			})
+		// A token that was already rotated is being replayed, so it has leaked.
+		// Revoke the whole family, logging out both the thief and the user.
+		if token.Used {
+			return tx.Tokens().RevokeFamily(ctx, token.FamilyID)
+		}
+		if token.Revoked || token.Expired {
+			return errInvalidRefreshToken
 		}
 
-		// Generate JWT token
-		token, err := utils.GenerateJWT(userID)
+		// Rotate: mark the presented token used and issue its successor
+		if err := tx.Tokens().MarkRefreshTokenUsed(ctx, token.ID); err != nil {
+			return err
+		}
+		user, err := tx.Users().ByID(ctx, token.UserID)
 		if err != nil {
-			log.Printf("Error generating token: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error generating authentication token",
-			})
+			return err
 		}
+		tokens, err = issueTokens(c, tx, user.ID, user.TokenVersion, token.FamilyID)
+		return err
+	})
+
+	if errors.Is(err, repository.ErrNotFound) || errors.Is(err, errInvalidRefreshToken) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired refresh token",
+		})
+	}
+	if err != nil {
+		log.Printf("Error refreshing token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
+
+	if token.Used {
+		middleware.ForgetSession(token.FamilyID)
+		log.Printf("Refresh token reuse detected for user %d, revoked family %s", token.UserID, token.FamilyID)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Refresh token has already been used, please log in again",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// logout revokes the refresh token family of this session
+func (s *AuthService) logout(c *fiber.Ctx) error {
+	// Parse request body
+	type LogoutRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	var req LogoutRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate input
+	if req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Refresh token is required",
+		})
+	}
 
-		// Return success with token
+	// Unknown tokens are ignored so logout is idempotent
+	token, err := s.store.Tokens().RefreshToken(c.UserContext(), utils.HashToken(req.RefreshToken))
+	if errors.Is(err, repository.ErrNotFound) {
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"message": "Login successful",
-			"token":   token,
-			"user": fiber.Map{
-				"id":    userID,
-				"name":  name,
-				"email": email,
-			},
+			"message": "Logged out successfully",
 		})
+	}
+	if err != nil {
+		log.Printf("Error querying refresh token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
+
+	if err := s.store.Tokens().RevokeFamily(c.UserContext(), token.FamilyID); err != nil {
+		log.Printf("Error revoking refresh token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
+	middleware.ForgetSession(token.FamilyID)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Logged out successfully",
 	})
+}
 
-	// Get current user endpoint (protected)
-	app.Get("/api/auth/me", func(c *fiber.Ctx) error {
-		// Get the Authorization header
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Authorization header is required",
-			})
-		}
+// me returns the signed-in user
+func (s *AuthService) me(c *fiber.Ctx) error {
+	// Get the caller from context (set by AuthMiddleware)
+	principal := middleware.CurrentPrincipal(c)
 
-		// Extract the token
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid authorization format",
+	user, err := s.store.Users().ByID(c.UserContext(), principal.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
 			})
 		}
+		log.Printf("Error querying user: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
 
-		// Validate the token
-		userID, err := utils.ValidateJWT(tokenParts[1])
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid or expired token",
-			})
+	// Return user data
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"user": fiber.Map{
+			"id":             user.ID,
+			"name":           user.Name,
+			"email":          user.Email,
+			"email_verified": user.EmailVerified,
+			"roles":          principal.Roles,
+		},
+	})
+}
+
+// authTokens is the access and refresh token pair handed to a client
+type authTokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+}
+
+// issueTokens creates an access token and stores the hash of a new refresh
+// token. An empty familyID starts a new family, as on login. The family
+// identifies the login, so it doubles as the session ID.
+func issueTokens(c *fiber.Ctx, store repository.Store, userID, tokenVersion int, familyID string) (authTokens, error) {
+	ctx := c.UserContext()
+	var err error
+	if familyID == "" {
+		if familyID, err = utils.RandomToken(16); err != nil {
+			return authTokens{}, err
 		}
+	}
+	if err := store.Tokens().TouchSession(ctx, familyID, userID, sessionUserAgent(c), c.IP()); err != nil {
+		return authTokens{}, err
+	}
+
+	// Every access token carries the roles granted to its user
+	user, err := store.Users().ByID(ctx, userID)
+	if err != nil {
+		return authTokens{}, err
+	}
+	accessToken, err := utils.GenerateJWT(userID, tokenVersion, familyID, []string{user.Role})
+	if err != nil {
+		return authTokens{}, err
+	}
 
-		// Query user from database
-		var name string
-		var email string
-		err = db.QueryRow(
-			"SELECT name, email FROM users WHERE id = $1",
-			userID,
-		).Scan(&name, &email)
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return authTokens{}, err
+	}
 
+	err = store.Tokens().CreateRefreshToken(ctx, userID, familyID, utils.HashToken(refreshToken), utils.RefreshTokenTTL)
+	if err != nil {
+		return authTokens{}, err
+	}
+
+	return authTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// finishLogin completes a login once the user has proven who they are,
+// refusing disabled accounts and those awaiting a forced password reset. With
+// two-factor authentication enabled it only hands out an MFA pending token,
+// which POST /api/auth/mfa/verify exchanges along with a code.
+func finishLogin(c *fiber.Ctx, store repository.Store, user models.User, status int, message string) error {
+	if user.DisabledAt != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "This account has been disabled",
+		})
+	}
+	if user.PasswordResetRequired {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":                   "A password reset is required, check your email for a reset link",
+			"password_reset_required": true,
+		})
+	}
+
+	if user.MFAEnabled {
+		mfaToken, err := utils.GenerateMFAPendingJWT(user.ID, user.TokenVersion)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-					"error": "User not found",
-				})
-			}
-			log.Printf("Error querying user: %v", err)
+			log.Printf("Error generating token: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error processing your request",
+				"error": "Error generating authentication token",
 			})
 		}
 
-		// Return user data
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"user": fiber.Map{
-				"id":    userID,
-				"name":  name,
-				"email": email,
-			},
+			"message":      "Two-factor authentication required",
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
 		})
+	}
+
+	// Generate tokens, starting a new refresh token family
+	tokens, err := issueTokens(c, store, user.ID, user.TokenVersion, "")
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error generating authentication token",
+		})
+	}
+
+	// Return success with tokens
+	return c.Status(status).JSON(fiber.Map{
+		"message":       message,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"user": fiber.Map{
+			"id":             user.ID,
+			"name":           user.Name,
+			"email":          user.Email,
+			"email_verified": user.EmailVerified,
+		},
 	})
 }
@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/lockout"
+	"github.com/kevinlucasklein/zero-balance/models"
+)
+
+func TestLoginLockout(t *testing.T) {
+	at := newAuthTest(t)
+	at.store.AddUser(models.User{
+		Name:          "Ada",
+		Email:         "ada@example.com",
+		PasswordHash:  passwordHash(t, "correct-horse-battery-9"),
+		EmailVerified: true,
+	})
+	login := func(password string) (int, map[string]interface{}) {
+		return request(t, at.app, fiber.MethodPost, "/api/auth/login", "", map[string]string{
+			"email":    "ada@example.com",
+			"password": password,
+		})
+	}
+
+	for i := 1; i < lockout.EmailPolicy.Threshold; i++ {
+		if status, body := login("wrong-password-1"); status != fiber.StatusUnauthorized {
+			t.Fatalf("failure %d status = %d, want %d, body %v", i, status, fiber.StatusUnauthorized, body)
+		}
+	}
+
+	// The failure that starts the lock reports it
+	status, body := login("wrong-password-1")
+	if status != fiber.StatusTooManyRequests || body["retry_after"] != float64(30) {
+		t.Fatalf("locking failure status = %d, body %v, want %d retrying after 30s", status, body, fiber.StatusTooManyRequests)
+	}
+
+	// The right password is refused until the lock ends
+	if status, body := login("correct-horse-battery-9"); status != fiber.StatusTooManyRequests {
+		t.Fatalf("locked login status = %d, want %d, body %v", status, fiber.StatusTooManyRequests, body)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	at := newAuthTest(t)
+	at.store.AddUser(models.User{
+		Name:          "Ada",
+		Email:         "ada@example.com",
+		PasswordHash:  passwordHash(t, "correct-horse-battery-9"),
+		EmailVerified: true,
+	})
+	status, body := request(t, at.app, fiber.MethodPost, "/api/auth/login", "", map[string]string{
+		"email":    "ada@example.com",
+		"password": "correct-horse-battery-9",
+	})
+	if status != fiber.StatusOK {
+		t.Fatalf("login status = %d, want %d, body %v", status, fiber.StatusOK, body)
+	}
+	refresh := func(token interface{}) (int, map[string]interface{}) {
+		return request(t, at.app, fiber.MethodPost, "/api/auth/refresh", "", map[string]interface{}{
+			"refresh_token": token,
+		})
+	}
+
+	first := body["refresh_token"]
+	status, body = refresh(first)
+	if status != fiber.StatusOK || body["refresh_token"] == first {
+		t.Fatalf("refresh status = %d, body %v, want a new refresh token", status, body)
+	}
+	second, access := body["refresh_token"], body["token"].(string)
+
+	// Replaying the rotated token revokes the whole family, successor included
+	if status, body := refresh(first); status != fiber.StatusUnauthorized {
+		t.Fatalf("reused token status = %d, want %d, body %v", status, fiber.StatusUnauthorized, body)
+	}
+	if status, body := refresh(second); status != fiber.StatusUnauthorized {
+		t.Fatalf("successor after reuse status = %d, want %d, body %v", status, fiber.StatusUnauthorized, body)
+	}
+	if status, body := request(t, at.app, fiber.MethodGet, "/api/auth/me", access, nil); status != fiber.StatusUnauthorized {
+		t.Fatalf("access token after reuse status = %d, want %d, body %v", status, fiber.StatusUnauthorized, body)
+	}
+}
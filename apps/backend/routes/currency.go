@@ -0,0 +1,214 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/money"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+// ExchangeRate represents a row of the exchange_rates table
+type ExchangeRate = models.ExchangeRate
+
+// errNoExchangeRate is returned when two currencies have no stored rate in either direction
+var errNoExchangeRate = errors.New("no exchange rate")
+
+// rateTable holds the stored exchange rates keyed by [base, quote]
+type rateTable map[[2]string]money.ExchangeRate
+
+// convert converts an amount between currencies using the direct rate, or the
+// inverse of the opposite rate when only that one is stored
+func (t rateTable) convert(amount money.Amount, from, to string) (money.Amount, error) {
+	if from == to {
+		return amount, nil
+	}
+	if rate, ok := t[[2]string{from, to}]; ok {
+		return money.Convert(amount, rate), nil
+	}
+	if rate, ok := t[[2]string{to, from}]; ok {
+		return money.ConvertInverse(amount, rate), nil
+	}
+	return 0, fmt.Errorf("%w from %s to %s", errNoExchangeRate, from, to)
+}
+
+// newRateTable indexes exchange rates by currency pair
+func newRateTable(rates []ExchangeRate) rateTable {
+	table := rateTable{}
+	for _, rate := range rates {
+		table[[2]string{rate.BaseCurrency, rate.QuoteCurrency}] = rate.Rate
+	}
+	return table
+}
+
+// normalizeCurrencyField upper-cases an optional currency code in place and
+// returns a user-facing error message if it is not a supported ISO 4217 code
+func normalizeCurrencyField(currency *string) string {
+	if *currency == "" {
+		return ""
+	}
+	code, ok := money.NormalizeCurrency(*currency)
+	if !ok {
+		return "Currency must be an ISO 4217 code with two decimal places, such as USD or EUR"
+	}
+	*currency = code
+	return ""
+}
+
+// ExchangeRateService serves the exchange rates, which any user can read and
+// only admins can change
+type ExchangeRateService struct {
+	store repository.Store
+}
+
+// NewExchangeRateService returns an ExchangeRateService keeping rates in store
+func NewExchangeRateService(store repository.Store) *ExchangeRateService {
+	return &ExchangeRateService{store: store}
+}
+
+// RegisterExchangeRateRoutes registers the exchange rate routes. Any user can
+// read the rates, only admins can change them.
+func RegisterExchangeRateRoutes(app *fiber.App, db *sql.DB) {
+	s := NewExchangeRateService(repository.NewPostgresStore(db))
+
+	// List exchange rates
+	app.Get("/api/exchange-rates", middleware.AuthMiddleware(), s.list)
+
+	// Create an admin group for rate maintenance
+	adminGroup := app.Group("/api/admin/exchange-rates")
+	adminGroup.Use(middleware.AuthMiddleware())
+	adminGroup.Use(middleware.RequireRole(middleware.RoleAdmin))
+
+	s.RegisterAdmin(adminGroup)
+}
+
+// RegisterAdmin registers the rate maintenance routes on a group that already
+// runs AuthMiddleware and only lets admins through
+func (s *ExchangeRateService) RegisterAdmin(router fiber.Router) {
+	router.Put("/", s.save)
+	router.Delete("/:base/:quote", s.delete)
+}
+
+// list lists every exchange rate
+func (s *ExchangeRateService) list(c *fiber.Ctx) error {
+	rates, err := s.store.ExchangeRates().List(c.UserContext())
+	if err != nil {
+		log.Printf("Error querying exchange rates: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving exchange rates",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"exchange_rates": rates,
+	})
+}
+
+// save creates or replaces an exchange rate
+func (s *ExchangeRateService) save(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	// Parse request body
+	type RateRequest struct {
+		BaseCurrency  string              `json:"base_currency"`
+		QuoteCurrency string              `json:"quote_currency"`
+		Rate          *money.ExchangeRate `json:"rate"`
+	}
+
+	var req RateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate input
+	base, okBase := money.NormalizeCurrency(req.BaseCurrency)
+	quote, okQuote := money.NormalizeCurrency(req.QuoteCurrency)
+	if !okBase || !okQuote {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Base and quote currency must be ISO 4217 codes with two decimal places",
+		})
+	}
+	if base == quote {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Base and quote currency must differ",
+		})
+	}
+	if req.Rate == nil || *req.Rate <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Rate must be a positive number",
+		})
+	}
+
+	ctx := c.UserContext()
+	var rate ExchangeRate
+	err := s.store.InTx(ctx, func(tx repository.Store) error {
+		event := auditEvent(c, 0, "exchange_rate.save", "exchange_rate", base+"/"+quote)
+
+		// Load the rate being replaced, if any, for the audit log
+		before, err := tx.ExchangeRates().ByPairForUpdate(ctx, base, quote)
+		switch {
+		case err == nil:
+			event.Before = before
+		case !errors.Is(err, repository.ErrNotFound):
+			return err
+		}
+
+		rate, err = tx.ExchangeRates().Save(ctx, base, quote, *req.Rate, userID)
+		if err != nil {
+			return err
+		}
+		event.After = rate
+		return tx.AuditEvents().Record(ctx, event)
+	})
+	if err != nil {
+		log.Printf("Error saving exchange rate: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error saving exchange rate",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":       "Exchange rate saved successfully",
+		"exchange_rate": rate,
+	})
+}
+
+// delete deletes an exchange rate
+func (s *ExchangeRateService) delete(c *fiber.Ctx) error {
+	base, _ := money.NormalizeCurrency(c.Params("base"))
+	quote, _ := money.NormalizeCurrency(c.Params("quote"))
+
+	ctx := c.UserContext()
+	err := s.store.InTx(ctx, func(tx repository.Store) error {
+		rate, err := tx.ExchangeRates().Delete(ctx, base, quote)
+		if err != nil {
+			return err
+		}
+
+		event := auditEvent(c, 0, "exchange_rate.delete", "exchange_rate", base+"/"+quote)
+		event.Before = rate
+		return tx.AuditEvents().Record(ctx, event)
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Exchange rate not found",
+			})
+		}
+		log.Printf("Error deleting exchange rate: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error deleting exchange rate",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Exchange rate deleted successfully",
+	})
+}
@@ -0,0 +1,404 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/money"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+// Limits mirroring the column definitions of the debts table
+const (
+	maxCreditorNameLength = 100
+	dateLayout            = models.DateLayout
+)
+
+// debtRequest is the body accepted when creating or updating a debt
+type debtRequest struct {
+	CreditorName   string        `json:"creditor_name"`
+	Amount         *money.Amount `json:"amount"`
+	Currency       string        `json:"currency"`
+	InterestRate   *money.Rate   `json:"interest_rate"`
+	MinimumPayment *money.Amount `json:"minimum_payment"`
+	DueDate        string        `json:"due_date"`
+	Status         string        `json:"status"`
+}
+
+// DebtService serves the signed-in user's debts and the payments made against them
+type DebtService struct {
+	store repository.Store
+}
+
+// NewDebtService returns a DebtService keeping debts in store
+func NewDebtService(store repository.Store) *DebtService {
+	return &DebtService{store: store}
+}
+
+// RegisterDebtRoutes registers all debt-related routes
+func RegisterDebtRoutes(app *fiber.App, db *sql.DB) {
+	// Create a debts group with authentication middleware
+	debtGroup := app.Group("/api/debts")
+	debtGroup.Use(middleware.AuthMiddleware())
+
+	NewDebtService(repository.NewPostgresStore(db)).Register(debtGroup)
+}
+
+// Register registers the service's routes on a group that already runs
+// AuthMiddleware
+func (s *DebtService) Register(router fiber.Router) {
+	router.Get("/", s.list)
+	router.Get("/:id", s.get)
+	router.Post("/", s.create)
+	router.Put("/:id", s.update)
+	router.Put("/:id/paid-off", s.markPaidOff)
+	router.Delete("/:id", s.delete)
+
+	// Register payments nested under /api/debts/:id/payments
+	s.registerPaymentRoutes(router)
+}
+
+// list lists the user's debts, optionally filtered by status
+func (s *DebtService) list(c *fiber.Ctx) error {
+	// Get user ID from context (set by AuthMiddleware)
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	status := c.Query("status")
+	if status != "" && !isValidDebtStatus(status) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Status must be 'active' or 'paid_off'",
+		})
+	}
+
+	debts, err := s.store.Debts().ListByStatus(c.UserContext(), userID, status)
+	if err != nil {
+		log.Printf("Error querying debts: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving debts",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"debts": debts,
+	})
+}
+
+// get returns a single debt
+func (s *DebtService) get(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	debtID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid debt ID",
+		})
+	}
+
+	debt, err := s.store.Debts().ByID(c.UserContext(), userID, debtID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Debt not found",
+			})
+		}
+		log.Printf("Error querying debt: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving debt",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"debt": debt,
+	})
+}
+
+// create creates a debt
+func (s *DebtService) create(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	var req debtRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if req.Status == "" {
+		req.Status = "active"
+	}
+	if msg := validateDebtRequest(&req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	ctx := c.UserContext()
+	var debt Debt
+	err := s.store.InTx(ctx, func(tx repository.Store) error {
+		// Debts default to the user's base currency
+		var err error
+		debt, err = tx.Debts().Create(ctx, req.debt(userID, 0))
+		if err != nil {
+			return err
+		}
+		return tx.AuditEvents().Record(ctx, changeEvent(c, userID, "debt.create", "debt", debt.ID, nil, debt))
+	})
+	if err != nil {
+		log.Printf("Error creating debt: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error creating debt",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Debt created successfully",
+		"debt":    debt,
+	})
+}
+
+// update replaces a debt's details
+func (s *DebtService) update(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	debtID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid debt ID",
+		})
+	}
+
+	var req debtRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	ctx := c.UserContext()
+	var debt Debt
+	err = s.store.InTx(ctx, func(tx repository.Store) error {
+		// Lock the debt, its current state goes into the audit log
+		before, err := tx.Debts().ByIDForUpdate(ctx, userID, debtID)
+		if err != nil {
+			return err
+		}
+
+		// Keep the current status unless the client sends a new one
+		if req.Status == "" {
+			req.Status = before.Status
+		}
+		if msg := validateDebtRequest(&req); msg != "" {
+			return invalidRequest(msg)
+		}
+
+		// Payments are recorded in the debt's currency, so it is fixed at creation
+		if req.Currency != "" && req.Currency != before.Currency {
+			return invalidRequest("Currency cannot be changed after a debt is created")
+		}
+
+		debt, err = tx.Debts().Update(ctx, req.debt(userID, debtID))
+		if err != nil {
+			return err
+		}
+		return tx.AuditEvents().Record(ctx, changeEvent(c, userID, "debt.update", "debt", debt.ID, before, debt))
+	})
+	var invalid invalidRequest
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Debt not found",
+		})
+	case errors.As(err, &invalid):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": invalid.Error(),
+		})
+	case err != nil:
+		log.Printf("Error updating debt: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error updating debt",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Debt updated successfully",
+		"debt":    debt,
+	})
+}
+
+// markPaidOff marks a debt as paid off
+func (s *DebtService) markPaidOff(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	debtID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid debt ID",
+		})
+	}
+
+	ctx := c.UserContext()
+	var debt Debt
+	err = s.store.InTx(ctx, func(tx repository.Store) error {
+		before, err := tx.Debts().ByIDForUpdate(ctx, userID, debtID)
+		if err != nil {
+			return err
+		}
+
+		// Only active debts can transition to paid_off
+		if before.Status != "active" {
+			return errDebtPaidOff
+		}
+
+		paidOff := before
+		paidOff.Status = "paid_off"
+		debt, err = tx.Debts().Update(ctx, paidOff)
+		if err != nil {
+			return err
+		}
+		return tx.AuditEvents().Record(ctx, changeEvent(c, userID, "debt.paid_off", "debt", debt.ID, before, debt))
+	})
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Debt not found",
+		})
+	case errors.Is(err, errDebtPaidOff):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Debt is already paid off",
+		})
+	case err != nil:
+		log.Printf("Error marking debt as paid off: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error updating debt",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Debt marked as paid off",
+		"debt":    debt,
+	})
+}
+
+// delete deletes a debt along with its payments
+func (s *DebtService) delete(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	debtID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid debt ID",
+		})
+	}
+
+	ctx := c.UserContext()
+	err = s.store.InTx(ctx, func(tx repository.Store) error {
+		debt, err := tx.Debts().Delete(ctx, userID, debtID)
+		if err != nil {
+			return err
+		}
+		return tx.AuditEvents().Record(ctx, changeEvent(c, userID, "debt.delete", "debt", debt.ID, debt, nil))
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Debt not found",
+			})
+		}
+		log.Printf("Error deleting debt: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error deleting debt",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Debt deleted successfully",
+	})
+}
+
+// Debt represents a row of the debts table
+type Debt = models.Debt
+
+// invalidRequest is returned from a transaction when a request turns out to
+// be invalid against the stored state, with the message to show
+type invalidRequest string
+
+func (e invalidRequest) Error() string {
+	return string(e)
+}
+
+// debt returns the debt a validated request describes
+func (req *debtRequest) debt(userID, id int) Debt {
+	return Debt{
+		ID:             id,
+		UserID:         userID,
+		CreditorName:   req.CreditorName,
+		Amount:         *req.Amount,
+		Currency:       req.Currency,
+		InterestRate:   *req.InterestRate,
+		MinimumPayment: *req.MinimumPayment,
+		DueDate:        req.DueDate,
+		Status:         req.Status,
+	}
+}
+
+// validateDebtRequest checks a debt request against the debts table constraints
+// and returns a user-facing error message, or an empty string if it is valid
+func validateDebtRequest(req *debtRequest) string {
+	req.CreditorName = strings.TrimSpace(req.CreditorName)
+	if req.CreditorName == "" || req.Amount == nil || req.MinimumPayment == nil || req.DueDate == "" {
+		return "Creditor name, amount, minimum payment, and due date are required"
+	}
+	if utf8.RuneCountInString(req.CreditorName) > maxCreditorNameLength {
+		return "Creditor name must be at most 100 characters"
+	}
+	if !isValidAmount(*req.Amount) {
+		return "Amount must be between 0 and 99999999.99"
+	}
+	if req.InterestRate == nil {
+		var zero money.Rate
+		req.InterestRate = &zero
+	}
+	if *req.InterestRate < 0 || *req.InterestRate > money.MaxRate {
+		return "Interest rate must be between 0 and 999.99"
+	}
+	if !isValidAmount(*req.MinimumPayment) {
+		return "Minimum payment must be between 0 and 99999999.99"
+	}
+	if _, err := time.Parse(dateLayout, req.DueDate); err != nil {
+		return "Due date must be in YYYY-MM-DD format"
+	}
+	if !isValidDebtStatus(req.Status) {
+		return "Status must be 'active' or 'paid_off'"
+	}
+	if msg := normalizeCurrencyField(&req.Currency); msg != "" {
+		return msg
+	}
+	return ""
+}
+
+// isValidDebtStatus mirrors the CHECK constraint on debts.status
+func isValidDebtStatus(status string) bool {
+	return status == "active" || status == "paid_off"
+}
+
+// isValidAmount reports whether amount is non-negative and fits a DECIMAL(10,2) column
+func isValidAmount(amount money.Amount) bool {
+	return amount >= 0 && amount <= money.MaxAmount
+}
+
+// parseIDParam parses the ":id" route parameter as a positive integer
+func parseIDParam(c *fiber.Ctx) (int, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil || id <= 0 {
+		return 0, fiber.ErrBadRequest
+	}
+	return id, nil
+}
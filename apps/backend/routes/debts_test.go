@@ -0,0 +1,92 @@
+package routes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+// newDebtTest returns an app serving a DebtService over store
+func newDebtTest(store repository.Store) *fiber.App {
+	app := newTestApp()
+	NewDebtService(store).Register(app.Group("/api/debts", middleware.AuthMiddleware()))
+	return app
+}
+
+func TestDebtLifecycle(t *testing.T) {
+	store := repository.NewMemoryStore()
+	app := newDebtTest(store)
+	user := store.AddUser(models.User{Name: "Ada", Email: "ada@example.com", BaseCurrency: "EUR"})
+	other := store.AddUser(models.User{Name: "Bob", Email: "bob@example.com", BaseCurrency: "USD"})
+	token := accessToken(t, store, user.ID)
+
+	debtBody := map[string]interface{}{
+		"creditor_name":   "Bank",
+		"amount":          "1000.00",
+		"interest_rate":   "5.5",
+		"minimum_payment": "50.00",
+		"due_date":        "2025-01-15",
+	}
+	status, body := request(t, app, fiber.MethodPost, "/api/debts/", token, debtBody)
+	if status != fiber.StatusCreated {
+		t.Fatalf("create status = %d, want %d, body %v", status, fiber.StatusCreated, body)
+	}
+	debt := body["debt"].(map[string]interface{})
+	if debt["currency"] != "EUR" || debt["status"] != "active" {
+		t.Fatalf("created debt %v, want an active debt in the base currency EUR", debt)
+	}
+	path := fmt.Sprintf("/api/debts/%v", debt["id"])
+
+	debtBody["currency"] = "USD"
+	if status, body := request(t, app, fiber.MethodPut, path, token, debtBody); status != fiber.StatusBadRequest {
+		t.Fatalf("currency change status = %d, want %d, body %v", status, fiber.StatusBadRequest, body)
+	}
+	delete(debtBody, "currency")
+	debtBody["amount"] = "800.00"
+	status, body = request(t, app, fiber.MethodPut, path, token, debtBody)
+	if status != fiber.StatusOK || body["debt"].(map[string]interface{})["amount"] != "800.00" {
+		t.Fatalf("update status = %d, body %v, want the new amount", status, body)
+	}
+
+	if status, body := request(t, app, fiber.MethodGet, path, accessToken(t, store, other.ID), nil); status != fiber.StatusNotFound {
+		t.Fatalf("other user's get status = %d, want %d, body %v", status, fiber.StatusNotFound, body)
+	}
+
+	if status, body := request(t, app, fiber.MethodPut, path+"/paid-off", token, nil); status != fiber.StatusOK {
+		t.Fatalf("paid off status = %d, want %d, body %v", status, fiber.StatusOK, body)
+	}
+	if status, body := request(t, app, fiber.MethodPut, path+"/paid-off", token, nil); status != fiber.StatusConflict {
+		t.Fatalf("second paid off status = %d, want %d, body %v", status, fiber.StatusConflict, body)
+	}
+	for query, want := range map[string]int{"active": 0, "paid_off": 1} {
+		status, body := request(t, app, fiber.MethodGet, "/api/debts/?status="+query, token, nil)
+		if status != fiber.StatusOK || len(body["debts"].([]interface{})) != want {
+			t.Fatalf("%s debts: status %d, body %v, want %d debts", query, status, body, want)
+		}
+	}
+
+	if status, body := request(t, app, fiber.MethodDelete, path, token, nil); status != fiber.StatusOK {
+		t.Fatalf("delete status = %d, want %d, body %v", status, fiber.StatusOK, body)
+	}
+	if status, body := request(t, app, fiber.MethodGet, path, token, nil); status != fiber.StatusNotFound {
+		t.Fatalf("get after delete status = %d, want %d, body %v", status, fiber.StatusNotFound, body)
+	}
+
+	var actions []string
+	for _, event := range store.AuditLog() {
+		actions = append(actions, event.Action)
+	}
+	want := []string{"debt.create", "debt.update", "debt.paid_off", "debt.delete"}
+	if len(actions) != len(want) {
+		t.Fatalf("audit log %v, want %v", actions, want)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Fatalf("audit log %v, want %v", actions, want)
+		}
+	}
+}
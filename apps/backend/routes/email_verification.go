@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/mailer"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/repository"
+	"github.com/kevinlucasklein/zero-balance/utils"
+)
+
+// emailVerificationTTL is how long an emailed verification link stays valid
+const emailVerificationTTL = 24 * time.Hour
+
+// registerEmailVerificationRoutes registers the verify and resend routes, rate
+// limited with limit
+func registerEmailVerificationRoutes(router fiber.Router, store repository.Store, mail mailer.Mailer, limit fiber.Handler) {
+	// Verify an email address, either from the emailed link or by the frontend
+	verify := func(c *fiber.Ctx, token string) error {
+		if token == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Token is required",
+			})
+		}
+
+		err := store.InTx(c.UserContext(), func(tx repository.Store) error {
+			// Consume the token first so it cannot be used twice
+			userID, err := tx.Tokens().UseEmailVerificationToken(c.UserContext(), utils.HashToken(token))
+			if err != nil {
+				return err
+			}
+			return tx.Users().MarkEmailVerified(c.UserContext(), userID)
+		})
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid or expired verification token",
+				})
+			}
+			log.Printf("Error verifying email: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Email verified successfully",
+		})
+	}
+
+	router.Get("/api/auth/verify-email", limit, func(c *fiber.Ctx) error {
+		return verify(c, c.Query("token"))
+	})
+
+	router.Post("/api/auth/verify-email", limit, func(c *fiber.Ctx) error {
+		// Parse request body
+		type VerifyEmailRequest struct {
+			Token string `json:"token"`
+		}
+
+		var req VerifyEmailRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request format",
+			})
+		}
+
+		return verify(c, req.Token)
+	})
+
+	// Send a new verification email to the signed-in user
+	router.Post("/api/auth/resend-verification", middleware.AuthMiddleware(), limit, func(c *fiber.Ctx) error {
+		// Get user ID from context (set by AuthMiddleware)
+		userID := middleware.CurrentPrincipal(c).UserID
+
+		user, err := store.Users().ByID(c.UserContext(), userID)
+		if err != nil {
+			log.Printf("Error querying user: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+
+		if user.EmailVerified {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Email is already verified",
+			})
+		}
+
+		if err := sendVerificationEmail(c.UserContext(), store, mail, userID, user.Email); err != nil {
+			log.Printf("Error creating verification token: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Verification email sent",
+		})
+	})
+}
+
+// sendVerificationEmail replaces any outstanding verification token for a
+// user with a new one and emails its link in the background
+func sendVerificationEmail(ctx context.Context, store repository.Store, mail mailer.Mailer, userID int, email string) error {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = store.InTx(ctx, func(tx repository.Store) error {
+		return tx.Tokens().ReplaceEmailVerificationToken(ctx, userID, utils.HashToken(token), emailVerificationTTL)
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Verify your ZeroBalance email address",
+		Body: fmt.Sprintf(
+			"Welcome to ZeroBalance!\n\n"+
+				"Open this link within %d hours to verify your email address:\n%s\n\n"+
+				"If you did not create an account, you can ignore this email.",
+			int(emailVerificationTTL.Hours()), appLink("/verify-email", token),
+		),
+	}
+	go func() {
+		if err := mail.Send(msg); err != nil {
+			log.Printf("Error sending verification email: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/models"
+)
+
+// resendVerification asks for a verification email and returns the emailed token
+func (a *authTest) resendVerification(t *testing.T, token string) string {
+	t.Helper()
+	status, body := request(t, a.app, fiber.MethodPost, "/api/auth/resend-verification", token, nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("resend verification: status %d, body %v", status, body)
+	}
+	return emailedToken(t, a.mail.next(t))
+}
+
+func TestVerifyEmail(t *testing.T) {
+	// Verify either by following the emailed link or through the frontend
+	byLink := func(t *testing.T, a *authTest, token string) (int, map[string]interface{}) {
+		return request(t, a.app, fiber.MethodGet, "/api/auth/verify-email?token="+url.QueryEscape(token), "", nil)
+	}
+	byPost := func(t *testing.T, a *authTest, token string) (int, map[string]interface{}) {
+		return request(t, a.app, fiber.MethodPost, "/api/auth/verify-email", "", fiber.Map{"token": token})
+	}
+
+	tests := []struct {
+		name   string
+		verify func(t *testing.T, a *authTest, token string) (int, map[string]interface{})
+		// tokens requests the verification tokens and returns the ones used
+		// in turn, the last of which must get wantStatus
+		tokens       func(t *testing.T, a *authTest, accessToken string) []string
+		wantStatus   int
+		wantVerified bool
+	}{
+		{
+			name:   "emailed link",
+			verify: byLink,
+			tokens: func(t *testing.T, a *authTest, accessToken string) []string {
+				return []string{a.resendVerification(t, accessToken)}
+			},
+			wantStatus:   fiber.StatusOK,
+			wantVerified: true,
+		},
+		{
+			name:   "posted by the frontend",
+			verify: byPost,
+			tokens: func(t *testing.T, a *authTest, accessToken string) []string {
+				return []string{a.resendVerification(t, accessToken)}
+			},
+			wantStatus:   fiber.StatusOK,
+			wantVerified: true,
+		},
+		{
+			name:   "token used twice",
+			verify: byPost,
+			tokens: func(t *testing.T, a *authTest, accessToken string) []string {
+				token := a.resendVerification(t, accessToken)
+				return []string{token, token}
+			},
+			wantStatus:   fiber.StatusBadRequest,
+			wantVerified: true,
+		},
+		{
+			name:   "token replaced by a newer one",
+			verify: byLink,
+			tokens: func(t *testing.T, a *authTest, accessToken string) []string {
+				first := a.resendVerification(t, accessToken)
+				a.resendVerification(t, accessToken)
+				return []string{first}
+			},
+			wantStatus: fiber.StatusBadRequest,
+		},
+		{
+			name:   "unknown token",
+			verify: byLink,
+			tokens: func(t *testing.T, a *authTest, accessToken string) []string {
+				return []string{"made-up"}
+			},
+			wantStatus: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthTest(t)
+			user := a.store.AddUser(models.User{Name: "Ada", Email: "ada@example.com"})
+
+			var status int
+			var body map[string]interface{}
+			for _, token := range tt.tokens(t, a, accessToken(t, a.store, user.ID)) {
+				status, body = tt.verify(t, a, token)
+			}
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %v", status, tt.wantStatus, body)
+			}
+
+			stored, err := a.store.Users().ByID(context.Background(), user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.EmailVerified != tt.wantVerified {
+				t.Fatalf("email verified = %v, want %v", stored.EmailVerified, tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestResendVerificationWhenVerified(t *testing.T) {
+	a := newAuthTest(t)
+	user := a.store.AddUser(models.User{Name: "Ada", Email: "ada@example.com", EmailVerified: true})
+
+	status, body := request(t, a.app, fiber.MethodPost, "/api/auth/resend-verification", accessToken(t, a.store, user.ID), nil)
+	if status != fiber.StatusConflict {
+		t.Fatalf("status = %d, want %d, body %v", status, fiber.StatusConflict, body)
+	}
+	a.mail.noneSent(t)
+}
@@ -0,0 +1,426 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/money"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+const maxSourceNameLength = 100
+
+// IncomeSource represents a row of the income_sources table
+type IncomeSource = models.IncomeSource
+
+// incomeRequest is the body accepted when creating or updating an income source
+type incomeRequest struct {
+	SourceName  string        `json:"source_name"`
+	Amount      *money.Amount `json:"amount"`
+	Currency    string        `json:"currency"`
+	Frequency   string        `json:"frequency"`
+	NextPayDate string        `json:"next_pay_date"`
+}
+
+// IncomeService serves the signed-in user's income sources
+type IncomeService struct {
+	store repository.Store
+}
+
+// NewIncomeService returns an IncomeService keeping income sources in store
+func NewIncomeService(store repository.Store) *IncomeService {
+	return &IncomeService{store: store}
+}
+
+// RegisterIncomeRoutes registers all income-related routes
+func RegisterIncomeRoutes(app *fiber.App, db *sql.DB) {
+	// Create an income group with authentication middleware
+	incomeGroup := app.Group("/api/income")
+	incomeGroup.Use(middleware.AuthMiddleware())
+
+	NewIncomeService(repository.NewPostgresStore(db)).Register(incomeGroup)
+}
+
+// Register registers the service's routes on a group that already runs
+// AuthMiddleware
+func (s *IncomeService) Register(router fiber.Router) {
+	router.Get("/", s.list)
+	router.Get("/:id", s.get)
+	router.Post("/", s.create)
+	router.Put("/:id", s.update)
+	router.Put("/:id/advance", s.advance)
+	router.Delete("/:id", s.delete)
+}
+
+// list lists income sources ordered by the next payday
+func (s *IncomeService) list(c *fiber.Ctx) error {
+	// Get user ID from context (set by AuthMiddleware)
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	sources, err := s.store.IncomeSources().ListByNextPayDate(c.UserContext(), userID)
+	if err != nil {
+		log.Printf("Error querying income sources: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving income sources",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"income_sources": sources,
+	})
+}
+
+// get returns a single income source
+func (s *IncomeService) get(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	sourceID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid income source ID",
+		})
+	}
+
+	source, err := s.store.IncomeSources().ByID(c.UserContext(), userID, sourceID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Income source not found",
+			})
+		}
+		log.Printf("Error querying income source: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving income source",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"income_source": source,
+	})
+}
+
+// create creates an income source
+func (s *IncomeService) create(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	var req incomeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	nextPayDate, msg := validateIncomeRequest(&req)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	ctx := c.UserContext()
+	var source IncomeSource
+	err := s.store.InTx(ctx, func(tx repository.Store) error {
+		// Income sources default to the user's base currency
+		var err error
+		source, err = tx.IncomeSources().Create(ctx, req.source(userID, 0, payDayFor(req.Frequency, nextPayDate)))
+		if err != nil {
+			return err
+		}
+		return tx.AuditEvents().Record(ctx, changeEvent(c, userID, "income.create", "income_source", source.ID, nil, source))
+	})
+	if err != nil {
+		log.Printf("Error creating income source: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error creating income source",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":       "Income source created successfully",
+		"income_source": source,
+	})
+}
+
+// update replaces an income source's details
+func (s *IncomeService) update(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	sourceID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid income source ID",
+		})
+	}
+
+	var req incomeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	nextPayDate, msg := validateIncomeRequest(&req)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	ctx := c.UserContext()
+	var source IncomeSource
+	err = s.store.InTx(ctx, func(tx repository.Store) error {
+		// Lock the income source, its current state goes into the audit log
+		before, err := tx.IncomeSources().ByIDForUpdate(ctx, userID, sourceID)
+		if err != nil {
+			return err
+		}
+
+		// A clamped date such as Feb 28 stands in for a later pay day, which
+		// only a new schedule replaces
+		payDay := payDayFor(req.Frequency, nextPayDate)
+		if req.Frequency == before.Frequency && req.NextPayDate == before.NextPayDate {
+			payDay = before.PayDay
+		}
+
+		source, err = tx.IncomeSources().Update(ctx, req.source(userID, sourceID, payDay))
+		if err != nil {
+			return err
+		}
+		return tx.AuditEvents().Record(ctx, changeEvent(c, userID, "income.update", "income_source", source.ID, before, source))
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Income source not found",
+			})
+		}
+		log.Printf("Error updating income source: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error updating income source",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":       "Income source updated successfully",
+		"income_source": source,
+	})
+}
+
+// advance moves next_pay_date forward by one pay period after a payday
+func (s *IncomeService) advance(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	sourceID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid income source ID",
+		})
+	}
+
+	// Irregular sources have no period, so the client supplies the next date
+	type AdvanceRequest struct {
+		NextPayDate string `json:"next_pay_date"`
+	}
+
+	var req AdvanceRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request format",
+			})
+		}
+	}
+
+	ctx := c.UserContext()
+	var source IncomeSource
+	err = s.store.InTx(ctx, func(tx repository.Store) error {
+		// Lock the row so concurrent requests cannot skip a period twice
+		before, err := tx.IncomeSources().ByIDForUpdate(ctx, userID, sourceID)
+		if err != nil {
+			return err
+		}
+
+		current, err := time.Parse(dateLayout, before.NextPayDate)
+		if err != nil {
+			return fmt.Errorf("parsing next pay date: %w", err)
+		}
+
+		var next time.Time
+		if before.Frequency == "irregular" {
+			if req.NextPayDate == "" {
+				return invalidRequest("Next pay date is required for irregular income sources")
+			}
+			next, err = time.Parse(dateLayout, req.NextPayDate)
+			if err != nil {
+				return invalidRequest("Next pay date must be in YYYY-MM-DD format")
+			}
+			if !next.After(current) {
+				return invalidRequest("Next pay date must be after the current pay date")
+			}
+		} else {
+			payDay := current.Day()
+			if before.PayDay != nil {
+				payDay = *before.PayDay
+			}
+			next = NextPayDate(current, before.Frequency, payDay)
+		}
+
+		source, err = tx.IncomeSources().SetNextPayDate(ctx, userID, sourceID, next.Format(dateLayout))
+		if err != nil {
+			return err
+		}
+		return tx.AuditEvents().Record(ctx, changeEvent(c, userID, "income.advance", "income_source", source.ID, before, source))
+	})
+	var invalid invalidRequest
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Income source not found",
+		})
+	case errors.As(err, &invalid):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": invalid.Error(),
+		})
+	case err != nil:
+		log.Printf("Error advancing pay date: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error advancing pay date",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":       "Pay date advanced successfully",
+		"income_source": source,
+	})
+}
+
+// delete deletes an income source
+func (s *IncomeService) delete(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	sourceID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid income source ID",
+		})
+	}
+
+	ctx := c.UserContext()
+	err = s.store.InTx(ctx, func(tx repository.Store) error {
+		source, err := tx.IncomeSources().Delete(ctx, userID, sourceID)
+		if err != nil {
+			return err
+		}
+		return tx.AuditEvents().Record(ctx, changeEvent(c, userID, "income.delete", "income_source", source.ID, source, nil))
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Income source not found",
+			})
+		}
+		log.Printf("Error deleting income source: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error deleting income source",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Income source deleted successfully",
+	})
+}
+
+// source returns the income source a validated request describes
+func (req *incomeRequest) source(userID, id int, payDay *int) IncomeSource {
+	return IncomeSource{
+		ID:          id,
+		UserID:      userID,
+		SourceName:  req.SourceName,
+		Amount:      *req.Amount,
+		Currency:    req.Currency,
+		Frequency:   req.Frequency,
+		NextPayDate: req.NextPayDate,
+		PayDay:      payDay,
+	}
+}
+
+// NextPayDate returns the payday that follows current for the given frequency.
+// Monthly sources are paid on payDay, clamped to the last day of shorter
+// months, so a source paid on the 31st goes Jan 31 -> Feb 28/29 -> Mar 31.
+// Irregular sources have no period and current is returned unchanged.
+func NextPayDate(current time.Time, frequency string, payDay int) time.Time {
+	switch frequency {
+	case "weekly":
+		return current.AddDate(0, 0, 7)
+	case "biweekly":
+		return current.AddDate(0, 0, 14)
+	case "monthly":
+		// Day 1 never overflows, so this always lands in the following month
+		firstOfNext := time.Date(current.Year(), current.Month()+1, 1, 0, 0, 0, 0, current.Location())
+		day := payDay
+		if last := daysInMonth(firstOfNext); day > last {
+			day = last
+		}
+		return firstOfNext.AddDate(0, 0, day-1)
+	default:
+		return current
+	}
+}
+
+// daysInMonth returns the number of days in the month containing t
+func daysInMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
+
+// payDayFor returns the pay_day anchor stored for an income source
+func payDayFor(frequency string, nextPayDate time.Time) *int {
+	if frequency != "monthly" {
+		return nil
+	}
+	day := nextPayDate.Day()
+	return &day
+}
+
+// validateIncomeRequest checks an income request against the income_sources
+// table constraints and returns the parsed next pay date, or a user-facing
+// error message if it is invalid
+func validateIncomeRequest(req *incomeRequest) (time.Time, string) {
+	req.SourceName = strings.TrimSpace(req.SourceName)
+	if req.SourceName == "" || req.Amount == nil || req.Frequency == "" || req.NextPayDate == "" {
+		return time.Time{}, "Source name, amount, frequency, and next pay date are required"
+	}
+	if utf8.RuneCountInString(req.SourceName) > maxSourceNameLength {
+		return time.Time{}, "Source name must be at most 100 characters"
+	}
+	if !isValidAmount(*req.Amount) {
+		return time.Time{}, "Amount must be between 0 and 99999999.99"
+	}
+	if !isValidFrequency(req.Frequency) {
+		return time.Time{}, "Frequency must be 'weekly', 'biweekly', 'monthly', or 'irregular'"
+	}
+	nextPayDate, err := time.Parse(dateLayout, req.NextPayDate)
+	if err != nil {
+		return time.Time{}, "Next pay date must be in YYYY-MM-DD format"
+	}
+	if msg := normalizeCurrencyField(&req.Currency); msg != "" {
+		return time.Time{}, msg
+	}
+	return nextPayDate, ""
+}
+
+// isValidFrequency mirrors the CHECK constraint on income_sources.frequency
+func isValidFrequency(frequency string) bool {
+	switch frequency {
+	case "weekly", "biweekly", "monthly", "irregular":
+		return true
+	}
+	return false
+}
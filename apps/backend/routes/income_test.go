@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/money"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+func TestNextPayDate(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency string
+		payDay    int
+		// dates are the pay dates in turn, each rolled over from the one before
+		dates []string
+	}{
+		{
+			name:      "month end through a leap year February",
+			frequency: "monthly",
+			payDay:    31,
+			dates:     []string{"2024-01-31", "2024-02-29", "2024-03-31", "2024-04-30", "2024-05-31"},
+		},
+		{
+			name:      "month end through a common year February",
+			frequency: "monthly",
+			payDay:    31,
+			dates:     []string{"2025-01-31", "2025-02-28", "2025-03-31"},
+		},
+		{
+			name:      "30th through February",
+			frequency: "monthly",
+			payDay:    30,
+			dates:     []string{"2025-01-30", "2025-02-28", "2025-03-30", "2025-04-30"},
+		},
+		{
+			name:      "across the new year",
+			frequency: "monthly",
+			payDay:    15,
+			dates:     []string{"2024-11-15", "2024-12-15", "2025-01-15"},
+		},
+		{
+			name:      "weekly",
+			frequency: "weekly",
+			dates:     []string{"2024-02-26", "2024-03-04", "2024-03-11"},
+		},
+		{
+			name:      "biweekly",
+			frequency: "biweekly",
+			dates:     []string{"2024-12-20", "2025-01-03", "2025-01-17"},
+		},
+		{
+			name:      "irregular stays put",
+			frequency: "irregular",
+			dates:     []string{"2024-01-31", "2024-01-31"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, err := time.Parse(dateLayout, tt.dates[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.dates[1:] {
+				next := NextPayDate(current, tt.frequency, tt.payDay)
+				if got := next.Format(dateLayout); got != want {
+					t.Fatalf("NextPayDate(%s) = %s, want %s", current.Format(dateLayout), got, want)
+				}
+				current = next
+			}
+		})
+	}
+}
+
+func TestUpdateIncomeKeepsPayDay(t *testing.T) {
+	tests := []struct {
+		name        string
+		frequency   string
+		nextPayDate string
+		wantPayDay  float64
+		// wantAdvance is the pay date after advancing the edited source
+		wantAdvance string
+	}{
+		{
+			name:        "other fields edited",
+			frequency:   "monthly",
+			nextPayDate: "2025-02-28",
+			wantPayDay:  31,
+			wantAdvance: "2025-03-31",
+		},
+		{
+			name:        "next pay date edited",
+			frequency:   "monthly",
+			nextPayDate: "2025-02-27",
+			wantPayDay:  27,
+			wantAdvance: "2025-03-27",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := repository.NewMemoryStore()
+			app := newTestApp()
+			NewIncomeService(store).Register(app.Group("/api/income", middleware.AuthMiddleware()))
+			user := store.AddUser(models.User{Name: "Ada", Email: "ada@example.com", BaseCurrency: "USD"})
+			token := accessToken(t, store, user.ID)
+
+			// Paid on the 31st, clamped to the end of February
+			payDay := 31
+			source := store.AddIncomeSource(models.IncomeSource{
+				UserID:      user.ID,
+				SourceName:  "Salary",
+				Amount:      money.Amount(300000),
+				Currency:    "USD",
+				Frequency:   "monthly",
+				NextPayDate: "2025-02-28",
+				PayDay:      &payDay,
+			})
+			path := fmt.Sprintf("/api/income/%d", source.ID)
+
+			status, body := request(t, app, fiber.MethodPut, path, token, map[string]interface{}{
+				"source_name":   "Salary after raise",
+				"amount":        "3100.00",
+				"frequency":     tt.frequency,
+				"next_pay_date": tt.nextPayDate,
+			})
+			if status != fiber.StatusOK {
+				t.Fatalf("update status = %d, want %d, body %v", status, fiber.StatusOK, body)
+			}
+			if got := body["income_source"].(map[string]interface{})["pay_day"]; got != tt.wantPayDay {
+				t.Fatalf("pay_day = %v, want %v", got, tt.wantPayDay)
+			}
+
+			status, body = request(t, app, fiber.MethodPut, path+"/advance", token, nil)
+			if status != fiber.StatusOK {
+				t.Fatalf("advance status = %d, want %d, body %v", status, fiber.StatusOK, body)
+			}
+			if got := body["income_source"].(map[string]interface{})["next_pay_date"]; got != tt.wantAdvance {
+				t.Fatalf("next_pay_date after advance = %v, want %s", got, tt.wantAdvance)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/utils"
+)
+
+// RegisterJWKSRoutes publishes the public keys access tokens are signed with,
+// so other services can verify them without sharing a secret
+func RegisterJWKSRoutes(app *fiber.App) {
+	app.Get("/.well-known/jwks.json", func(c *fiber.Ctx) error {
+		// Verifiers refetch on an unknown kid, so a short cache is enough for rotation
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"keys": utils.JWKS(),
+		})
+	})
+}
@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/lockout"
+)
+
+// loginGuard locks out repeated login failures per email and per client IP
+type loginGuard struct {
+	email *lockout.Limiter
+	ip    *lockout.Limiter
+}
+
+// newLoginGuard returns a loginGuard keeping its state in store
+func newLoginGuard(store lockout.Store) *loginGuard {
+	return &loginGuard{
+		email: lockout.New(store, "login:email:", lockout.EmailPolicy),
+		ip:    lockout.New(store, "login:ip:", lockout.IPPolicy),
+	}
+}
+
+// wait returns how long the caller must wait before trying to log in again
+func (g *loginGuard) wait(ctx context.Context, email, ip string) (time.Duration, error) {
+	emailWait, err := g.email.Wait(ctx, normalizeEmailKey(email))
+	if err != nil {
+		return 0, err
+	}
+	ipWait, err := g.ip.Wait(ctx, ip)
+	if err != nil {
+		return 0, err
+	}
+	return max(emailWait, ipWait), nil
+}
+
+// fail records a failed login against both the email and the IP, and returns
+// how long the caller is now locked out for, zero if the failure set no lock
+func (g *loginGuard) fail(ctx context.Context, email, ip string) (time.Duration, error) {
+	emailWait, err := g.email.Fail(ctx, normalizeEmailKey(email))
+	if err != nil {
+		return 0, err
+	}
+	ipWait, err := g.ip.Fail(ctx, ip)
+	if err != nil {
+		return 0, err
+	}
+	return max(emailWait, ipWait), nil
+}
+
+// succeed clears the email's failures. The IP's are left to expire, otherwise
+// an attacker could reset them by logging in to an account of their own.
+func (g *loginGuard) succeed(ctx context.Context, email string) error {
+	return g.email.Reset(ctx, normalizeEmailKey(email))
+}
+
+// normalizeEmailKey makes differently typed forms of an email share a counter
+func normalizeEmailKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// tooManyAttempts responds with 429 and a Retry-After header
+func tooManyAttempts(c *fiber.Ctx, wait time.Duration) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":       "Too many failed attempts, please try again later",
+		"retry_after": seconds,
+	})
+}
@@ -0,0 +1,424 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/lockout"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/repository"
+	"github.com/kevinlucasklein/zero-balance/totp"
+	"github.com/kevinlucasklein/zero-balance/utils"
+)
+
+// Recovery codes handed out when two-factor authentication is enabled
+const (
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 10
+)
+
+// mfaIssuer labels the account in authenticator apps
+const mfaIssuer = "ZeroBalance"
+
+// Two-factor errors the MFA routes answer with a client error
+var (
+	errMFAEnabled    = errors.New("two-factor authentication already enabled")
+	errMFANotEnabled = errors.New("two-factor authentication not enabled")
+	errMFANotStarted = errors.New("two-factor enrollment not started")
+	errInvalidMFA    = errors.New("invalid authentication code")
+	errWrongPassword = errors.New("password is incorrect")
+)
+
+// registerMFARoutes registers two-factor enrollment and the second login step.
+// Wrong codes are counted per user by attempts, so six digits cannot be brute
+// forced, and requests are rate limited with limit.
+func registerMFARoutes(router fiber.Router, store repository.Store, attempts *lockout.Limiter, limit fiber.Handler) {
+	mfaGroup := router.Group("/api/auth/mfa")
+
+	// Start enrollment: generate a secret for the authenticator app
+	mfaGroup.Post("/enroll", middleware.AuthMiddleware(), limit, func(c *fiber.Ctx) error {
+		// Get user ID from context (set by AuthMiddleware)
+		userID := middleware.CurrentPrincipal(c).UserID
+
+		user, err := store.Users().ByID(c.UserContext(), userID)
+		if err != nil {
+			log.Printf("Error querying user: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+
+		if user.MFAEnabled {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Two-factor authentication is already enabled",
+			})
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			log.Printf("Error generating TOTP secret: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+
+		// Enrolling again replaces an unconfirmed secret
+		if err := store.MFA().StartEnrollment(c.UserContext(), userID, secret); err != nil {
+			log.Printf("Error storing TOTP secret: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":     "Scan the QR code with your authenticator app, then confirm with a code",
+			"secret":      secret,
+			"otpauth_uri": totp.URI(mfaIssuer, user.Email, secret),
+		})
+	})
+
+	// Finish enrollment with a code from the authenticator app
+	mfaGroup.Post("/confirm", middleware.AuthMiddleware(), limit, func(c *fiber.Ctx) error {
+		// Get user ID from context (set by AuthMiddleware)
+		userID := middleware.CurrentPrincipal(c).UserID
+
+		// Parse request body
+		type ConfirmRequest struct {
+			Code string `json:"code"`
+		}
+
+		var req ConfirmRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request format",
+			})
+		}
+
+		// Validate input
+		if req.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Code is required",
+			})
+		}
+
+		var codes []string
+		err := store.InTx(c.UserContext(), func(tx repository.Store) error {
+			state, err := tx.MFA().StateForUpdate(c.UserContext(), userID)
+			if err != nil {
+				return err
+			}
+			if state.Enabled {
+				return errMFAEnabled
+			}
+			if state.Secret == "" {
+				return errMFANotStarted
+			}
+
+			step, ok := totp.Validate(state.Secret, req.Code, time.Now())
+			if !ok {
+				return errInvalidMFA
+			}
+			if err := tx.MFA().Enable(c.UserContext(), userID, step); err != nil {
+				return err
+			}
+
+			codes, err = replaceRecoveryCodes(c.UserContext(), tx, userID)
+			return err
+		})
+
+		switch {
+		case errors.Is(err, errMFAEnabled):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Two-factor authentication is already enabled",
+			})
+		case errors.Is(err, errMFANotStarted):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Start two-factor enrollment first",
+			})
+		case errors.Is(err, errInvalidMFA):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid authentication code",
+			})
+		case err != nil:
+			log.Printf("Error enabling two-factor authentication: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+
+		// The codes are only stored hashed, so this is the only time they are shown
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":        "Two-factor authentication enabled. Store these recovery codes somewhere safe.",
+			"recovery_codes": codes,
+		})
+	})
+
+	// Turn two-factor authentication off
+	mfaGroup.Post("/disable", middleware.AuthMiddleware(), limit, func(c *fiber.Ctx) error {
+		// Get user ID from context (set by AuthMiddleware)
+		userID := middleware.CurrentPrincipal(c).UserID
+
+		// Parse request body
+		type DisableRequest struct {
+			Password     string `json:"password"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+
+		var req DisableRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request format",
+			})
+		}
+
+		// Validate input
+		if req.Password == "" || (req.Code == "" && req.RecoveryCode == "") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Password and an authentication or recovery code are required",
+			})
+		}
+
+		err := store.InTx(c.UserContext(), func(tx repository.Store) error {
+			user, err := tx.Users().ByIDForUpdate(c.UserContext(), userID)
+			if err != nil {
+				return err
+			}
+			if !user.MFAEnabled {
+				return errMFANotEnabled
+			}
+			if !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
+				return errWrongPassword
+			}
+
+			ok, err := checkSecondFactorLimited(c.UserContext(), tx, attempts, userID, req.Code, req.RecoveryCode)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errInvalidMFA
+			}
+			return tx.MFA().Disable(c.UserContext(), userID)
+		})
+
+		if wait, locked := lockedOut(err); locked {
+			return tooManyAttempts(c, wait)
+		}
+		switch {
+		case errors.Is(err, errMFANotEnabled):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Two-factor authentication is not enabled",
+			})
+		case errors.Is(err, errWrongPassword):
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Password is incorrect",
+			})
+		case errors.Is(err, errInvalidMFA):
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid authentication code",
+			})
+		case err != nil:
+			log.Printf("Error disabling two-factor authentication: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Two-factor authentication disabled",
+		})
+	})
+
+	// Second login step: exchange the MFA pending token and a code for real
+	// tokens. The caller is not signed in yet, so this is limited by client IP.
+	mfaGroup.Post("/verify", limit, func(c *fiber.Ctx) error {
+		// Parse request body
+		type VerifyRequest struct {
+			MFAToken     string `json:"mfa_token"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+
+		var req VerifyRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request format",
+			})
+		}
+
+		// Validate input
+		if req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "MFA token and an authentication or recovery code are required",
+			})
+		}
+
+		claims, err := utils.ValidateMFAPendingJWT(c.UserContext(), req.MFAToken)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired MFA token, please log in again",
+			})
+		}
+		userID := claims.UserID
+
+		var user models.User
+		var tokens authTokens
+		err = store.InTx(c.UserContext(), func(tx repository.Store) error {
+			ok, err := checkSecondFactorLimited(c.UserContext(), tx, attempts, userID, req.Code, req.RecoveryCode)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errInvalidMFA
+			}
+
+			user, err = tx.Users().ByID(c.UserContext(), userID)
+			if err != nil {
+				return err
+			}
+			tokens, err = issueTokens(c, tx, userID, user.TokenVersion, "")
+			return err
+		})
+
+		if wait, locked := lockedOut(err); locked {
+			return tooManyAttempts(c, wait)
+		}
+		switch {
+		case errors.Is(err, errInvalidMFA):
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid authentication code",
+			})
+		case err != nil:
+			log.Printf("Error completing two-factor login: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+
+		// Return success with tokens
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":       "Login successful",
+			"token":         tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"expires_in":    tokens.ExpiresIn,
+			"user": fiber.Map{
+				"id":             userID,
+				"name":           user.Name,
+				"email":          user.Email,
+				"email_verified": user.EmailVerified,
+			},
+		})
+	})
+}
+
+// checkSecondFactor verifies a TOTP code, or consumes a recovery code when one
+// is given, for a user with two-factor authentication enabled. TOTP codes at
+// or before the last accepted step are rejected so they cannot be replayed.
+func checkSecondFactor(ctx context.Context, store repository.Store, userID int, code, recoveryCode string) (bool, error) {
+	state, err := store.MFA().StateForUpdate(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !state.Enabled || state.Secret == "" {
+		return false, nil
+	}
+
+	if recoveryCode != "" {
+		return store.MFA().UseRecoveryCode(ctx, userID, utils.HashToken(normalizeRecoveryCode(recoveryCode)))
+	}
+
+	step, ok := totp.Validate(state.Secret, code, time.Now())
+	if !ok || step <= state.LastStep {
+		return false, nil
+	}
+
+	err = store.MFA().SetLastStep(ctx, userID, step)
+	return err == nil, err
+}
+
+// errLockedOut reports that a user has made too many wrong two-factor attempts
+type errLockedOut struct {
+	wait time.Duration
+}
+
+func (e errLockedOut) Error() string {
+	return fmt.Sprintf("locked out for %s", e.wait)
+}
+
+// lockedOut returns the remaining lock when err is an errLockedOut
+func lockedOut(err error) (time.Duration, bool) {
+	var locked errLockedOut
+	if errors.As(err, &locked) {
+		return locked.wait, true
+	}
+	return 0, false
+}
+
+// checkSecondFactorLimited wraps checkSecondFactor with per-user lockout,
+// returning an errLockedOut while the user is locked
+func checkSecondFactorLimited(ctx context.Context, store repository.Store, attempts *lockout.Limiter, userID int, code, recoveryCode string) (bool, error) {
+	key := strconv.Itoa(userID)
+	wait, err := attempts.Wait(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if wait > 0 {
+		return false, errLockedOut{wait: wait}
+	}
+
+	ok, err := checkSecondFactor(ctx, store, userID, code, recoveryCode)
+	if err != nil {
+		return false, err
+	}
+
+	if ok {
+		err = attempts.Reset(ctx, key)
+	} else {
+		_, err = attempts.Fail(ctx, key)
+	}
+	if err != nil {
+		log.Printf("Error recording two-factor attempt: %v", err)
+	}
+	return ok, nil
+}
+
+// replaceRecoveryCodes discards a user's recovery codes and stores the hashes
+// of a fresh set, returning the codes for display
+func replaceRecoveryCodes(ctx context.Context, store repository.Store, userID int) ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		// Shown grouped as XXXX-XXXX-XXXX-XXXX for readability
+		raw := encoding.EncodeToString(b)
+		codes = append(codes, raw[0:4]+"-"+raw[4:8]+"-"+raw[8:12]+"-"+raw[12:16])
+		hashes = append(hashes, utils.HashToken(raw))
+	}
+
+	if err := store.MFA().ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode strips the grouping and case a user may type a recovery code with
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(strings.TrimSpace(code)))
+}
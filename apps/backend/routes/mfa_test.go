@@ -0,0 +1,267 @@
+package routes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/totp"
+	"github.com/kevinlucasklein/zero-balance/utils"
+)
+
+// testRecoveryCode is the recovery code enableMFA stores, as a user would type it
+const testRecoveryCode = "abcd-efgh-ijkl-mnop"
+
+// enableMFA turns two-factor authentication on for a user, with one recovery
+// code, and returns the TOTP secret
+func enableMFA(t *testing.T, a *authTest, userID int) string {
+	t.Helper()
+	ctx := context.Background()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.store.MFA().StartEnrollment(ctx, userID, secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.store.MFA().Enable(ctx, userID, 0); err != nil {
+		t.Fatal(err)
+	}
+	codeHash := utils.HashToken(normalizeRecoveryCode(testRecoveryCode))
+	if err := a.store.MFA().ReplaceRecoveryCodes(ctx, userID, []string{codeHash}); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// currentCode returns the code an authenticator app shows now
+func currentCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestMFAEnrollment(t *testing.T) {
+	tests := []struct {
+		name string
+		// code returns the confirmation code for the enrolled secret, which
+		// is empty when enrollment was skipped
+		code       func(t *testing.T, secret string) string
+		enroll     bool
+		wantStatus int
+	}{
+		{
+			name:       "code from the authenticator app",
+			enroll:     true,
+			code:       currentCode,
+			wantStatus: fiber.StatusOK,
+		},
+		{
+			name:       "wrong code",
+			enroll:     true,
+			code:       func(*testing.T, string) string { return "000000" },
+			wantStatus: fiber.StatusBadRequest,
+		},
+		{
+			name:       "confirmed before enrolling",
+			code:       func(*testing.T, string) string { return "000000" },
+			wantStatus: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthTest(t)
+			user := a.store.AddUser(models.User{Name: "Ada", Email: "ada@example.com"})
+			token := accessToken(t, a.store, user.ID)
+
+			var secret string
+			if tt.enroll {
+				status, body := request(t, a.app, fiber.MethodPost, "/api/auth/mfa/enroll", token, nil)
+				if status != fiber.StatusOK {
+					t.Fatalf("enroll: status %d, body %v", status, body)
+				}
+				secret = body["secret"].(string)
+			}
+
+			status, body := request(t, a.app, fiber.MethodPost, "/api/auth/mfa/confirm", token, fiber.Map{"code": tt.code(t, secret)})
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %v", status, tt.wantStatus, body)
+			}
+
+			stored, err := a.store.Users().ByID(context.Background(), user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			enabled := tt.wantStatus == fiber.StatusOK
+			if stored.MFAEnabled != enabled {
+				t.Fatalf("two-factor enabled = %v, want %v", stored.MFAEnabled, enabled)
+			}
+			if !enabled {
+				return
+			}
+			if codes := body["recovery_codes"].([]interface{}); len(codes) != recoveryCodeCount {
+				t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+			}
+
+			// Enrolling again would lock the user out of their authenticator app
+			if status, body := request(t, a.app, fiber.MethodPost, "/api/auth/mfa/enroll", token, nil); status != fiber.StatusConflict {
+				t.Fatalf("enrolling again: status %d, body %v", status, body)
+			}
+		})
+	}
+}
+
+func TestMFAVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		// attempts returns the codes and recovery codes sent in turn, the
+		// last of which must get wantStatus
+		attempts   func(t *testing.T, secret string) [][2]string
+		wantStatus int
+	}{
+		{
+			name: "current code",
+			attempts: func(t *testing.T, secret string) [][2]string {
+				return [][2]string{{currentCode(t, secret), ""}}
+			},
+			wantStatus: fiber.StatusOK,
+		},
+		{
+			name: "code replayed",
+			attempts: func(t *testing.T, secret string) [][2]string {
+				code := currentCode(t, secret)
+				return [][2]string{{code, ""}, {code, ""}}
+			},
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name: "wrong code",
+			attempts: func(*testing.T, string) [][2]string {
+				return [][2]string{{"000000", ""}}
+			},
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name: "recovery code",
+			attempts: func(*testing.T, string) [][2]string {
+				return [][2]string{{"", testRecoveryCode}}
+			},
+			wantStatus: fiber.StatusOK,
+		},
+		{
+			name: "recovery code used twice",
+			attempts: func(*testing.T, string) [][2]string {
+				return [][2]string{{"", testRecoveryCode}, {"", testRecoveryCode}}
+			},
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name: "locked out after repeated wrong codes",
+			attempts: func(t *testing.T, secret string) [][2]string {
+				attempts := [][2]string{}
+				for i := 0; i < 5; i++ {
+					attempts = append(attempts, [2]string{"000000", ""})
+				}
+				return append(attempts, [2]string{currentCode(t, secret), ""})
+			},
+			wantStatus: fiber.StatusTooManyRequests,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthTest(t)
+			user := a.store.AddUser(models.User{Name: "Ada", Email: "ada@example.com"})
+			secret := enableMFA(t, a, user.ID)
+			mfaToken, err := utils.GenerateMFAPendingJWT(user.ID, user.TokenVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var status int
+			var body map[string]interface{}
+			for _, attempt := range tt.attempts(t, secret) {
+				status, body = request(t, a.app, fiber.MethodPost, "/api/auth/mfa/verify", "", fiber.Map{
+					"mfa_token":     mfaToken,
+					"code":          attempt[0],
+					"recovery_code": attempt[1],
+				})
+			}
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %v", status, tt.wantStatus, body)
+			}
+			if hasTokens := body["token"] != nil && body["refresh_token"] != nil; hasTokens != (status == fiber.StatusOK) {
+				t.Fatalf("response %v, want tokens only on success", body)
+			}
+		})
+	}
+}
+
+func TestMFADisable(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string
+		code       func(t *testing.T, secret string) string
+		wantStatus int
+	}{
+		{
+			name:       "password and code",
+			password:   "secret",
+			code:       currentCode,
+			wantStatus: fiber.StatusOK,
+		},
+		{
+			name:       "wrong password",
+			password:   "wrong",
+			code:       currentCode,
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "wrong code",
+			password:   "secret",
+			code:       func(*testing.T, string) string { return "000000" },
+			wantStatus: fiber.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthTest(t)
+			user := a.store.AddUser(models.User{Name: "Ada", Email: "ada@example.com", PasswordHash: passwordHash(t, "secret")})
+			secret := enableMFA(t, a, user.ID)
+
+			status, body := request(t, a.app, fiber.MethodPost, "/api/auth/mfa/disable", accessToken(t, a.store, user.ID), fiber.Map{
+				"password": tt.password,
+				"code":     tt.code(t, secret),
+			})
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %v", status, tt.wantStatus, body)
+			}
+
+			ctx := context.Background()
+			state, err := a.store.MFA().StateForUpdate(ctx, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			disabled := tt.wantStatus == fiber.StatusOK
+			if state.Enabled == disabled || (state.Secret == "") != disabled {
+				t.Fatalf("two-factor state %+v, want it disabled = %v", state, disabled)
+			}
+
+			// Disabling discards the recovery codes along with the secret
+			used, err := a.store.MFA().UseRecoveryCode(ctx, user.ID, utils.HashToken(normalizeRecoveryCode(testRecoveryCode)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if used == disabled {
+				t.Fatalf("recovery code usable = %v after disable = %v", used, disabled)
+			}
+		})
+	}
+}
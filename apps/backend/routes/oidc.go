@@ -0,0 +1,398 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/oidc"
+	"github.com/kevinlucasklein/zero-balance/repository"
+	"github.com/kevinlucasklein/zero-balance/utils"
+)
+
+// oidcStateTTL is how long the user has to finish a sign-in at the provider
+const oidcStateTTL = 10 * time.Minute
+
+// Errors refusing the first sign-in with a provider account
+var (
+	// errUnverifiedIdentity is returned when the provider has not verified
+	// the email address
+	errUnverifiedIdentity = errors.New("provider email address not verified")
+	// errUnverifiedAccount is returned when the account registered with the
+	// email address has not verified it
+	errUnverifiedAccount = errors.New("account email address not verified")
+	// errLastSignInMethod is returned when unlinking the only way left to sign in
+	errLastSignInMethod = errors.New("only sign-in method")
+)
+
+// OIDCService serves sign-in with external identity providers and the
+// management of linked provider accounts
+type OIDCService struct {
+	store     repository.Store
+	providers map[string]oidc.Provider
+	// limit rate limits every route, by user on those that need signing in
+	limit fiber.Handler
+}
+
+// NewOIDCService returns an OIDCService keeping accounts in store, signing
+// in with providers, by name, and rate limiting requests with limit
+func NewOIDCService(store repository.Store, providers map[string]oidc.Provider, limit fiber.Handler) *OIDCService {
+	return &OIDCService{store: store, providers: providers, limit: limit}
+}
+
+// RegisterOIDCRoutes registers sign-in with external identity providers. The
+// frontend starts a sign-in, sends the user to the returned URL and posts the
+// code and state the provider redirects back with to the callback.
+func RegisterOIDCRoutes(app *fiber.App, db *sql.DB, providers map[string]oidc.Provider, limit fiber.Handler) {
+	NewOIDCService(repository.NewPostgresStore(db), providers, limit).Register(app)
+}
+
+// Register registers the service's routes
+func (s *OIDCService) Register(router fiber.Router) {
+	// Signing in is limited by client IP, the identities by user
+	router.Get("/api/auth/oidc/providers", s.limit, s.listProviders)
+	router.Post("/api/auth/oidc/:provider/start", s.limit, func(c *fiber.Ctx) error {
+		return s.start(c, 0)
+	})
+	router.Post("/api/auth/oidc/:provider/callback", s.limit, s.callback)
+
+	// Create an identities group with authentication middleware
+	identitiesGroup := router.Group("/api/auth/identities")
+	identitiesGroup.Use(middleware.AuthMiddleware())
+	identitiesGroup.Use(s.limit)
+
+	identitiesGroup.Get("/", s.listIdentities)
+	// Start linking a provider to the caller's account. The callback is the
+	// same as for signing in.
+	identitiesGroup.Post("/:provider", func(c *fiber.Ctx) error {
+		return s.start(c, middleware.CurrentPrincipal(c).UserID)
+	})
+	identitiesGroup.Delete("/:id", s.unlink)
+}
+
+// listProviders lists the providers users can sign in with
+func (s *OIDCService) listProviders(c *fiber.Ctx) error {
+	names := []string{}
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"providers": names,
+	})
+}
+
+// callback finishes signing in. Known identities log in to their account,
+// new ones are linked to the account with the same verified email address or
+// get a new account.
+func (s *OIDCService) callback(c *fiber.Ctx) error {
+	type CallbackRequest struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+
+	var req CallbackRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate input
+	if req.Code == "" || req.State == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Code and state are required",
+		})
+	}
+	name := c.Params("provider")
+	provider, ok := s.providers[name]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Unknown sign-in provider",
+		})
+	}
+
+	// Each state works once, so a leaked redirect cannot be replayed
+	state, err := s.store.LoginStates().Take(c.UserContext(), utils.HashToken(req.State), name)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Printf("Error querying sign-in state: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
+	if err != nil || state.Expired {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired sign-in request, please try again",
+		})
+	}
+
+	authReq := oidc.AuthRequest{State: req.State, Nonce: state.Nonce, CodeVerifier: state.CodeVerifier}
+	identity, err := provider.Exchange(c.UserContext(), req.Code, authReq)
+	if err != nil {
+		log.Printf("Error signing in with %s: %v", name, err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Could not sign in with the provider, please try again",
+		})
+	}
+	identity.Email = strings.TrimSpace(identity.Email)
+
+	if state.LinkUserID != 0 {
+		return s.link(c, state.LinkUserID, name, identity)
+	}
+	return s.signIn(c, name, identity)
+}
+
+// listIdentities lists the caller's linked providers
+func (s *OIDCService) listIdentities(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	identities, err := s.store.Identities().ListByUser(c.UserContext(), userID)
+	if err != nil {
+		log.Printf("Error querying identities: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving linked accounts",
+		})
+	}
+
+	user, err := s.store.Users().ByID(c.UserContext(), userID)
+	if err != nil {
+		log.Printf("Error querying user: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving linked accounts",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"identities":   identities,
+		"has_password": user.PasswordHash != "",
+	})
+}
+
+// unlink unlinks a provider, unless it is the only way left to sign in
+func (s *OIDCService) unlink(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	identityID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid identity ID",
+		})
+	}
+
+	ctx := c.UserContext()
+	err = s.store.InTx(ctx, func(tx repository.Store) error {
+		// Lock the user so concurrent unlinks cannot remove every sign-in method
+		user, err := tx.Users().ByIDForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+		identities, err := tx.Identities().ListByUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Identities().Unlink(ctx, identityID, userID); err != nil {
+			return err
+		}
+		if user.PasswordHash == "" && len(identities) <= 1 {
+			return errLastSignInMethod
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Linked account not found",
+		})
+	case errors.Is(err, errLastSignInMethod):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Set a password before unlinking your only sign-in method",
+		})
+	case err != nil:
+		log.Printf("Error unlinking identity: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error unlinking account",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Account unlinked successfully",
+	})
+}
+
+// start stores a new sign-in request and returns the provider URL to send
+// the user to. linkUserID is the signed-in user adding the provider to their
+// account, 0 when signing in.
+func (s *OIDCService) start(c *fiber.Ctx, linkUserID int) error {
+	name := c.Params("provider")
+	provider, ok := s.providers[name]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Unknown sign-in provider",
+		})
+	}
+
+	authReq, err := oidc.NewAuthRequest()
+	if err != nil {
+		log.Printf("Error generating sign-in request: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
+	authURL, err := provider.AuthURL(c.UserContext(), authReq)
+	if err != nil {
+		log.Printf("Error building %s authorization URL: %v", name, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "The sign-in provider is unavailable, please try again later",
+		})
+	}
+
+	err = s.store.LoginStates().Create(c.UserContext(), repository.LoginState{
+		StateHash:    utils.HashToken(authReq.State),
+		Provider:     name,
+		Nonce:        authReq.Nonce,
+		CodeVerifier: authReq.CodeVerifier,
+		LinkUserID:   linkUserID,
+	}, oidcStateTTL)
+	if err != nil {
+		log.Printf("Error storing sign-in state: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
+
+	// The client keeps the state to check it against the redirect
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"authorization_url": authURL,
+		"state":             authReq.State,
+	})
+}
+
+// signIn logs in the account a provider identity belongs to, linking or
+// creating one for an identity seen for the first time
+func (s *OIDCService) signIn(c *fiber.Ctx, provider string, identity oidc.Identity) error {
+	ctx := c.UserContext()
+	var user models.User
+	created := false
+	err := s.store.InTx(ctx, func(tx repository.Store) error {
+		userID, err := tx.Identities().RecordLogin(ctx, provider, identity.Subject, identity.Email)
+		if err == nil {
+			user, err = tx.Users().ByID(ctx, userID)
+			return err
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		// Only an address the provider has verified proves the user owns the
+		// account registered with it
+		if identity.Email == "" || !identity.EmailVerified {
+			return errUnverifiedIdentity
+		}
+
+		user, err = tx.Users().ByEmailForUpdate(ctx, identity.Email)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			user, err = createOIDCUser(ctx, tx, identity)
+			created = true
+		case err == nil && !user.EmailVerified:
+			// Whoever registered the unverified address may not own it, and
+			// linking would hand them the provider's account
+			return errUnverifiedAccount
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Identities().Link(ctx, user.ID, provider, identity.Subject, identity.Email); err != nil {
+			return err
+		}
+		_, err = tx.Identities().RecordLogin(ctx, provider, identity.Subject, identity.Email)
+		return err
+	})
+
+	switch {
+	case errors.Is(err, errUnverifiedIdentity):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Your account with the provider has no verified email address",
+		})
+	case errors.Is(err, errUnverifiedAccount):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "An account with this email address already exists. Verify its email address or log in with its password, then link the provider from your account.",
+		})
+	case err != nil:
+		log.Printf("Error linking %s identity: %v", provider, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
+
+	if created {
+		return finishLogin(c, s.store, user, fiber.StatusCreated, "User registered successfully")
+	}
+	return finishLogin(c, s.store, user, fiber.StatusOK, "Login successful")
+}
+
+// createOIDCUser creates a passwordless account for a provider identity. The
+// provider has verified the email address, so the account starts verified.
+func createOIDCUser(ctx context.Context, store repository.Store, identity oidc.Identity) (models.User, error) {
+	name := strings.TrimSpace(identity.Name)
+	if name == "" {
+		name = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+
+	return store.Users().Create(ctx, models.User{
+		Name:          name,
+		Email:         identity.Email,
+		EmailVerified: true,
+	})
+}
+
+// link adds a provider identity to a signed-in user's account
+func (s *OIDCService) link(c *fiber.Ctx, userID int, provider string, identity oidc.Identity) error {
+	ownerID, err := s.store.Identities().Owner(c.UserContext(), provider, identity.Subject)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Printf("Error querying identity: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error linking account",
+		})
+	}
+	if err == nil {
+		if ownerID != userID {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "This account with the provider is already linked to another user",
+			})
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "This account with the provider is already linked",
+		})
+	}
+
+	// A user can link one account per provider
+	linked, err := s.store.Identities().Link(c.UserContext(), userID, provider, identity.Subject, identity.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrAlreadyLinked) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Another account with this provider is already linked, unlink it first",
+			})
+		}
+		log.Printf("Error linking %s identity: %v", provider, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error linking account",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "Account linked successfully",
+		"identity": linked,
+	})
+}
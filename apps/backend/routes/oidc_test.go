@@ -0,0 +1,305 @@
+package routes
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/oidc"
+	"github.com/kevinlucasklein/zero-balance/oidc/oidctest"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+// oidcTest is an app signing in with an oidctest provider named "test"
+type oidcTest struct {
+	app      *fiber.App
+	store    *repository.MemoryStore
+	provider *oidctest.Provider
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	provider, err := oidctest.NewProvider("zero-balance", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(provider.Close)
+
+	store := repository.NewMemoryStore()
+	app := newTestApp()
+	providers := map[string]oidc.Provider{"test": provider.Client("http://app.test/auth/callback/test")}
+	NewOIDCService(store, providers, noLimit).Register(app)
+	return &oidcTest{app: app, store: store, provider: provider}
+}
+
+// start starts a sign-in, or linking when token is set, and returns the
+// authorization URL and state
+func (o *oidcTest) start(t *testing.T, token string) (string, string) {
+	t.Helper()
+	path := "/api/auth/oidc/test/start"
+	if token != "" {
+		path = "/api/auth/identities/test"
+	}
+	status, body := request(t, o.app, fiber.MethodPost, path, token, nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("start: status %d, body %v", status, body)
+	}
+	return body["authorization_url"].(string), body["state"].(string)
+}
+
+// authorize approves an authorization URL at the provider and returns the code
+func (o *oidcTest) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+	code, _, err := o.provider.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// callback finishes a sign-in
+func (o *oidcTest) callback(t *testing.T, code, state string) (int, map[string]interface{}) {
+	t.Helper()
+	return request(t, o.app, fiber.MethodPost, "/api/auth/oidc/test/callback", "", fiber.Map{
+		"code":  code,
+		"state": state,
+	})
+}
+
+// signIn signs in with the provider's current identity
+func (o *oidcTest) signIn(t *testing.T) (int, map[string]interface{}) {
+	t.Helper()
+	authURL, state := o.start(t, "")
+	return o.callback(t, o.authorize(t, authURL), state)
+}
+
+// owner returns the user the provider account with subject is linked to, 0
+// if there is none
+func (o *oidcTest) owner(t *testing.T, subject string) int {
+	t.Helper()
+	userID, err := o.store.Identities().Owner(context.Background(), "test", subject)
+	if err == repository.ErrNotFound {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	identity := oidc.Identity{Subject: "subject-1", Email: "ada@example.com", EmailVerified: true, Name: "Ada"}
+
+	tests := []struct {
+		name     string
+		identity oidc.Identity
+		// existing is an account registered before the sign-in
+		existing *models.User
+		// linked links the provider account to existing beforehand
+		linked     bool
+		wantStatus int
+		// wantOwner is who the provider account is linked to afterwards:
+		// "existing", "new" or "" for nobody
+		wantOwner string
+	}{
+		{
+			name:       "new user",
+			identity:   identity,
+			wantStatus: fiber.StatusCreated,
+			wantOwner:  "new",
+		},
+		{
+			name:       "links the account with the verified email address",
+			identity:   oidc.Identity{Subject: "subject-1", Email: "ADA@example.com", EmailVerified: true},
+			existing:   &models.User{Name: "Ada", Email: "ada@example.com", EmailVerified: true, PasswordHash: "hash"},
+			wantStatus: fiber.StatusOK,
+			wantOwner:  "existing",
+		},
+		{
+			name:       "refuses to link an account with an unverified email address",
+			identity:   identity,
+			existing:   &models.User{Name: "Mallory", Email: "ada@example.com", PasswordHash: "hash"},
+			wantStatus: fiber.StatusConflict,
+		},
+		{
+			name:       "refuses a provider email address that is not verified",
+			identity:   oidc.Identity{Subject: "subject-1", Email: "ada@example.com"},
+			wantStatus: fiber.StatusForbidden,
+		},
+		{
+			name:       "logs in a linked provider account",
+			identity:   oidc.Identity{Subject: "subject-1", Email: "ada@new.example.com"},
+			existing:   &models.User{Name: "Ada", Email: "ada@example.com", EmailVerified: true},
+			linked:     true,
+			wantStatus: fiber.StatusOK,
+			wantOwner:  "existing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOIDCTest(t)
+			var existing models.User
+			if tt.existing != nil {
+				existing = o.store.AddUser(*tt.existing)
+			}
+			if tt.linked {
+				if _, err := o.store.Identities().Link(context.Background(), existing.ID, "test", tt.identity.Subject, existing.Email); err != nil {
+					t.Fatal(err)
+				}
+			}
+			o.provider.SetIdentity(tt.identity)
+
+			status, body := o.signIn(t)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %v", status, tt.wantStatus, body)
+			}
+
+			owner := o.owner(t, tt.identity.Subject)
+			switch tt.wantOwner {
+			case "":
+				if owner != 0 {
+					t.Fatalf("provider account linked to user %d, want it unlinked", owner)
+				}
+				return
+			case "existing":
+				if owner != existing.ID {
+					t.Fatalf("provider account linked to user %d, want %d", owner, existing.ID)
+				}
+			case "new":
+				user, err := o.store.Users().ByID(context.Background(), owner)
+				if err != nil {
+					t.Fatalf("provider account linked to user %d: %v", owner, err)
+				}
+				if user.Email != tt.identity.Email || !user.EmailVerified || user.PasswordHash != "" {
+					t.Fatalf("created user %+v, want a verified passwordless account for %s", user, tt.identity.Email)
+				}
+			}
+			if body["token"] == nil || body["refresh_token"] == nil {
+				t.Fatalf("response has no tokens: %v", body)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejectsReplay(t *testing.T) {
+	tests := []struct {
+		name string
+		// callbacks returns the code and state of each callback made, the
+		// last of which must be refused with wantStatus
+		callbacks  func(t *testing.T, o *oidcTest) [][2]string
+		wantStatus int
+	}{
+		{
+			name: "state used twice",
+			callbacks: func(t *testing.T, o *oidcTest) [][2]string {
+				authURL, state := o.start(t, "")
+				code := o.authorize(t, authURL)
+				return [][2]string{{code, state}, {code, state}}
+			},
+			wantStatus: fiber.StatusBadRequest,
+		},
+		{
+			name: "state used twice with a fresh code",
+			callbacks: func(t *testing.T, o *oidcTest) [][2]string {
+				authURL, state := o.start(t, "")
+				return [][2]string{{o.authorize(t, authURL), state}, {o.authorize(t, authURL), state}}
+			},
+			wantStatus: fiber.StatusBadRequest,
+		},
+		{
+			name: "code issued for another sign-in's nonce",
+			callbacks: func(t *testing.T, o *oidcTest) [][2]string {
+				authURL, _ := o.start(t, "")
+				_, otherState := o.start(t, "")
+				return [][2]string{{o.authorize(t, authURL), otherState}}
+			},
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name: "unknown state",
+			callbacks: func(t *testing.T, o *oidcTest) [][2]string {
+				authURL, _ := o.start(t, "")
+				return [][2]string{{o.authorize(t, authURL), "made-up"}}
+			},
+			wantStatus: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOIDCTest(t)
+			callbacks := tt.callbacks(t, o)
+			for i, cb := range callbacks {
+				status, body := o.callback(t, cb[0], cb[1])
+				last := i == len(callbacks)-1
+				if !last && status != fiber.StatusCreated && status != fiber.StatusOK {
+					t.Fatalf("callback %d: status %d, body %v", i+1, status, body)
+				}
+				if last && status != tt.wantStatus {
+					t.Fatalf("status = %d, want %d, body %v", status, tt.wantStatus, body)
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejectsBadCodeVerifier(t *testing.T) {
+	o := newOIDCTest(t)
+	authURL, state := o.start(t, "")
+
+	// A code obtained with someone else's challenge cannot be redeemed with
+	// the verifier stored for this sign-in
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("code_challenge", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")
+	u.RawQuery = query.Encode()
+
+	status, body := o.callback(t, o.authorize(t, u.String()), state)
+	if status != fiber.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d, body %v", status, fiber.StatusUnauthorized, body)
+	}
+	if owner := o.owner(t, "mock-user"); owner != 0 {
+		t.Fatalf("provider account linked to user %d, want it unlinked", owner)
+	}
+}
+
+func TestOIDCLinkAndUnlink(t *testing.T) {
+	o := newOIDCTest(t)
+	user := o.store.AddUser(models.User{Name: "Ada", Email: "ada@example.com", EmailVerified: true})
+	token := accessToken(t, o.store, user.ID)
+
+	// Link a provider account whose email address differs from the account's
+	o.provider.SetIdentity(oidc.Identity{Subject: "subject-1", Email: "ada@work.example.com"})
+	authURL, state := o.start(t, token)
+	status, body := o.callback(t, o.authorize(t, authURL), state)
+	if status != fiber.StatusCreated {
+		t.Fatalf("link: status %d, body %v", status, body)
+	}
+	if owner := o.owner(t, "subject-1"); owner != user.ID {
+		t.Fatalf("provider account linked to user %d, want %d", owner, user.ID)
+	}
+	identityID := int(body["identity"].(map[string]interface{})["id"].(float64))
+
+	// Without a password it is the only way left to sign in
+	path := "/api/auth/identities/" + strconv.Itoa(identityID)
+	if status, body := request(t, o.app, fiber.MethodDelete, path, token, nil); status != fiber.StatusConflict {
+		t.Fatalf("unlink without a password: status %d, body %v", status, body)
+	}
+
+	if err := o.store.Users().SetPasswordHash(context.Background(), user.ID, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := request(t, o.app, fiber.MethodDelete, path, token, nil); status != fiber.StatusOK {
+		t.Fatalf("unlink: status %d, body %v", status, body)
+	}
+	if owner := o.owner(t, "subject-1"); owner != 0 {
+		t.Fatalf("provider account still linked to user %d", owner)
+	}
+}
@@ -0,0 +1,206 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/mailer"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/repository"
+	"github.com/kevinlucasklein/zero-balance/utils"
+)
+
+// passwordResetTTL is how long an emailed reset link stays valid
+const passwordResetTTL = time.Hour
+
+// forgotPasswordMessage is returned whether or not the email has an account
+const forgotPasswordMessage = "If an account exists for that email, a password reset link has been sent"
+
+// registerPasswordResetRoutes registers the forgot and reset password routes,
+// rate limited by client IP with limit
+func registerPasswordResetRoutes(router fiber.Router, store repository.Store, mail mailer.Mailer, limit fiber.Handler) {
+	// Request a password reset link
+	router.Post("/api/auth/forgot-password", limit, func(c *fiber.Ctx) error {
+		// Parse request body
+		type ForgotPasswordRequest struct {
+			Email string `json:"email"`
+		}
+
+		var req ForgotPasswordRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request format",
+			})
+		}
+
+		// Validate input
+		if req.Email == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Email is required",
+			})
+		}
+
+		// Look the user up and create the token off the request path, so an
+		// unknown email gets the same response, as quickly, as a known one
+		go requestPasswordReset(store, mail, req.Email)
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": forgotPasswordMessage,
+		})
+	})
+
+	// Set a new password with a reset token
+	router.Post("/api/auth/reset-password", limit, func(c *fiber.Ctx) error {
+		// Parse request body
+		type ResetPasswordRequest struct {
+			Token       string `json:"token"`
+			NewPassword string `json:"new_password"`
+		}
+
+		var req ResetPasswordRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request format",
+			})
+		}
+
+		// Validate input
+		if req.Token == "" || req.NewPassword == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Token and new password are required",
+			})
+		}
+		if err := utils.ValidatePassword(req.NewPassword); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		var userID int
+		err := store.InTx(c.UserContext(), func(tx repository.Store) error {
+			// Consume the token first so it cannot be used twice
+			var err error
+			userID, err = tx.Tokens().UsePasswordResetToken(c.UserContext(), utils.HashToken(req.Token))
+			if err != nil {
+				return err
+			}
+
+			// Hash new password
+			newHash, err := utils.HashPassword(req.NewPassword)
+			if err != nil {
+				return err
+			}
+			_, err = setPassword(c.UserContext(), tx, userID, newHash)
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid or expired reset token",
+				})
+			}
+			log.Printf("Error resetting password: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+		middleware.ForgetUserSessions(userID)
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Password reset successfully, please log in with your new password",
+		})
+	})
+}
+
+// passwordResetRequestTimeout bounds the work of a forgot password request,
+// which runs after the response has been sent
+const passwordResetRequestTimeout = 30 * time.Second
+
+// requestPasswordReset creates a reset token for the account with the given
+// email, if there is one, and emails the link to it. Errors are only logged,
+// as the client has already been answered.
+func requestPasswordReset(store repository.Store, mail mailer.Mailer, email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordResetRequestTimeout)
+	defer cancel()
+
+	user, err := store.Users().ByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error querying user: %v", err)
+		return
+	}
+
+	token, err := createPasswordResetToken(ctx, store, user.ID)
+	if err != nil {
+		log.Printf("Error creating reset token: %v", err)
+		return
+	}
+
+	sendPasswordResetEmail(mail, user.Email, token, "Someone asked to reset the password for your ZeroBalance account.")
+}
+
+// setPassword stores a new password hash, which satisfies a forced reset, and
+// revokes every token issued before it, returning the user's new token version
+func setPassword(ctx context.Context, store repository.Store, userID int, hash string) (int, error) {
+	if err := store.Users().SetPasswordHash(ctx, userID, hash); err != nil {
+		return 0, err
+	}
+	return endAllSessions(ctx, store, userID)
+}
+
+// createPasswordResetToken stores a new reset token for a user and returns it.
+// Only the newest token works, earlier unused ones are retired.
+func createPasswordResetToken(ctx context.Context, store repository.Store, userID int) (string, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = store.InTx(ctx, func(tx repository.Store) error {
+		return tx.Tokens().ReplacePasswordResetToken(ctx, userID, utils.HashToken(token), passwordResetTTL)
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// sendPasswordResetEmail emails a reset link in the background
+func sendPasswordResetEmail(mail mailer.Mailer, email, token, reason string) {
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Reset your ZeroBalance password",
+		Body: fmt.Sprintf(
+			"%s\n\n"+
+				"Open this link within %d minutes to choose a new password:\n%s\n\n"+
+				"If you did not ask for this, you can ignore this email.",
+			reason, int(passwordResetTTL.Minutes()), appLink("/reset-password", token),
+		),
+	}
+	go func() {
+		if err := mail.Send(msg); err != nil {
+			log.Printf("Error sending password reset email: %v", err)
+		}
+	}()
+}
+
+// appURL is the frontend's URL, which emailed links point into
+var appURL = "http://localhost:5173"
+
+// SetAppURL sets the frontend URL used in emailed links
+func SetAppURL(u string) {
+	appURL = u
+}
+
+// appLink builds a link into the frontend carrying a one-time token
+func appLink(path, token string) string {
+	return strings.TrimRight(appURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
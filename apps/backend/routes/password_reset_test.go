@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/utils"
+)
+
+const newPassword = "N3w-passw0rd!"
+
+// forgotPassword asks for a reset link and returns the emailed token
+func (a *authTest) forgotPassword(t *testing.T, email string) string {
+	t.Helper()
+	status, body := request(t, a.app, fiber.MethodPost, "/api/auth/forgot-password", "", fiber.Map{"email": email})
+	if status != fiber.StatusOK {
+		t.Fatalf("forgot password: status %d, body %v", status, body)
+	}
+	return emailedToken(t, a.mail.next(t))
+}
+
+func TestPasswordReset(t *testing.T) {
+	tests := []struct {
+		name string
+		// tokens requests the reset tokens and returns the ones used in
+		// turn, the last of which must get wantStatus
+		tokens     func(t *testing.T, a *authTest, email string) []string
+		wantStatus int
+		// wantChanged is whether any of the tokens changed the password
+		wantChanged bool
+	}{
+		{
+			name: "emailed token",
+			tokens: func(t *testing.T, a *authTest, email string) []string {
+				return []string{a.forgotPassword(t, email)}
+			},
+			wantStatus:  fiber.StatusOK,
+			wantChanged: true,
+		},
+		{
+			name: "token used twice",
+			tokens: func(t *testing.T, a *authTest, email string) []string {
+				token := a.forgotPassword(t, email)
+				return []string{token, token}
+			},
+			wantStatus:  fiber.StatusBadRequest,
+			wantChanged: true,
+		},
+		{
+			name: "token replaced by a newer one",
+			tokens: func(t *testing.T, a *authTest, email string) []string {
+				first := a.forgotPassword(t, email)
+				a.forgotPassword(t, email)
+				return []string{first}
+			},
+			wantStatus: fiber.StatusBadRequest,
+		},
+		{
+			name: "unknown token",
+			tokens: func(t *testing.T, a *authTest, email string) []string {
+				return []string{"made-up"}
+			},
+			wantStatus: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthTest(t)
+			user := a.store.AddUser(models.User{Name: "Ada", Email: "ada@example.com", PasswordHash: passwordHash(t, "old")})
+
+			tokens := tt.tokens(t, a, user.Email)
+			var status int
+			var body map[string]interface{}
+			for _, token := range tokens {
+				status, body = request(t, a.app, fiber.MethodPost, "/api/auth/reset-password", "", fiber.Map{
+					"token":        token,
+					"new_password": newPassword,
+				})
+			}
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %v", status, tt.wantStatus, body)
+			}
+
+			stored, err := a.store.Users().ByID(context.Background(), user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			changed := utils.CheckPasswordHash(newPassword, stored.PasswordHash)
+			if changed != tt.wantChanged {
+				t.Fatalf("password changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if changed && stored.TokenVersion == user.TokenVersion {
+				t.Fatal("token version not bumped, earlier tokens still work")
+			}
+		})
+	}
+}
+
+func TestForgotPasswordUnknownEmail(t *testing.T) {
+	a := newAuthTest(t)
+	status, body := request(t, a.app, fiber.MethodPost, "/api/auth/forgot-password", "", fiber.Map{"email": "nobody@example.com"})
+	if status != fiber.StatusOK || body["message"] != forgotPasswordMessage {
+		t.Fatalf("status %d, body %v, want the same answer as for a known email", status, body)
+	}
+	a.mail.noneSent(t)
+}
@@ -0,0 +1,312 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/money"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+// Payment represents a row of the payments table
+type Payment = models.Payment
+
+// registerPaymentRoutes registers the payment routes nested under a debt
+func (s *DebtService) registerPaymentRoutes(router fiber.Router) {
+	router.Get("/:id/payments", s.listPayments)
+	router.Post("/:id/payments", s.createPayment)
+	router.Delete("/:id/payments/:paymentId", s.reversePayment)
+}
+
+// listPayments lists the payments made against a debt
+func (s *DebtService) listPayments(c *fiber.Ctx) error {
+	// Get user ID from context (set by AuthMiddleware)
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	debtID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid debt ID",
+		})
+	}
+
+	// Make sure the debt belongs to the caller so a missing debt is a 404
+	ctx := c.UserContext()
+	if _, err := s.store.Debts().ByID(ctx, userID, debtID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Debt not found",
+			})
+		}
+		log.Printf("Error querying debt: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving payments",
+		})
+	}
+
+	payments, err := s.store.Payments().ListByDebt(ctx, userID, debtID)
+	if err != nil {
+		log.Printf("Error querying payments: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving payments",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"payments": payments,
+	})
+}
+
+// createPayment records a payment and reduces the debt balance
+func (s *DebtService) createPayment(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	debtID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid debt ID",
+		})
+	}
+
+	// Parse request body
+	type PaymentRequest struct {
+		Amount      *money.Amount `json:"amount"`
+		Currency    string        `json:"currency"`
+		Method      string        `json:"method"`
+		PaymentDate string        `json:"payment_date"`
+	}
+
+	var req PaymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate input
+	if req.Amount == nil || req.Method == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Amount and method are required",
+		})
+	}
+	if *req.Amount <= 0 || !isValidAmount(*req.Amount) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Amount must be greater than 0 and at most 99999999.99",
+		})
+	}
+	if !isValidPaymentMethod(req.Method) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Method must be 'bank_transfer', 'credit_card', 'cash', or 'other'",
+		})
+	}
+	if msg := normalizeCurrencyField(&req.Currency); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	paymentDate := time.Now()
+	if req.PaymentDate != "" {
+		paymentDate, err = parsePaymentDate(req.PaymentDate)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Payment date must be in YYYY-MM-DD or RFC 3339 format",
+			})
+		}
+	}
+
+	var payment Payment
+	var debt Debt
+	err = s.store.InTx(c.UserContext(), func(tx repository.Store) error {
+		var err error
+		payment, debt, err = recordPayment(c, tx, userID, debtID, *req.Amount, req.Currency, paymentDate, req.Method)
+		return err
+	})
+	if err != nil {
+		if status, msg, ok := paymentErrorResponse(err); ok {
+			return c.Status(status).JSON(fiber.Map{
+				"error": msg,
+			})
+		}
+		log.Printf("Error recording payment: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error recording payment",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Payment recorded successfully",
+		"payment": payment,
+		"debt":    debt,
+	})
+}
+
+// reversePayment undoes a payment and restores the debt balance
+func (s *DebtService) reversePayment(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	debtID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid debt ID",
+		})
+	}
+	paymentID, err := c.ParamsInt("paymentId")
+	if err != nil || paymentID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid payment ID",
+		})
+	}
+
+	ctx := c.UserContext()
+	var payment Payment
+	var debt Debt
+	err = s.store.InTx(ctx, func(tx repository.Store) error {
+		// Lock the debt first so reversals and new payments are serialized
+		before, err := tx.Debts().ByIDForUpdate(ctx, userID, debtID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errDebtNotFound
+			}
+			return err
+		}
+
+		// The scheduled payment this settled, if any, is due again. This runs
+		// before the delete, which would otherwise unlink it first.
+		if err := tx.ScheduledPayments().Reopen(ctx, userID, paymentID); err != nil {
+			return err
+		}
+
+		payment, err = tx.Payments().Delete(ctx, userID, debtID, paymentID)
+		if err != nil {
+			return err
+		}
+
+		// A reversed payment leaves a balance again, so the debt is active
+		debt, err = tx.Debts().ReversePayment(ctx, userID, debtID, payment.Amount)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.AuditEvents().Record(ctx, changeEvent(c, userID, "payment.delete", "payment", payment.ID, payment, nil)); err != nil {
+			return err
+		}
+		return tx.AuditEvents().Record(ctx, changeEvent(c, userID, "debt.payment_reversal", "debt", debt.ID, before, debt))
+	})
+	switch {
+	case errors.Is(err, errDebtNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Debt not found",
+		})
+	case errors.Is(err, repository.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Payment not found",
+		})
+	case err != nil:
+		log.Printf("Error reversing payment: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error reversing payment",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Payment reversed successfully",
+		"payment": payment,
+		"debt":    debt,
+	})
+}
+
+var (
+	errDebtNotFound          = errors.New("debt not found")
+	errDebtPaidOff           = errors.New("debt is already paid off")
+	errPaymentExceedsBalance = errors.New("payment exceeds the remaining balance")
+	errCurrencyMismatch      = errors.New("payment currency does not match the debt currency")
+)
+
+// recordPayment inserts a payment and reduces the debt balance inside a
+// transaction, flipping the debt to paid_off when the balance reaches zero,
+// and audit-logs both changes. Payments are always in the debt's currency; an
+// empty currency means "the debt's".
+func recordPayment(c *fiber.Ctx, tx repository.Store, userID, debtID int, amount money.Amount, currency string, paymentDate time.Time, method string) (Payment, Debt, error) {
+	ctx := c.UserContext()
+
+	// Lock the debt so concurrent payments cannot overdraw it
+	before, err := tx.Debts().ByIDForUpdate(ctx, userID, debtID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return Payment{}, Debt{}, errDebtNotFound
+		}
+		return Payment{}, Debt{}, err
+	}
+	if before.Status != "active" {
+		return Payment{}, Debt{}, errDebtPaidOff
+	}
+	if currency != "" && currency != before.Currency {
+		return Payment{}, Debt{}, errCurrencyMismatch
+	}
+	if amount > before.Amount {
+		return Payment{}, Debt{}, errPaymentExceedsBalance
+	}
+
+	payment, err := tx.Payments().Create(ctx, Payment{
+		UserID:      userID,
+		DebtID:      debtID,
+		Amount:      amount,
+		Currency:    before.Currency,
+		PaymentDate: paymentDate.Format(time.RFC3339),
+		Method:      method,
+	})
+	if err != nil {
+		return Payment{}, Debt{}, err
+	}
+
+	debt, err := tx.Debts().ApplyPayment(ctx, userID, debtID, payment.Amount)
+	if err != nil {
+		return Payment{}, Debt{}, err
+	}
+
+	if err := tx.AuditEvents().Record(ctx, changeEvent(c, userID, "payment.create", "payment", payment.ID, nil, payment)); err != nil {
+		return Payment{}, Debt{}, err
+	}
+	if err := tx.AuditEvents().Record(ctx, changeEvent(c, userID, "debt.payment", "debt", debt.ID, before, debt)); err != nil {
+		return Payment{}, Debt{}, err
+	}
+
+	return payment, debt, nil
+}
+
+// paymentErrorResponse maps the recordPayment sentinel errors to a status and message
+func paymentErrorResponse(err error) (int, string, bool) {
+	switch {
+	case errors.Is(err, errDebtNotFound):
+		return fiber.StatusNotFound, "Debt not found", true
+	case errors.Is(err, errDebtPaidOff):
+		return fiber.StatusConflict, "Debt is already paid off", true
+	case errors.Is(err, errPaymentExceedsBalance):
+		return fiber.StatusBadRequest, "Payment exceeds the remaining balance", true
+	case errors.Is(err, errCurrencyMismatch):
+		return fiber.StatusBadRequest, "Payment currency must match the debt currency", true
+	}
+	return 0, "", false
+}
+
+// parsePaymentDate accepts either a plain date or a full RFC 3339 timestamp
+func parsePaymentDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(dateLayout, value)
+}
+
+// isValidPaymentMethod mirrors the CHECK constraint on payments.method
+func isValidPaymentMethod(method string) bool {
+	switch method {
+	case "bank_transfer", "credit_card", "cash", "other":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/money"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+func TestPaymentLifecycle(t *testing.T) {
+	store := repository.NewMemoryStore()
+	app := newDebtTest(store)
+	user := store.AddUser(models.User{Name: "Ada", Email: "ada@example.com", BaseCurrency: "USD"})
+	token := accessToken(t, store, user.ID)
+	debt := store.AddDebt(models.Debt{
+		UserID:       user.ID,
+		CreditorName: "Bank",
+		Amount:       money.Amount(10000),
+		Currency:     "USD",
+		Status:       "active",
+	})
+	path := fmt.Sprintf("/api/debts/%d/payments", debt.ID)
+	pay := func(amount string) (int, map[string]interface{}) {
+		return request(t, app, fiber.MethodPost, path, token, map[string]string{
+			"amount":       amount,
+			"method":       "bank_transfer",
+			"payment_date": "2025-01-15",
+		})
+	}
+	debtOf := func(body map[string]interface{}) map[string]interface{} {
+		return body["debt"].(map[string]interface{})
+	}
+
+	if status, body := pay("150.00"); status != fiber.StatusBadRequest {
+		t.Fatalf("overpayment status = %d, want %d, body %v", status, fiber.StatusBadRequest, body)
+	}
+
+	status, body := pay("40.00")
+	if status != fiber.StatusCreated || debtOf(body)["amount"] != "60.00" || debtOf(body)["status"] != "active" {
+		t.Fatalf("partial payment status = %d, body %v, want an active debt of 60.00", status, body)
+	}
+
+	status, body = pay("60.00")
+	if status != fiber.StatusCreated || debtOf(body)["amount"] != "0.00" || debtOf(body)["status"] != "paid_off" {
+		t.Fatalf("final payment status = %d, body %v, want a paid off debt", status, body)
+	}
+	final := body["payment"].(map[string]interface{})["id"]
+
+	if status, body := pay("1.00"); status != fiber.StatusConflict {
+		t.Fatalf("payment on a paid off debt status = %d, want %d, body %v", status, fiber.StatusConflict, body)
+	}
+
+	// Reversing the final payment leaves a balance, so the debt is active again
+	reverse := fmt.Sprintf("%s/%v", path, final)
+	status, body = request(t, app, fiber.MethodDelete, reverse, token, nil)
+	if status != fiber.StatusOK || debtOf(body)["amount"] != "60.00" || debtOf(body)["status"] != "active" {
+		t.Fatalf("reversal status = %d, body %v, want an active debt of 60.00", status, body)
+	}
+	if status, body := request(t, app, fiber.MethodDelete, reverse, token, nil); status != fiber.StatusNotFound {
+		t.Fatalf("second reversal status = %d, want %d, body %v", status, fiber.StatusNotFound, body)
+	}
+
+	status, body = request(t, app, fiber.MethodGet, path, token, nil)
+	if status != fiber.StatusOK || len(body["payments"].([]interface{})) != 1 {
+		t.Fatalf("list status = %d, body %v, want the one remaining payment", status, body)
+	}
+}
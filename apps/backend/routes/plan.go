@@ -0,0 +1,169 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/money"
+	"github.com/kevinlucasklein/zero-balance/planner"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+// PlanService builds payoff plans for the signed-in user's debts
+type PlanService struct {
+	store repository.Store
+}
+
+// NewPlanService returns a PlanService reading debts from store
+func NewPlanService(store repository.Store) *PlanService {
+	return &PlanService{store: store}
+}
+
+// RegisterPlanRoutes registers the debt payoff planner routes
+func RegisterPlanRoutes(app *fiber.App, db *sql.DB, limit fiber.Handler) {
+	// Create a plan group with authentication middleware
+	planGroup := app.Group("/api/plan")
+	planGroup.Use(middleware.AuthMiddleware())
+	planGroup.Use(limit)
+
+	NewPlanService(repository.NewPostgresStore(db)).Register(planGroup)
+}
+
+// Register registers the service's routes on a group that already runs
+// AuthMiddleware
+func (s *PlanService) Register(router fiber.Router) {
+	router.Get("/", s.get)
+}
+
+// get builds a payoff schedule for the caller's active debts
+func (s *PlanService) get(c *fiber.Ctx) error {
+	// Get user ID from context (set by AuthMiddleware)
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	strategy, budget, order, msg := parsePlanQuery(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	inputs, err := loadPlannerInputs(c.UserContext(), s.store, userID)
+	if err != nil {
+		if errors.Is(err, errNoExchangeRate) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		log.Printf("Error querying debts for plan: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error building payoff plan",
+		})
+	}
+
+	// Every planner error describes an unworkable plan, not a server fault
+	plan, err := planner.Build(inputs.debts, budget, strategy, order, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	plan.Currency = inputs.base
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"plan": plan,
+	})
+}
+
+// parsePlanQuery reads strategy, budget and order from the query string and
+// returns a user-facing error message if any of them is invalid
+func parsePlanQuery(c *fiber.Ctx) (planner.Strategy, money.Amount, []int, string) {
+	budget, err := money.Parse(c.Query("budget"))
+	if err != nil {
+		return "", 0, nil, "Budget must be a positive amount"
+	}
+
+	var order []int
+	if raw := c.Query("order"); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || id <= 0 {
+				return "", 0, nil, "Order must be a comma-separated list of debt IDs"
+			}
+			order = append(order, id)
+		}
+	}
+
+	strategy, msg := validatePlanParams(c.Query("strategy", string(planner.Avalanche)), budget, order)
+	return strategy, budget, order, msg
+}
+
+// validatePlanParams checks the planner inputs shared by every plan endpoint
+// and returns a user-facing error message if any of them is invalid
+func validatePlanParams(strategyName string, budget money.Amount, order []int) (planner.Strategy, string) {
+	strategy, err := planner.ParseStrategy(strategyName)
+	if err != nil {
+		return "", "Strategy must be 'avalanche', 'snowball', or 'custom'"
+	}
+	if budget <= 0 || budget > money.MaxAmount {
+		return "", "Budget must be a positive amount"
+	}
+	if strategy == planner.Custom && len(order) == 0 {
+		return "", "Order is required for the custom strategy"
+	}
+	return strategy, ""
+}
+
+// plannerInputs are a user's active debts converted into their base currency
+type plannerInputs struct {
+	base       string
+	rates      rateTable
+	debts      []planner.Debt
+	currencies map[int]string // Each debt's own currency, keyed by debt ID
+}
+
+// loadPlannerInputs returns the user's active debts in the shape the planner
+// expects, with balances and minimum payments converted to the base currency
+func loadPlannerInputs(ctx context.Context, store repository.Store, userID int) (*plannerInputs, error) {
+	user, err := store.Users().ByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := store.ExchangeRates().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	debts, err := store.Debts().ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	base := user.BaseCurrency
+	table := newRateTable(rates)
+	inputs := &plannerInputs{base: base, rates: table, debts: []planner.Debt{}, currencies: map[int]string{}}
+	for _, d := range debts {
+		if d.Status != "active" || d.Amount <= 0 {
+			continue
+		}
+		debt := planner.Debt{
+			ID:           d.ID,
+			Name:         d.CreditorName,
+			InterestRate: d.InterestRate,
+		}
+		if debt.Balance, err = table.convert(d.Amount, d.Currency, base); err != nil {
+			return nil, err
+		}
+		if debt.MinimumPayment, err = table.convert(d.MinimumPayment, d.Currency, base); err != nil {
+			return nil, err
+		}
+		inputs.debts = append(inputs.debts, debt)
+		inputs.currencies[d.ID] = d.Currency
+	}
+	return inputs, nil
+}
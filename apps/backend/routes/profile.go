@@ -3,226 +3,321 @@ package routes
 import (
 	"database/sql"
 	"log"
+	"slices"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/money"
+	"github.com/kevinlucasklein/zero-balance/repository"
+	"github.com/kevinlucasklein/zero-balance/utils"
 )
 
+// profileChange is the audit-logged state of the editable profile fields
+type profileChange struct {
+	Name         string `json:"name"`
+	BaseCurrency string `json:"base_currency"`
+}
+
+// ProfileService serves the signed-in user's profile, password and statistics
+type ProfileService struct {
+	store repository.Store
+}
+
+// NewProfileService returns a ProfileService keeping accounts in store
+func NewProfileService(store repository.Store) *ProfileService {
+	return &ProfileService{store: store}
+}
+
 // RegisterProfileRoutes registers all profile-related routes
-func RegisterProfileRoutes(app *fiber.App, db *sql.DB) {
+func RegisterProfileRoutes(app *fiber.App, db *sql.DB, limit fiber.Handler) {
 	// Create a profile group with authentication middleware
 	profileGroup := app.Group("/api/profile")
 	profileGroup.Use(middleware.AuthMiddleware())
+	profileGroup.Use(limit)
 
-	// Get user profile
-	profileGroup.Get("/", func(c *fiber.Ctx) error {
-		// Get user ID from context (set by AuthMiddleware)
-		userID := c.Locals("userID").(int)
+	NewProfileService(repository.NewPostgresStore(db)).Register(profileGroup)
+}
 
-		// Query user profile from database
-		var name string
-		var email string
-		var createdAt string
-		err := db.QueryRow(
-			"SELECT name, email, created_at FROM users WHERE id = $1",
-			userID,
-		).Scan(&name, &email, &createdAt)
+// Register registers the service's routes on a group that already runs
+// AuthMiddleware
+func (s *ProfileService) Register(router fiber.Router) {
+	router.Get("/", s.get)
+	router.Put("/", s.update)
+	router.Put("/password", s.changePassword)
+	router.Get("/stats", s.stats)
 
-		if err != nil {
-			log.Printf("Error querying user profile: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error retrieving user profile",
-			})
-		}
+	// Register data export and account deletion routes
+	registerAccountRoutes(router, s.store)
+}
+
+// get returns the user's profile
+func (s *ProfileService) get(c *fiber.Ctx) error {
+	// Get user ID from context (set by AuthMiddleware)
+	userID := middleware.CurrentPrincipal(c).UserID
 
-		// Return user profile
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"profile": fiber.Map{
-				"id":         userID,
-				"name":       name,
-				"email":      email,
-				"created_at": createdAt,
-			},
+	user, err := s.store.Users().ByID(c.UserContext(), userID)
+	if err != nil {
+		log.Printf("Error querying user profile: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving user profile",
 		})
-	})
+	}
 
-	// Update user profile
-	profileGroup.Put("/", func(c *fiber.Ctx) error {
-		// Get user ID from context (set by AuthMiddleware)
-		userID := c.Locals("userID").(int)
+	// Return user profile
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"profile": user,
+	})
+}
 
-		// Parse request body
-		type UpdateProfileRequest struct {
-			Name string `json:"name"`
-		}
+// update changes the user's name and base currency
+func (s *ProfileService) update(c *fiber.Ctx) error {
+	// Get user ID from context (set by AuthMiddleware)
+	userID := middleware.CurrentPrincipal(c).UserID
 
-		var req UpdateProfileRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid request format",
-			})
-		}
+	// Parse request body
+	type UpdateProfileRequest struct {
+		Name         string `json:"name"`
+		BaseCurrency string `json:"base_currency"`
+	}
 
-		// Validate input
-		if req.Name == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Name is required",
-			})
-		}
+	var req UpdateProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
 
-		// Update user profile in database
-		_, err := db.Exec(
-			"UPDATE users SET name = $1 WHERE id = $2",
-			req.Name, userID,
-		)
+	// Validate input
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Name is required",
+		})
+	}
+	if msg := normalizeCurrencyField(&req.BaseCurrency); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
 
+	ctx := c.UserContext()
+	var user models.User
+	err := s.store.InTx(ctx, func(tx repository.Store) error {
+		// Lock the user, the current profile goes into the audit log
+		before, err := tx.Users().ByIDForUpdate(ctx, userID)
 		if err != nil {
-			log.Printf("Error updating user profile: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error updating user profile",
-			})
+			return err
 		}
 
-		// Return success
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"message": "Profile updated successfully",
-			"profile": fiber.Map{
-				"id":   userID,
-				"name": req.Name,
-			},
-		})
-	})
-
-	// Change password
-	profileGroup.Put("/password", func(c *fiber.Ctx) error {
-		// Get user ID from context (set by AuthMiddleware)
-		userID := c.Locals("userID").(int)
-
-		// Parse request body
-		type ChangePasswordRequest struct {
-			CurrentPassword string `json:"current_password"`
-			NewPassword     string `json:"new_password"`
+		// Keep the base currency when it is omitted
+		user, err = tx.Users().UpdateProfile(ctx, userID, req.Name, req.BaseCurrency)
+		if err != nil {
+			return err
 		}
 
-		var req ChangePasswordRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid request format",
-			})
-		}
+		return tx.AuditEvents().Record(ctx, changeEvent(c, userID, "profile.update", "user", userID,
+			profileChange{Name: before.Name, BaseCurrency: before.BaseCurrency},
+			profileChange{Name: user.Name, BaseCurrency: user.BaseCurrency},
+		))
+	})
+	if err != nil {
+		log.Printf("Error updating user profile: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error updating user profile",
+		})
+	}
 
-		// Validate input
-		if req.CurrentPassword == "" || req.NewPassword == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Current password and new password are required",
-			})
-		}
+	// Return success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Profile updated successfully",
+		"profile": fiber.Map{
+			"id":            user.ID,
+			"name":          user.Name,
+			"base_currency": user.BaseCurrency,
+		},
+	})
+}
 
-		// Get current password hash from database
-		var passwordHash string
-		err := db.QueryRow(
-			"SELECT password_hash FROM users WHERE id = $1",
-			userID,
-		).Scan(&passwordHash)
+// changePassword replaces the user's password after checking the current one
+func (s *ProfileService) changePassword(c *fiber.Ctx) error {
+	// Get user ID from context (set by AuthMiddleware)
+	userID := middleware.CurrentPrincipal(c).UserID
 
-		if err != nil {
-			log.Printf("Error querying user password: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error processing your request",
-			})
-		}
+	// Parse request body
+	type ChangePasswordRequest struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
 
-		// Import the utils package for password hashing
-		// This is a circular import, so we'll need to refactor later
-		// For now, we'll just return a placeholder response
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"message": "Password change functionality will be implemented soon",
+	var req ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
 		})
+	}
 
-		// TODO: Implement password change logic
-		// Verify current password
-		// Hash new password
-		// Update password in database
-	})
+	// Validate input
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Current password and new password are required",
+		})
+	}
+	if err := utils.ValidatePassword(req.NewPassword); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 
-	// Get user statistics
-	profileGroup.Get("/stats", func(c *fiber.Ctx) error {
-		// Get user ID from context (set by AuthMiddleware)
-		userID := c.Locals("userID").(int)
+	ctx := c.UserContext()
+	user, err := s.store.Users().ByID(ctx, userID)
+	if err != nil {
+		log.Printf("Error querying user password: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
 
-		// Query total debt
-		var totalDebt float64
-		err := db.QueryRow(
-			"SELECT COALESCE(SUM(amount), 0) FROM debts WHERE user_id = $1 AND status = 'active'",
-			userID,
-		).Scan(&totalDebt)
+	// Accounts created through a sign-in provider set their first password
+	// with a reset link, as they have no current password to confirm
+	if user.PasswordHash == "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Your account has no password yet, use forgot password to set one",
+		})
+	}
 
-		if err != nil {
-			log.Printf("Error querying total debt: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error retrieving user statistics",
-			})
-		}
+	// Verify current password
+	if !utils.CheckPasswordHash(req.CurrentPassword, user.PasswordHash) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Current password is incorrect",
+		})
+	}
+	if utils.CheckPasswordHash(req.NewPassword, user.PasswordHash) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "New password must be different from the current password",
+		})
+	}
 
-		// Query total income
-		var totalIncome float64
-		err = db.QueryRow(
-			"SELECT COALESCE(SUM(amount), 0) FROM income_sources WHERE user_id = $1",
-			userID,
-		).Scan(&totalIncome)
+	// Hash new password
+	newHash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
 
+	var tokens authTokens
+	err = s.store.InTx(ctx, func(tx repository.Store) error {
+		// Update the password, revoking every token issued before the change
+		tokenVersion, err := setPassword(ctx, tx, userID, newHash)
 		if err != nil {
-			log.Printf("Error querying total income: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error retrieving user statistics",
-			})
+			return err
 		}
 
-		// Query debt count
-		var debtCount int
-		err = db.QueryRow(
-			"SELECT COUNT(*) FROM debts WHERE user_id = $1 AND status = 'active'",
-			userID,
-		).Scan(&debtCount)
+		// Issue fresh tokens so the caller stays signed in
+		tokens, err = issueTokens(c, tx, userID, tokenVersion, "")
+		return err
+	})
+	if err != nil {
+		log.Printf("Error updating user password: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error processing your request",
+		})
+	}
+	middleware.ForgetUserSessions(userID)
 
-		if err != nil {
-			log.Printf("Error querying debt count: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error retrieving user statistics",
-			})
-		}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":       "Password changed successfully",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
 
-		// Query income sources count
-		var incomeSourcesCount int
-		err = db.QueryRow(
-			"SELECT COUNT(*) FROM income_sources WHERE user_id = $1",
-			userID,
-		).Scan(&incomeSourcesCount)
+// stats totals the user's debts and income in their base currency
+func (s *ProfileService) stats(c *fiber.Ctx) error {
+	// Get user ID from context (set by AuthMiddleware)
+	userID := middleware.CurrentPrincipal(c).UserID
+	ctx := c.UserContext()
+
+	// Load the base currency and the rates used to convert into it
+	user, err := s.store.Users().ByID(ctx, userID)
+	if err != nil {
+		log.Printf("Error querying base currency: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving user statistics",
+		})
+	}
+	rates, err := s.store.ExchangeRates().List(ctx)
+	if err != nil {
+		log.Printf("Error querying exchange rates: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving user statistics",
+		})
+	}
 
-		if err != nil {
-			log.Printf("Error querying income sources count: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error retrieving user statistics",
-			})
-		}
+	debts, err := s.store.Debts().ActiveTotals(ctx, userID)
+	if err != nil {
+		log.Printf("Error querying total debt: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving user statistics",
+		})
+	}
+	income, err := s.store.IncomeSources().Totals(ctx, userID)
+	if err != nil {
+		log.Printf("Error querying total income: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving user statistics",
+		})
+	}
 
-		// Return user statistics
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"stats": fiber.Map{
-				"total_debt":           totalDebt,
-				"total_income":         totalIncome,
-				"debt_count":           debtCount,
-				"income_sources_count": incomeSourcesCount,
-				"debt_to_income_ratio": calculateRatio(totalDebt, totalIncome),
-			},
+	// Convert the per-currency sums into the base currency
+	table := newRateTable(rates)
+	totalDebt, err := convertTotals(debts, user.BaseCurrency, table)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
 		})
+	}
+	totalIncome, err := convertTotals(income, user.BaseCurrency, table)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Return user statistics
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"stats": fiber.Map{
+			"currency":             user.BaseCurrency,
+			"total_debt":           totalDebt,
+			"total_income":         totalIncome,
+			"debt_by_currency":     debts.ByCurrency,
+			"income_by_currency":   income.ByCurrency,
+			"debt_count":           debts.Count,
+			"income_sources_count": income.Count,
+			"debt_to_income_ratio": money.Ratio(totalDebt, totalIncome),
+		},
 	})
 }
 
-// Helper function to calculate ratio
-func calculateRatio(debt, income float64) float64 {
-	if income == 0 {
-		return 0
+// convertTotals converts per-currency sums into the base currency and adds
+// them up. Only a missing exchange rate fails, and currencies are converted
+// in order so the same one is always reported.
+func convertTotals(totals repository.Totals, base string, rates rateTable) (money.Amount, error) {
+	currencies := make([]string, 0, len(totals.ByCurrency))
+	for currency := range totals.ByCurrency {
+		currencies = append(currencies, currency)
+	}
+	slices.Sort(currencies)
+
+	var total money.Amount
+	for _, currency := range currencies {
+		converted, err := rates.convert(totals.ByCurrency[currency], currency, base)
+		if err != nil {
+			return 0, err
+		}
+		total += converted
 	}
-	return debt / income
+	return total, nil
 }
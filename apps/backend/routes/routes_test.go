@@ -0,0 +1,181 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/lockout"
+	"github.com/kevinlucasklein/zero-balance/mailer"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/repository"
+	"github.com/kevinlucasklein/zero-balance/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestApp returns an app for handler tests. The memory store keeps the
+// strings handlers pass it, so they must not point into buffers fiber reuses.
+func newTestApp() *fiber.App {
+	return fiber.New(fiber.Config{Immutable: true})
+}
+
+// request sends a request with a JSON body to app, authorized with token
+// when it is set, and returns the status and decoded JSON response
+func request(t *testing.T, app *fiber.App, method, path, token string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	response := map[string]interface{}{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil && err != io.EOF {
+		t.Fatalf("%s %s: decoding response: %v", method, path, err)
+	}
+	return resp.StatusCode, response
+}
+
+// testSessions numbers the sessions accessToken records
+var testSessions atomic.Int64
+
+// accessToken records a new login session for a user and returns an access
+// token for it, as a login would issue
+func accessToken(t *testing.T, store *repository.MemoryStore, userID int) string {
+	t.Helper()
+	return sessionToken(t, store, userID, fmt.Sprintf("test-session-%d", testSessions.Add(1)))
+}
+
+// sessionToken records a login session for a user and returns an access
+// token for it
+func sessionToken(t *testing.T, store *repository.MemoryStore, userID int, sessionID string) string {
+	t.Helper()
+	useSessions(t, store)
+	if err := store.Tokens().TouchSession(context.Background(), sessionID, userID, "test", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { middleware.ForgetSession(sessionID) })
+	token, err := utils.GenerateJWT(userID, 0, sessionID, []string{"user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// useSessions makes AuthMiddleware check sessions against store until the
+// test ends
+func useSessions(t *testing.T, store *repository.MemoryStore) {
+	t.Helper()
+	middleware.SetSessionLookup(store.SessionState)
+	t.Cleanup(func() { middleware.SetSessionLookup(nil) })
+}
+
+// noLimit stands in for a rate limiter that lets every request through
+func noLimit(c *fiber.Ctx) error {
+	return c.Next()
+}
+
+// passwordHash hashes a password at the lowest cost, as utils.HashPassword
+// is too slow to call for every test account
+func passwordHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+// testMailer captures the emails handlers send, which they do in the background
+type testMailer struct {
+	sent chan mailer.Message
+}
+
+func newTestMailer() *testMailer {
+	return &testMailer{sent: make(chan mailer.Message, 10)}
+}
+
+// Send implements mailer.Mailer
+func (m *testMailer) Send(msg mailer.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+// next waits for the next email sent
+func (m *testMailer) next(t *testing.T) mailer.Message {
+	t.Helper()
+	select {
+	case msg := <-m.sent:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email sent")
+		return mailer.Message{}
+	}
+}
+
+// noneSent checks that no email arrives for a short while
+func (m *testMailer) noneSent(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-m.sent:
+		t.Fatalf("email sent to %s, want none", msg.To)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+var linkToken = regexp.MustCompile(`[?&]token=([^&\s]+)`)
+
+// emailedToken returns the one-time token of the link in an email
+func emailedToken(t *testing.T, msg mailer.Message) string {
+	t.Helper()
+	match := linkToken.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("email has no token link: %q", msg.Body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// authTest is an AuthService over a memory store
+type authTest struct {
+	app   *fiber.App
+	store *repository.MemoryStore
+	mail  *testMailer
+}
+
+func newAuthTest(t *testing.T) *authTest {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	mail := newTestMailer()
+	app := newTestApp()
+	useSessions(t, store)
+	NewAuthService(store, mail, lockout.NewMemoryStore(), noLimit).Register(app)
+	return &authTest{app: app, store: store, mail: mail}
+}
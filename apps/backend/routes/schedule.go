@@ -0,0 +1,433 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/money"
+	"github.com/kevinlucasklein/zero-balance/planner"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+// Bounds on how far ahead scheduled payments are generated
+const (
+	defaultScheduleMonths = 3
+	maxScheduleMonths     = 24
+)
+
+// ScheduledPayment represents a row of the scheduled_payments table
+type ScheduledPayment = models.ScheduledPayment
+
+// ScheduleService serves the signed-in user's scheduled payments
+type ScheduleService struct {
+	store repository.Store
+}
+
+// NewScheduleService returns a ScheduleService keeping scheduled payments in store
+func NewScheduleService(store repository.Store) *ScheduleService {
+	return &ScheduleService{store: store}
+}
+
+// RegisterScheduleRoutes registers the scheduled payment routes
+func RegisterScheduleRoutes(app *fiber.App, db *sql.DB, limit fiber.Handler) {
+	// Create a scheduled payments group with authentication middleware
+	scheduleGroup := app.Group("/api/scheduled-payments")
+	scheduleGroup.Use(middleware.AuthMiddleware())
+	scheduleGroup.Use(limit)
+
+	NewScheduleService(repository.NewPostgresStore(db)).Register(scheduleGroup)
+}
+
+// Register registers the service's routes on a group that already runs
+// AuthMiddleware
+func (s *ScheduleService) Register(router fiber.Router) {
+	router.Get("/", s.list)
+	router.Post("/generate", s.generate)
+	router.Put("/:id/complete", s.complete)
+	router.Put("/:id/skip", s.skip)
+}
+
+// list lists scheduled payments, optionally filtered by status
+func (s *ScheduleService) list(c *fiber.Ctx) error {
+	// Get user ID from context (set by AuthMiddleware)
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	status := c.Query("status")
+	if status != "" && !isValidScheduledStatus(status) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Status must be 'pending', 'completed', or 'skipped'",
+		})
+	}
+
+	scheduled, err := s.store.ScheduledPayments().ListByStatus(c.UserContext(), userID, status)
+	if err != nil {
+		log.Printf("Error querying scheduled payments: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving scheduled payments",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"scheduled_payments": scheduled,
+	})
+}
+
+// generate replaces pending scheduled payments with the next months of a
+// payoff plan
+func (s *ScheduleService) generate(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	// Parse request body
+	type GenerateRequest struct {
+		Strategy string       `json:"strategy"`
+		Budget   money.Amount `json:"budget"`
+		Order    []int        `json:"order"`
+		Months   int          `json:"months"`
+	}
+
+	var req GenerateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate input
+	if req.Strategy == "" {
+		req.Strategy = string(planner.Avalanche)
+	}
+	strategy, msg := validatePlanParams(req.Strategy, req.Budget, req.Order)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if req.Months == 0 {
+		req.Months = defaultScheduleMonths
+	}
+	if req.Months < 1 || req.Months > maxScheduleMonths {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Months must be between 1 and 24",
+		})
+	}
+
+	ctx := c.UserContext()
+	scheduled := []ScheduledPayment{}
+	err := s.store.InTx(ctx, func(tx repository.Store) error {
+		// Lock the user's debts so the plan is built from a consistent snapshot
+		if err := tx.Debts().LockByUser(ctx, userID); err != nil {
+			return err
+		}
+
+		inputs, err := loadPlannerInputs(ctx, tx, userID)
+		if err != nil {
+			if errors.Is(err, errNoExchangeRate) {
+				return unworkablePlan{err}
+			}
+			return err
+		}
+
+		now := time.Now()
+		plan, err := planner.Build(inputs.debts, req.Budget, strategy, req.Order, now)
+		if err != nil {
+			return unworkablePlan{err}
+		}
+
+		months := plan.Schedule
+		if len(months) > req.Months {
+			months = months[:req.Months]
+		}
+
+		horizon := time.Date(now.Year(), now.Month()+time.Month(req.Months)+1, 1, 0, 0, 0, 0, time.UTC)
+		paydays, err := loadPaydays(ctx, tx, userID, horizon)
+		if err != nil {
+			return err
+		}
+
+		// Completed and skipped rows are history, only pending ones are replaced
+		if err := tx.ScheduledPayments().DeletePending(ctx, userID); err != nil {
+			return err
+		}
+
+		for _, month := range months {
+			monthStart, err := time.Parse("2006-01", month.Date)
+			if err != nil {
+				return err
+			}
+			date := scheduleDateInMonth(monthStart, paydays)
+
+			for _, p := range month.Payments {
+				if p.Payment <= 0 {
+					continue
+				}
+
+				// The plan is in the base currency, payments are made in the debt's
+				currency := inputs.currencies[p.DebtID]
+				recommended, err := inputs.rates.convert(p.Payment, inputs.base, currency)
+				if err != nil {
+					return unworkablePlan{err}
+				}
+
+				sp, err := tx.ScheduledPayments().Create(ctx, ScheduledPayment{
+					UserID:            userID,
+					DebtID:            p.DebtID,
+					RecommendedAmount: recommended,
+					Currency:          currency,
+					ScheduledDate:     date.Format(dateLayout),
+				})
+				if err != nil {
+					return err
+				}
+				scheduled = append(scheduled, sp)
+			}
+		}
+		return nil
+	})
+	var unworkable unworkablePlan
+	switch {
+	case errors.As(err, &unworkable):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": unworkable.Error(),
+		})
+	case err != nil:
+		log.Printf("Error generating scheduled payments: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error generating scheduled payments",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":            "Scheduled payments generated successfully",
+		"scheduled_payments": scheduled,
+	})
+}
+
+// complete completes a scheduled payment by recording the matching payment
+func (s *ScheduleService) complete(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	scheduledID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid scheduled payment ID",
+		})
+	}
+
+	// Parse request body; amount defaults to the recommended amount
+	type CompleteRequest struct {
+		Amount      *money.Amount `json:"amount"`
+		Method      string        `json:"method"`
+		PaymentDate string        `json:"payment_date"`
+	}
+
+	var req CompleteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate input
+	if !isValidPaymentMethod(req.Method) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Method must be 'bank_transfer', 'credit_card', 'cash', or 'other'",
+		})
+	}
+	if req.Amount != nil && (*req.Amount <= 0 || !isValidAmount(*req.Amount)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Amount must be greater than 0 and at most 99999999.99",
+		})
+	}
+	paymentDate := time.Now()
+	if req.PaymentDate != "" {
+		paymentDate, err = parsePaymentDate(req.PaymentDate)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Payment date must be in YYYY-MM-DD or RFC 3339 format",
+			})
+		}
+	}
+
+	ctx := c.UserContext()
+	var sp ScheduledPayment
+	var payment Payment
+	var debt Debt
+	err = s.store.InTx(ctx, func(tx repository.Store) error {
+		var err error
+		sp, err = tx.ScheduledPayments().ByIDForUpdate(ctx, userID, scheduledID)
+		if err != nil {
+			return err
+		}
+		if sp.Status != "pending" {
+			return errScheduledNotPending
+		}
+
+		amount := sp.RecommendedAmount
+		if req.Amount != nil {
+			amount = *req.Amount
+		} else {
+			// A converted recommendation can round a cent above what is left
+			current, err := tx.Debts().ByID(ctx, userID, sp.DebtID)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+			if err == nil && current.Amount < amount {
+				amount = current.Amount
+			}
+		}
+
+		payment, debt, err = recordPayment(c, tx, userID, sp.DebtID, amount, sp.Currency, paymentDate, req.Method)
+		if err != nil {
+			return err
+		}
+
+		sp, err = tx.ScheduledPayments().Complete(ctx, userID, scheduledID, payment.ID)
+		return err
+	})
+	if status, msg, ok := paymentErrorResponse(err); ok {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Scheduled payment not found",
+		})
+	case errors.Is(err, errScheduledNotPending):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only pending scheduled payments can be completed",
+		})
+	case err != nil:
+		log.Printf("Error completing scheduled payment: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error completing scheduled payment",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":           "Scheduled payment completed successfully",
+		"scheduled_payment": sp,
+		"payment":           payment,
+		"debt":              debt,
+	})
+}
+
+// skip skips a pending scheduled payment
+func (s *ScheduleService) skip(c *fiber.Ctx) error {
+	userID := middleware.CurrentPrincipal(c).UserID
+
+	scheduledID, err := parseIDParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid scheduled payment ID",
+		})
+	}
+
+	ctx := c.UserContext()
+	var sp ScheduledPayment
+	err = s.store.InTx(ctx, func(tx repository.Store) error {
+		current, err := tx.ScheduledPayments().ByIDForUpdate(ctx, userID, scheduledID)
+		if err != nil {
+			return err
+		}
+		if current.Status != "pending" {
+			return errScheduledNotPending
+		}
+
+		sp, err = tx.ScheduledPayments().Skip(ctx, userID, scheduledID)
+		return err
+	})
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Scheduled payment not found",
+		})
+	case errors.Is(err, errScheduledNotPending):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only pending scheduled payments can be skipped",
+		})
+	case err != nil:
+		log.Printf("Error skipping scheduled payment: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error skipping scheduled payment",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":           "Scheduled payment skipped",
+		"scheduled_payment": sp,
+	})
+}
+
+// errScheduledNotPending is returned when completing or skipping a scheduled
+// payment that is already completed or skipped
+var errScheduledNotPending = errors.New("scheduled payment is not pending")
+
+// unworkablePlan is returned from a transaction when the user's debts cannot
+// be planned as asked, with the error to show
+type unworkablePlan struct {
+	error
+}
+
+// loadPaydays returns every payday of the user's income sources from their
+// next_pay_date up to, but not including, horizon, in ascending order.
+// Irregular sources only contribute their next_pay_date.
+func loadPaydays(ctx context.Context, store repository.Store, userID int, horizon time.Time) ([]time.Time, error) {
+	sources, err := store.IncomeSources().ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var paydays []time.Time
+	for _, source := range sources {
+		date, err := time.Parse(dateLayout, source.NextPayDate)
+		if err != nil {
+			return nil, err
+		}
+		payDay := date.Day()
+		if source.PayDay != nil {
+			payDay = *source.PayDay
+		}
+		for date.Before(horizon) {
+			paydays = append(paydays, date)
+			next := NextPayDate(date, source.Frequency, payDay)
+			if !next.After(date) {
+				break
+			}
+			date = next
+		}
+	}
+
+	sort.Slice(paydays, func(i, j int) bool { return paydays[i].Before(paydays[j]) })
+	return paydays, nil
+}
+
+// scheduleDateInMonth lines a plan month up with the first payday that falls
+// in it, so the payment is due right after money comes in. Months without a
+// known payday fall back to the first of the month.
+func scheduleDateInMonth(monthStart time.Time, paydays []time.Time) time.Time {
+	monthEnd := monthStart.AddDate(0, 1, 0)
+	for _, payday := range paydays {
+		if !payday.Before(monthStart) && payday.Before(monthEnd) {
+			return payday
+		}
+	}
+	return monthStart
+}
+
+// isValidScheduledStatus mirrors the CHECK constraint on scheduled_payments.status
+func isValidScheduledStatus(status string) bool {
+	switch status {
+	case "pending", "completed", "skipped":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/models"
+	"github.com/kevinlucasklein/zero-balance/money"
+	"github.com/kevinlucasklein/zero-balance/repository"
+)
+
+// newScheduleTest returns an app serving a ScheduleService over store
+func newScheduleTest(store repository.Store) *fiber.App {
+	app := newTestApp()
+	NewScheduleService(store).Register(app.Group("/api/schedule", middleware.AuthMiddleware()))
+	return app
+}
+
+func TestGenerateReplacesOnlyPending(t *testing.T) {
+	store := repository.NewMemoryStore()
+	app := newScheduleTest(store)
+	user := store.AddUser(models.User{Name: "Ada", Email: "ada@example.com", BaseCurrency: "USD"})
+	token := accessToken(t, store, user.ID)
+	debt := store.AddDebt(models.Debt{
+		UserID:         user.ID,
+		CreditorName:   "Bank",
+		Amount:         money.Amount(100000),
+		MinimumPayment: money.Amount(10000),
+		Currency:       "USD",
+		DueDate:        "2025-01-15",
+		Status:         "active",
+	})
+	for _, status := range []string{"pending", "completed", "skipped"} {
+		store.AddScheduledPayment(models.ScheduledPayment{
+			UserID:            user.ID,
+			DebtID:            debt.ID,
+			RecommendedAmount: money.Amount(10000),
+			Currency:          "USD",
+			ScheduledDate:     "2024-12-01",
+			Status:            status,
+		})
+	}
+
+	// Generating twice replaces the first run's rows rather than adding to them
+	for run := 1; run <= 2; run++ {
+		status, body := request(t, app, fiber.MethodPost, "/api/schedule/generate", token, map[string]interface{}{
+			"budget": "200.00",
+			"months": 3,
+		})
+		if status != fiber.StatusCreated || len(body["scheduled_payments"].([]interface{})) != 3 {
+			t.Fatalf("run %d: status = %d, body %v, want 3 scheduled payments", run, status, body)
+		}
+	}
+
+	for status, want := range map[string]int{"pending": 3, "completed": 1, "skipped": 1} {
+		code, body := request(t, app, fiber.MethodGet, "/api/schedule/?status="+status, token, nil)
+		if code != fiber.StatusOK || len(body["scheduled_payments"].([]interface{})) != want {
+			t.Fatalf("%s: status %d, body %v, want %d scheduled payments", status, code, body, want)
+		}
+	}
+}
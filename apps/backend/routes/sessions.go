@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/middleware"
+	"github.com/kevinlucasklein/zero-balance/repository"
+	"github.com/kevinlucasklein/zero-balance/utils"
+)
+
+// maxUserAgentLength caps the user agent stored with a session
+const maxUserAgentLength = 512
+
+// registerSessionRoutes registers the routes listing and revoking a user's
+// sessions, rate limited by user with limit
+func registerSessionRoutes(router fiber.Router, store repository.Store, limit fiber.Handler) {
+	// Create a sessions group with authentication middleware
+	sessionGroup := router.Group("/api/auth/sessions")
+	sessionGroup.Use(middleware.AuthMiddleware())
+	sessionGroup.Use(limit)
+
+	// List the caller's active sessions, most recently used first
+	sessionGroup.Get("/", func(c *fiber.Ctx) error {
+		principal := middleware.CurrentPrincipal(c)
+
+		sessions, err := store.Tokens().ListSessions(c.UserContext(), principal.UserID, utils.RefreshTokenTTL)
+		if err != nil {
+			log.Printf("Error querying sessions: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error retrieving sessions",
+			})
+		}
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == principal.SessionID
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"sessions": sessions,
+		})
+	})
+
+	// Log out everywhere, including this session
+	sessionGroup.Delete("/", func(c *fiber.Ctx) error {
+		userID := middleware.CurrentPrincipal(c).UserID
+
+		var revoked int
+		err := store.InTx(c.UserContext(), func(tx repository.Store) error {
+			var err error
+			revoked, err = tx.Tokens().RevokeAllForUser(c.UserContext(), userID)
+			return err
+		})
+		if err != nil {
+			log.Printf("Error revoking sessions: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+		middleware.ForgetUserSessions(userID)
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Logged out of every session",
+			"revoked": revoked,
+		})
+	})
+
+	// Log out a single session
+	sessionGroup.Delete("/:id", func(c *fiber.Ctx) error {
+		userID := middleware.CurrentPrincipal(c).UserID
+		sessionID := c.Params("id")
+
+		// Only the owner may revoke a session
+		err := store.InTx(c.UserContext(), func(tx repository.Store) error {
+			return tx.Tokens().RevokeSession(c.UserContext(), userID, sessionID)
+		})
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Session not found",
+				})
+			}
+			log.Printf("Error revoking session: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error processing your request",
+			})
+		}
+		middleware.ForgetSession(sessionID)
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Session logged out successfully",
+		})
+	})
+}
+
+// sessionUserAgent returns the caller's user agent as stored with a session
+func sessionUserAgent(c *fiber.Ctx) string {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+	return userAgent
+}
+
+// endAllSessions logs a user out everywhere at once: it bumps the token
+// version, which rejects every outstanding access token, and revokes every
+// refresh token and session. It returns the new token version. Once the
+// change is committed, callers drop the user's cached sessions with
+// middleware.ForgetUserSessions.
+func endAllSessions(ctx context.Context, store repository.Store, userID int) (int, error) {
+	tokenVersion, err := store.Users().BumpTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = store.Tokens().RevokeAllForUser(ctx, userID)
+	return tokenVersion, err
+}
@@ -0,0 +1,146 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kevinlucasklein/zero-balance/models"
+)
+
+func TestListSessions(t *testing.T) {
+	a := newAuthTest(t)
+	user := a.store.AddUser(models.User{Name: "Ada", Email: "ada@example.com"})
+	other := a.store.AddUser(models.User{Name: "Bob", Email: "bob@example.com"})
+	sessionToken(t, a.store, user.ID, "laptop")
+	token := sessionToken(t, a.store, user.ID, "phone")
+	sessionToken(t, a.store, other.ID, "bobs-phone")
+
+	status, body := request(t, a.app, fiber.MethodGet, "/api/auth/sessions", token, nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("status %d, body %v", status, body)
+	}
+
+	sessions := body["sessions"].([]interface{})
+	current := map[string]bool{}
+	for _, s := range sessions {
+		session := s.(map[string]interface{})
+		current[session["id"].(string)] = session["current"].(bool)
+	}
+	want := map[string]bool{"laptop": false, "phone": true}
+	if len(current) != len(want) || current["laptop"] != want["laptop"] || current["phone"] != want["phone"] {
+		t.Fatalf("sessions %v, want %v", current, want)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		sessionID  string
+		wantStatus int
+		// wantLive is the user's live sessions afterwards
+		wantLive []string
+	}{
+		{
+			name:       "own session",
+			sessionID:  "laptop",
+			wantStatus: fiber.StatusOK,
+			wantLive:   []string{"phone"},
+		},
+		{
+			name:       "another user's session",
+			sessionID:  "bobs-phone",
+			wantStatus: fiber.StatusNotFound,
+			wantLive:   []string{"laptop", "phone"},
+		},
+		{
+			name:       "already revoked session",
+			sessionID:  "old",
+			wantStatus: fiber.StatusNotFound,
+			wantLive:   []string{"laptop", "phone"},
+		},
+		{
+			name:       "unknown session",
+			sessionID:  "made-up",
+			wantStatus: fiber.StatusNotFound,
+			wantLive:   []string{"laptop", "phone"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthTest(t)
+			user := a.store.AddUser(models.User{Name: "Ada", Email: "ada@example.com"})
+			other := a.store.AddUser(models.User{Name: "Bob", Email: "bob@example.com"})
+			sessionToken(t, a.store, user.ID, "laptop")
+			old := sessionToken(t, a.store, user.ID, "old")
+			token := sessionToken(t, a.store, user.ID, "phone")
+			sessionToken(t, a.store, other.ID, "bobs-phone")
+			if status, body := request(t, a.app, fiber.MethodDelete, "/api/auth/sessions/old", old, nil); status != fiber.StatusOK {
+				t.Fatalf("revoking old session: status %d, body %v", status, body)
+			}
+
+			status, body := request(t, a.app, fiber.MethodDelete, "/api/auth/sessions/"+tt.sessionID, token, nil)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %v", status, tt.wantStatus, body)
+			}
+
+			if live := liveSessions(t, a, token); !equalSets(live, tt.wantLive) {
+				t.Fatalf("live sessions %v, want %v", live, tt.wantLive)
+			}
+		})
+	}
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	a := newAuthTest(t)
+	user := a.store.AddUser(models.User{Name: "Ada", Email: "ada@example.com"})
+	other := a.store.AddUser(models.User{Name: "Bob", Email: "bob@example.com"})
+	sessionToken(t, a.store, user.ID, "laptop")
+	token := sessionToken(t, a.store, user.ID, "phone")
+	otherToken := sessionToken(t, a.store, other.ID, "bobs-phone")
+
+	status, body := request(t, a.app, fiber.MethodDelete, "/api/auth/sessions", token, nil)
+	if status != fiber.StatusOK || body["revoked"] != float64(2) {
+		t.Fatalf("status %d, body %v, want both sessions revoked", status, body)
+	}
+	if status, body := request(t, a.app, fiber.MethodGet, "/api/auth/sessions", token, nil); status != fiber.StatusUnauthorized {
+		t.Fatalf("revoked token: status %d, body %v, want %d", status, body, fiber.StatusUnauthorized)
+	}
+	if live := liveSessions(t, a, sessionToken(t, a.store, user.ID, "tablet")); !equalSets(live, []string{"tablet"}) {
+		t.Fatalf("live sessions %v, want only a new login's", live)
+	}
+	if live := liveSessions(t, a, otherToken); !equalSets(live, []string{"bobs-phone"}) {
+		t.Fatalf("other user's live sessions %v, want them untouched", live)
+	}
+}
+
+// liveSessions lists the IDs of the sessions of the user token belongs to
+func liveSessions(t *testing.T, a *authTest, token string) []string {
+	t.Helper()
+	status, body := request(t, a.app, fiber.MethodGet, "/api/auth/sessions", token, nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("listing sessions: status %d, body %v", status, body)
+	}
+	var ids []string
+	for _, session := range body["sessions"].([]interface{}) {
+		ids = append(ids, session.(map[string]interface{})["id"].(string))
+	}
+	return ids
+}
+
+// equalSets reports whether a and b hold the same strings, in any order
+func equalSets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := map[string]bool{}
+	for _, s := range a {
+		seen[s] = true
+	}
+	for _, s := range b {
+		if !seen[s] {
+			return false
+		}
+	}
+	return true
+}
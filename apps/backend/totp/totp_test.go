@@ -0,0 +1,96 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 Appendix B, "12345678901234567890",
+// in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfcVectors are the SHA1 test vectors of RFC 6238 Appendix B, cut down to
+// the last six of their eight digits
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{unix: 59, code: "287082"},
+	{unix: 1111111109, code: "081804"},
+	{unix: 1111111111, code: "050471"},
+	{unix: 1234567890, code: "005924"},
+	{unix: 2000000000, code: "279037"},
+	{unix: 20000000000, code: "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, tt := range rfcVectors {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if got != tt.code {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	issued := time.Unix(1111111109, 0)
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		at       time.Time
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "same step", secret: rfcSecret, code: "081804", at: issued, wantStep: Step(issued), wantOK: true},
+		{name: "lower case secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code: "081804", at: issued, wantStep: Step(issued), wantOK: true},
+		{name: "spaces in the code", secret: rfcSecret, code: " 081 804 ", at: issued, wantStep: Step(issued), wantOK: true},
+		{name: "one step late", secret: rfcSecret, code: "081804", at: issued.Add(Period * time.Second), wantStep: Step(issued), wantOK: true},
+		{name: "one step early", secret: rfcSecret, code: "081804", at: issued.Add(-Period * time.Second), wantStep: Step(issued), wantOK: true},
+		{name: "two steps late", secret: rfcSecret, code: "081804", at: issued.Add(2 * Period * time.Second)},
+		{name: "two steps early", secret: rfcSecret, code: "081804", at: issued.Add(-2 * Period * time.Second)},
+		{name: "wrong code", secret: rfcSecret, code: "081805", at: issued},
+		{name: "eight digit code", secret: rfcSecret, code: "07081804", at: issued},
+		{name: "invalid secret", secret: "not base32!", code: "081804", at: issued},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.secret, tt.code, tt.at)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Fatalf("Validate = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateReplay(t *testing.T) {
+	// A code stays valid for the steps around the one it was issued in, so
+	// callers reject replays by the step Validate returns, not by the time
+	issued := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, Step(issued))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastStep, ok := Validate(rfcSecret, code, issued)
+	if !ok {
+		t.Fatal("code rejected in the step it was issued in")
+	}
+	replayed, ok := Validate(rfcSecret, code, issued.Add(Period*time.Second))
+	if !ok || replayed > lastStep {
+		t.Fatalf("replay a step later matched step %d, %v, want a step at or before %d", replayed, ok, lastStep)
+	}
+
+	next, err := Code(rfcSecret, Step(issued)+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step, ok := Validate(rfcSecret, next, issued.Add(Period*time.Second)); !ok || step <= lastStep {
+		t.Fatalf("next code matched step %d, %v, want a step after %d", step, ok, lastStep)
+	}
+}
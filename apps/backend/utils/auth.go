@@ -1,21 +1,30 @@
 package utils
 
 import (
-	"os"
-	"time"
+	"context"
+	"errors"
 
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Default secret key for JWT - should be overridden by environment variable
-var jwtSecret = []byte("zero-balance-secret-key")
+// ErrTokenRevoked is returned for a token issued before the user's last password change
+var ErrTokenRevoked = errors.New("token has been revoked")
 
-func init() {
-	// Use environment variable for JWT secret if available
-	if secret := os.Getenv("JWT_SECRET"); secret != "" {
-		jwtSecret = []byte(secret)
-	}
+// ErrMFAPending is returned when an MFA pending token is used as an access token
+var ErrMFAPending = errors.New("two-factor authentication has not been completed")
+
+// TokenVersionLookup returns a user's current token version
+type TokenVersionLookup func(ctx context.Context, userID int) (int, error)
+
+// tokenVersionOf is consulted by ValidateMFAPendingJWT when set
+var tokenVersionOf TokenVersionLookup
+
+// SetTokenVersionLookup makes ValidateMFAPendingJWT reject tokens whose
+// version no longer matches the user's. Access tokens are checked by
+// AuthMiddleware instead, together with their session.
+func SetTokenVersionLookup(lookup TokenVersionLookup) {
+	tokenVersionOf = lookup
 }
 
 // HashPassword hashes a plain password using bcrypt
@@ -30,30 +39,76 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-// GenerateJWT generates a JWT token for a user
-func GenerateJWT(userID int) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // Token expires in 7 days
-	})
+// GenerateJWT generates a short-lived access token for a user at their current
+// token version. Clients renew it with a refresh token.
+func GenerateJWT(userID, tokenVersion int, sessionID string, roles []string) (string, error) {
+	claims, err := newClaims(userID, tokenVersion, AccessTokenTTL)
+	if err != nil {
+		return "", err
+	}
+	claims.SessionID = sessionID
+	claims.Roles = roles
 
-	return token.SignedString(jwtSecret)
+	return signToken(claims)
 }
 
-// ValidateJWT validates a JWT token and returns the user ID
-func ValidateJWT(tokenString string) (int, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+// GenerateMFAPendingJWT generates the token returned by the password step of
+// a login when two-factor authentication is enabled. It only proves the
+// password was right and can only be exchanged, with a TOTP code, for an access token.
+func GenerateMFAPendingJWT(userID, tokenVersion int) (string, error) {
+	claims, err := newClaims(userID, tokenVersion, MFAPendingTokenTTL)
+	if err != nil {
+		return "", err
+	}
+	claims.MFAPending = true
+
+	return signToken(claims)
+}
 
+// ValidateJWT validates an access token and returns its claims. MFA pending
+// tokens are rejected. The token version is left to the caller, which checks
+// it with the session.
+func ValidateJWT(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := parseJWT(tokenString)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	if claims.MFAPending {
+		return nil, ErrMFAPending
+	}
+	if claims.SessionID == "" || len(claims.Roles) == 0 {
+		return nil, errMissingClaim
+	}
+	return claims, nil
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID := int(claims["user_id"].(float64))
-		return userID, nil
+// ValidateMFAPendingJWT validates an MFA pending token and returns its claims
+func ValidateMFAPendingJWT(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := parseJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.MFAPending {
+		return nil, jwt.ErrSignatureInvalid
 	}
 
-	return 0, jwt.ErrSignatureInvalid
+	if tokenVersionOf != nil {
+		current, err := tokenVersionOf(ctx, claims.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if claims.TokenVersion != current {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+// parseJWT verifies a token's signature and claims
+func parseJWT(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, verificationKey); err != nil {
+		return nil, err
+	}
+	return claims, nil
 }
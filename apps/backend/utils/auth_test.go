@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValidateMFAPendingJWTTokenVersion(t *testing.T) {
+	errLookup := errors.New("lookup failed")
+
+	tests := []struct {
+		name string
+		// claimed is the token version the token was issued at
+		claimed   int
+		current   int
+		lookupErr error
+		wantErr   error
+	}{
+		{name: "current version", claimed: 3, current: 3},
+		{name: "issued before a password change", claimed: 2, current: 3, wantErr: ErrTokenRevoked},
+		{name: "lookup fails", claimed: 3, current: 3, lookupErr: errLookup, wantErr: errLookup},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetTokenVersionLookup(func(_ context.Context, userID int) (int, error) {
+				if userID != 42 {
+					t.Fatalf("looked up user %d, want 42", userID)
+				}
+				return tt.current, tt.lookupErr
+			})
+			t.Cleanup(func() { SetTokenVersionLookup(nil) })
+
+			token, err := GenerateMFAPendingJWT(42, tt.claimed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := ValidateMFAPendingJWT(context.Background(), token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateMFAPendingJWT error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && claims.UserID != 42 {
+				t.Fatalf("ValidateMFAPendingJWT user = %d, want 42", claims.UserID)
+			}
+		})
+	}
+}
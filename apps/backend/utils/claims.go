@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Default iss and aud claims, overridden by JWT_ISSUER and JWT_AUDIENCE
+const (
+	defaultTokenIssuer   = "zero-balance"
+	defaultTokenAudience = "zero-balance-api"
+)
+
+// clockSkew is how far iat and nbf may lie in the future, to allow for clock
+// differences between the servers issuing and verifying tokens
+const clockSkew = 30 * time.Second
+
+var (
+	tokenIssuer   = defaultTokenIssuer
+	tokenAudience = defaultTokenAudience
+)
+
+// errMissingClaim is returned for a token lacking a claim every token carries
+var errMissingClaim = errors.New("token is missing a required claim")
+
+// Claims are the claims of every token this server issues
+type Claims struct {
+	UserID       int `json:"user_id"`
+	TokenVersion int `json:"token_version"`
+	// SessionID identifies the login the token belongs to. MFA pending tokens have none.
+	SessionID string   `json:"sid,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	// MFAPending marks the token returned by the password step of a two-factor login
+	MFAPending bool `json:"mfa_pending,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// newClaims returns claims for userID issued now and valid for ttl
+func newClaims(userID, tokenVersion int, ttl time.Duration) (*Claims, error) {
+	id, err := RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Claims{
+		UserID:       userID,
+		TokenVersion: tokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Issuer:    tokenIssuer,
+			Audience:  jwt.ClaimStrings{tokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}, nil
+}
+
+// Valid implements jwt.Claims. Unlike jwt.RegisteredClaims it requires every
+// registered claim this server sets, and checks the issuer and audience.
+func (c *Claims) Valid() error {
+	now := time.Now()
+	switch {
+	case c.UserID <= 0 || c.ID == "" || c.ExpiresAt == nil || c.IssuedAt == nil || c.NotBefore == nil:
+		return errMissingClaim
+	case !c.VerifyExpiresAt(now, true):
+		return jwt.ErrTokenExpired
+	case !c.VerifyNotBefore(now.Add(clockSkew), true):
+		return jwt.ErrTokenNotValidYet
+	case !c.VerifyIssuedAt(now.Add(clockSkew), true):
+		return jwt.ErrTokenUsedBeforeIssued
+	case !c.VerifyIssuer(tokenIssuer, true):
+		return jwt.ErrTokenInvalidIssuer
+	case !c.VerifyAudience(tokenAudience, true):
+		return jwt.ErrTokenInvalidAudience
+	}
+	return nil
+}
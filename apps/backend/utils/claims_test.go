@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestClaimsValid(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Claims)
+		wantErr error
+	}{
+		{name: "valid", modify: func(*Claims) {}},
+		{
+			name:    "expired",
+			modify:  func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Second)) },
+			wantErr: jwt.ErrTokenExpired,
+		},
+		{
+			name:   "issued slightly in the future",
+			modify: func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(time.Now().Add(clockSkew / 2)) },
+		},
+		{
+			name:    "issued in the future",
+			modify:  func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(time.Now().Add(2 * clockSkew)) },
+			wantErr: jwt.ErrTokenUsedBeforeIssued,
+		},
+		{
+			name:    "not valid yet",
+			modify:  func(c *Claims) { c.NotBefore = jwt.NewNumericDate(time.Now().Add(2 * clockSkew)) },
+			wantErr: jwt.ErrTokenNotValidYet,
+		},
+		{
+			name:    "other issuer",
+			modify:  func(c *Claims) { c.Issuer = "someone-else" },
+			wantErr: jwt.ErrTokenInvalidIssuer,
+		},
+		{
+			name:    "other audience",
+			modify:  func(c *Claims) { c.Audience = jwt.ClaimStrings{"another-api"} },
+			wantErr: jwt.ErrTokenInvalidAudience,
+		},
+		{name: "no user", modify: func(c *Claims) { c.UserID = 0 }, wantErr: errMissingClaim},
+		{name: "no token ID", modify: func(c *Claims) { c.ID = "" }, wantErr: errMissingClaim},
+		{name: "no expiry", modify: func(c *Claims) { c.ExpiresAt = nil }, wantErr: errMissingClaim},
+		{name: "no issued at", modify: func(c *Claims) { c.IssuedAt = nil }, wantErr: errMissingClaim},
+		{name: "no not before", modify: func(c *Claims) { c.NotBefore = nil }, wantErr: errMissingClaim},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := newClaims(42, 0, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(claims)
+			if err := claims.Valid(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Valid = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTokenKinds(t *testing.T) {
+	access, err := GenerateJWT(42, 0, "session", []string{"user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := GenerateMFAPendingJWT(42, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An access token must name its session and roles
+	claims, err := newClaims(42, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bare, err := signToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		validate func(context.Context, string) (*Claims, error)
+		token    string
+		wantErr  bool
+	}{
+		{name: "access token as access token", validate: ValidateJWT, token: access},
+		{name: "pending token as access token", validate: ValidateJWT, token: pending, wantErr: true},
+		{name: "access token without session or roles", validate: ValidateJWT, token: bare, wantErr: true},
+		{name: "pending token as pending token", validate: ValidateMFAPendingJWT, token: pending},
+		{name: "access token as pending token", validate: ValidateMFAPendingJWT, token: access, wantErr: true},
+		{name: "not a token", validate: ValidateJWT, token: "not.a.token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.validate(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate = %+v, %v, want error %v", claims, err, tt.wantErr)
+			}
+			if err == nil && claims.UserID != 42 {
+				t.Fatalf("validate user = %d, want 42", claims.UserID)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// defaultJWTSecret is the development fallback used when neither a key file
+// nor JWT_SECRET is configured
+const defaultJWTSecret = "zero-balance-secret-key"
+
+// hmacKeyID is the kid of tokens signed with JWT_SECRET
+const hmacKeyID = "hmac"
+
+// minRSABits is the smallest RSA modulus accepted for signing or verification
+const minRSABits = 2048
+
+// jwtKey is a key tokens are signed or verified with
+type jwtKey struct {
+	id     string
+	method jwt.SigningMethod
+	// private is the signing key and is nil for verification-only keys
+	private crypto.PrivateKey
+	// public verifies signatures. For HMAC it is the shared secret.
+	public interface{}
+}
+
+var (
+	// signingKey signs every token this server issues
+	signingKey = newHMACKey([]byte(defaultJWTSecret))
+
+	// verificationKeys holds every key a token may be signed with, by kid
+	verificationKeys = map[string]*jwtKey{hmacKeyID: signingKey}
+
+	// usingDefaultSecret reports whether tokens are signed with defaultJWTSecret
+	usingDefaultSecret = true
+)
+
+// KeyConfig selects the keys tokens are signed and verified with
+type KeyConfig struct {
+	// Secret signs tokens with HS256 when there is no private key
+	Secret string
+	// PrivateKeyFile selects asymmetric signing with a PEM encoded RSA (RS256)
+	// or Ed25519 (EdDSA) private key
+	PrivateKeyFile string
+	// KeyID identifies the private key, by default its RFC 7638 thumbprint
+	KeyID string
+	// PublicKeyFiles are further public keys, such as the previous signing key
+	// during a rotation, whose tokens are still accepted
+	PublicKeyFiles []string
+	// Issuer and Audience override the iss and aud claims when set
+	Issuer   string
+	Audience string
+}
+
+// LoadSigningKeys configures token signing. It must run before any token is
+// issued. Without a private key or secret, tokens are signed with a built-in
+// development secret, see UsingDefaultSecret.
+func LoadSigningKeys(cfg KeyConfig) error {
+	tokenIssuer = defaultTokenIssuer
+	if cfg.Issuer != "" {
+		tokenIssuer = cfg.Issuer
+	}
+	tokenAudience = defaultTokenAudience
+	if cfg.Audience != "" {
+		tokenAudience = cfg.Audience
+	}
+
+	keyFile := cfg.PrivateKeyFile
+	if keyFile == "" {
+		secret := cfg.Secret
+		usingDefaultSecret = secret == "" || secret == defaultJWTSecret
+		if secret == "" {
+			secret = defaultJWTSecret
+		}
+		signingKey = newHMACKey([]byte(secret))
+		verificationKeys = map[string]*jwtKey{hmacKeyID: signingKey}
+		return nil
+	}
+
+	signer, err := loadPrivateKey(keyFile)
+	if err != nil {
+		return fmt.Errorf("loading JWT_PRIVATE_KEY_FILE: %w", err)
+	}
+	if cfg.KeyID != "" {
+		signer.id = cfg.KeyID
+	}
+	keys := map[string]*jwtKey{signer.id: signer}
+
+	for _, path := range cfg.PublicKeyFiles {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		key, err := loadPublicKey(path)
+		if err != nil {
+			return fmt.Errorf("loading JWT public key %s: %w", path, err)
+		}
+		if _, ok := keys[key.id]; ok {
+			continue
+		}
+		keys[key.id] = key
+	}
+
+	signingKey = signer
+	verificationKeys = keys
+	usingDefaultSecret = false
+	return nil
+}
+
+// UsingDefaultSecret reports whether tokens are signed with the built-in
+// development secret, which must never happen in production
+func UsingDefaultSecret() bool {
+	return usingDefaultSecret
+}
+
+// signToken signs claims with the current signing key
+func signToken(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(signingKey.method, claims)
+	token.Header["kid"] = signingKey.id
+	return token.SignedString(signingKey.private)
+}
+
+// verificationKey is the jwt.Keyfunc for every token. It picks the key named
+// by the kid header and refuses tokens signed with any other algorithm than
+// that key's, so a public key can never be used as an HMAC secret.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := verificationKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS returns the public verification keys in JSON Web Key format, the
+// signing key first. It is empty when tokens are signed with a shared secret,
+// which must stay private.
+func JWKS() []JWK {
+	keys := []JWK{}
+	if jwk, ok := publicJWK(signingKey); ok {
+		keys = append(keys, jwk)
+	}
+	for _, key := range verificationKeys {
+		if key == signingKey {
+			continue
+		}
+		if jwk, ok := publicJWK(key); ok {
+			keys = append(keys, jwk)
+		}
+	}
+	return keys
+}
+
+// publicJWK converts an asymmetric key to a JWK
+func publicJWK(key *jwtKey) (JWK, bool) {
+	jwk := JWK{KeyID: key.id, Use: "sig", Algorithm: key.method.Alg()}
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// thumbprint returns the RFC 7638 SHA-256 thumbprint of a JWK, used as the
+// default kid. The required members are hashed in lexicographic order.
+func thumbprint(jwk JWK) string {
+	var members interface{}
+	if jwk.KeyType == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+	encoded, _ := json.Marshal(members)
+	sum := sha256.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// newHMACKey returns an HS256 key for a shared secret
+func newHMACKey(secret []byte) *jwtKey {
+	return &jwtKey{id: hmacKeyID, method: jwt.SigningMethodHS256, private: secret, public: secret}
+}
+
+// newPublicKey returns a verification key for an RSA or Ed25519 public key,
+// identified by its thumbprint
+func newPublicKey(public crypto.PublicKey) (*jwtKey, error) {
+	key := &jwtKey{public: public}
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSABits)
+		}
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+
+	jwk, _ := publicJWK(key)
+	key.id = thumbprint(jwk)
+	return key, nil
+}
+
+// loadPrivateKey reads a PKCS #8 or PKCS #1 PEM private key
+func loadPrivateKey(path string) (*jwtKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var private crypto.PrivateKey
+	if block.Type == "RSA PRIVATE KEY" {
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+	key, err := newPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.private = private
+	return key, nil
+}
+
+// loadPublicKey reads a PKIX or PKCS #1 PEM public key
+func loadPublicKey(path string) (*jwtKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var public crypto.PublicKey
+	if block.Type == "RSA PUBLIC KEY" {
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newPublicKey(public)
+}
+
+// readPEM reads the first PEM block of a file
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	return block, nil
+}
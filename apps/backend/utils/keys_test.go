@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// writeKey writes a PEM block to a file in dir and returns its path
+func writeKey(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testKeys writes an RSA and an Ed25519 key pair to a temporary directory and
+// returns the paths of the private and public key files by name
+func testKeys(t *testing.T) map[string]string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := map[string]string{}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths["rsa"] = writeKey(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	paths["rsa.pub"] = writeKey(t, dir, "rsa.pub.pem", "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey))
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths["ed25519"] = writeKey(t, dir, "ed25519.pem", "PRIVATE KEY", der)
+	if der, err = x509.MarshalPKIXPublicKey(edPublic); err != nil {
+		t.Fatal(err)
+	}
+	paths["ed25519.pub"] = writeKey(t, dir, "ed25519.pub.pem", "PUBLIC KEY", der)
+
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths["weak"] = writeKey(t, dir, "weak.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(weak))
+	return paths
+}
+
+// loadKeys loads the signing keys of cfg, and goes back to the default secret
+// when the test ends
+func loadKeys(t *testing.T, cfg KeyConfig) error {
+	t.Helper()
+	t.Cleanup(func() {
+		signingKey = newHMACKey([]byte(defaultJWTSecret))
+		verificationKeys = map[string]*jwtKey{hmacKeyID: signingKey}
+		usingDefaultSecret = true
+	})
+	return LoadSigningKeys(cfg)
+}
+
+// header returns a header of a token without verifying it
+func header(t *testing.T, token, name string) interface{} {
+	t.Helper()
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Header[name]
+}
+
+func TestSigningKeys(t *testing.T) {
+	keys := testKeys(t)
+
+	tests := []struct {
+		name    string
+		cfg     KeyConfig
+		wantAlg string
+		// wantKid is the expected kid, or "" for the key's thumbprint
+		wantKid string
+	}{
+		{name: "shared secret", cfg: KeyConfig{Secret: "secret"}, wantAlg: "HS256", wantKid: hmacKeyID},
+		{name: "RSA", cfg: KeyConfig{PrivateKeyFile: keys["rsa"]}, wantAlg: "RS256"},
+		{name: "Ed25519", cfg: KeyConfig{PrivateKeyFile: keys["ed25519"]}, wantAlg: "EdDSA"},
+		{name: "key ID", cfg: KeyConfig{PrivateKeyFile: keys["ed25519"], KeyID: "2025-01"}, wantAlg: "EdDSA", wantKid: "2025-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := loadKeys(t, tt.cfg); err != nil {
+				t.Fatalf("LoadSigningKeys: %v", err)
+			}
+			token, err := GenerateJWT(42, 0, "session", []string{"user"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if alg := header(t, token, "alg"); alg != tt.wantAlg {
+				t.Fatalf("alg = %v, want %s", alg, tt.wantAlg)
+			}
+			wantKid := tt.wantKid
+			if wantKid == "" {
+				wantKid = signingKey.id
+				if jwks := JWKS(); len(jwks) != 1 || thumbprint(jwks[0]) != wantKid {
+					t.Fatalf("kid %s is not the thumbprint of the published key %+v", wantKid, jwks)
+				}
+			}
+			if kid := header(t, token, "kid"); kid != wantKid {
+				t.Fatalf("kid = %v, want %s", kid, wantKid)
+			}
+			if claims, err := ValidateJWT(context.Background(), token); err != nil || claims.UserID != 42 {
+				t.Fatalf("ValidateJWT = %+v, %v, want user 42", claims, err)
+			}
+		})
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	keys := testKeys(t)
+
+	if err := loadKeys(t, KeyConfig{PrivateKeyFile: keys["rsa"]}); err != nil {
+		t.Fatal(err)
+	}
+	oldKid := signingKey.id
+	old, err := GenerateJWT(42, 0, "session", []string{"user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sign with the new key, still accepting the old one
+	if err := loadKeys(t, KeyConfig{
+		PrivateKeyFile: keys["ed25519"],
+		PublicKeyFiles: []string{keys["rsa.pub"], keys["ed25519.pub"]},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(context.Background(), old); err != nil {
+		t.Fatalf("token signed with the previous key: %v", err)
+	}
+	jwks := JWKS()
+	if len(jwks) != 2 || jwks[0].KeyID != signingKey.id || jwks[1].KeyID != oldKid {
+		t.Fatalf("JWKS %+v, want the signing key then the previous key", jwks)
+	}
+
+	// Once the old key is dropped, its tokens are refused
+	if err := loadKeys(t, KeyConfig{PrivateKeyFile: keys["ed25519"]}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(context.Background(), old); err == nil {
+		t.Fatal("token signed with a dropped key was accepted")
+	}
+}
+
+func TestVerificationKeyRefusesOtherAlgorithms(t *testing.T) {
+	keys := testKeys(t)
+	if err := loadKeys(t, KeyConfig{PrivateKeyFile: keys["rsa"]}); err != nil {
+		t.Fatal(err)
+	}
+	publicPEM, err := os.ReadFile(keys["rsa.pub"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		kid    string
+		key    interface{}
+	}{
+		// The public key is no secret, so it must never verify an HMAC signature
+		{name: "HS256 with the public key as secret", method: jwt.SigningMethodHS256, kid: signingKey.id, key: publicPEM},
+		{name: "shared secret kid", method: jwt.SigningMethodHS256, kid: hmacKeyID, key: []byte(defaultJWTSecret)},
+		{name: "unknown kid", method: jwt.SigningMethodHS256, kid: "other", key: []byte(defaultJWTSecret)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := newClaims(42, 0, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims.SessionID = "session"
+			claims.Roles = []string{"user"}
+			token := jwt.NewWithClaims(tt.method, claims)
+			token.Header["kid"] = tt.kid
+			signed, err := token.SignedString(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ValidateJWT(context.Background(), signed); err == nil {
+				t.Fatal("token accepted")
+			}
+		})
+	}
+}
+
+func TestLoadSigningKeysRejectsWeakRSA(t *testing.T) {
+	keys := testKeys(t)
+	err := loadKeys(t, KeyConfig{PrivateKeyFile: keys["weak"]})
+	if err == nil || !strings.Contains(err.Error(), "at least 2048 bits") {
+		t.Fatalf("LoadSigningKeys = %v, want the key refused as too small", err)
+	}
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"errors"
+	"unicode"
+)
+
+// Password policy limits. bcrypt ignores everything past 72 bytes, so longer
+// passwords are rejected rather than silently truncated.
+const (
+	MinPasswordLength = 8
+	MaxPasswordBytes  = 72
+)
+
+// Password policy violations, worded for display to the user
+var (
+	ErrPasswordTooShort = errors.New("Password must be at least 8 characters long")
+	ErrPasswordTooLong  = errors.New("Password must be at most 72 bytes long")
+	ErrPasswordTooWeak  = errors.New("Password must contain at least one letter and one number")
+)
+
+// ValidatePassword checks a new password against the password policy
+func ValidatePassword(password string) error {
+	if len([]rune(password)) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	if len(password) > MaxPasswordBytes {
+		return ErrPasswordTooLong
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return ErrPasswordTooWeak
+	}
+	return nil
+}
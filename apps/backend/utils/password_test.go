@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  error
+	}{
+		{name: "letters and numbers", password: "correct1horse"},
+		{name: "exactly the minimum", password: "abcdefg1"},
+		{name: "too short", password: "abc1234", wantErr: ErrPasswordTooShort},
+		{name: "multibyte characters count once", password: "ééééééé1"},
+		{name: "no number", password: "correcthorse", wantErr: ErrPasswordTooWeak},
+		{name: "no letter", password: "1234567890", wantErr: ErrPasswordTooWeak},
+		{name: "exactly the byte limit", password: strings.Repeat("a", MaxPasswordBytes-1) + "1"},
+		{name: "past the byte limit bcrypt reads", password: strings.Repeat("a", MaxPasswordBytes) + "1", wantErr: ErrPasswordTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePassword(tt.password); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidatePassword = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
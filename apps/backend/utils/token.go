@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Lifetimes of the kinds of token handed to clients
+const (
+	AccessTokenTTL     = 15 * time.Minute
+	RefreshTokenTTL    = 30 * 24 * time.Hour
+	MFAPendingTokenTTL = 5 * time.Minute
+)
+
+// RandomToken returns n cryptographically random bytes encoded as hex
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken returns the SHA-256 hex digest stored in place of an opaque token.
+// The tokens are random, so unlike passwords they need no salt or slow hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
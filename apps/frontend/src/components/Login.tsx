@@ -6,9 +6,10 @@ interface LoginProps {
 }
 
 const Login = ({ onToggleForm }: LoginProps) => {
-  const { login, error, clearError, loading } = useAuth();
+  const { login, verifyMfa, mfaPending, error, clearError, loading } = useAuth();
   const [email, setEmail] = useState('');
   const [password, setPassword] = useState('');
+  const [code, setCode] = useState('');
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
@@ -23,6 +24,58 @@ const Login = ({ onToggleForm }: LoginProps) => {
     }
   };
 
+  const handleVerify = async (e: React.FormEvent) => {
+    e.preventDefault();
+    clearError();
+
+    try {
+      await verifyMfa(code);
+    } catch (err) {
+      // Error is handled by the AuthContext
+      console.error('Two-factor verification failed:', err);
+    }
+  };
+
+  // Second step of a two-factor login
+  if (mfaPending) {
+    return (
+      <div className="w-full max-w-md p-6 bg-white rounded-lg shadow-md">
+        <h2 className="text-2xl font-bold mb-6 text-center">Two-Factor Authentication</h2>
+
+        {error && (
+          <div className="mb-4 p-3 bg-red-100 text-red-700 rounded">
+            {error}
+          </div>
+        )}
+
+        <form onSubmit={handleVerify}>
+          <div className="mb-6">
+            <label htmlFor="code" className="block text-gray-700 font-medium mb-2">
+              Authentication or recovery code
+            </label>
+            <input
+              type="text"
+              id="code"
+              autoComplete="one-time-code"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              className="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-2 focus:ring-blue-500"
+              required
+            />
+          </div>
+
+          <button
+            type="submit"
+            disabled={loading}
+            className="w-full bg-blue-500 text-white py-2 px-4 rounded hover:bg-blue-600 focus:outline-none focus:ring-2 focus:ring-blue-500 disabled:opacity-50"
+          >
+            {loading ? 'Verifying...' : 'Verify'}
+          </button>
+        </form>
+      </div>
+    );
+  }
+
   return (
     <div className="w-full max-w-md p-6 bg-white rounded-lg shadow-md">
       <h2 className="text-2xl font-bold mb-6 text-center">Login</h2>
@@ -348,11 +348,11 @@ const ProfilePage = () => {
                 <div className="grid grid-cols-1 md:grid-cols-2 lg:grid-cols-3 gap-4">
                   <div className="bg-blue-50 p-4 rounded">
                     <p className="text-sm text-blue-600">Total Debt</p>
-                    <p className="text-2xl font-bold">${stats.total_debt.toFixed(2)}</p>
+                    <p className="text-2xl font-bold">${stats.total_debt}</p>
                   </div>
                   <div className="bg-green-50 p-4 rounded">
                     <p className="text-sm text-green-600">Total Income</p>
-                    <p className="text-2xl font-bold">${stats.total_income.toFixed(2)}</p>
+                    <p className="text-2xl font-bold">${stats.total_income}</p>
                   </div>
                   <div className="bg-purple-50 p-4 rounded">
                     <p className="text-sm text-purple-600">Debt-to-Income Ratio</p>
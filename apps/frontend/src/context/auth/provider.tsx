@@ -14,6 +14,7 @@ export const AuthProvider = ({ children }: AuthProviderProps) => {
   const [user, setUser] = useState<User | null>(null);
   const [loading, setLoading] = useState<boolean>(true);
   const [error, setError] = useState<string | null>(null);
+  const [mfaToken, setMfaToken] = useState<string | null>(null);
 
   // Initialize auth state on component mount
   useEffect(() => {
@@ -46,7 +47,12 @@ export const AuthProvider = ({ children }: AuthProviderProps) => {
     setError(null);
     try {
       const response = await authService.login(email, password);
-      setUser(response.user);
+      if ('mfa_required' in response) {
+        // Wait for the authenticator code before signing in
+        setMfaToken(response.mfa_token);
+      } else {
+        setUser(response.user);
+      }
     } catch (err: unknown) {
       const errorMessage = err instanceof Error 
         ? err.message 
@@ -60,6 +66,28 @@ export const AuthProvider = ({ children }: AuthProviderProps) => {
     }
   };
 
+  // Complete a two-factor login
+  const verifyMfa = async (code: string) => {
+    if (!mfaToken) {
+      return;
+    }
+    setLoading(true);
+    setError(null);
+    try {
+      const response = await authService.verifyMfa(mfaToken, code);
+      setMfaToken(null);
+      setUser(response.user);
+    } catch (err: unknown) {
+      const errorMessage = typeof err === 'object' && err !== null && 'response' in err && typeof err.response === 'object' && err.response !== null && 'data' in err.response && typeof err.response.data === 'object' && err.response.data !== null && 'error' in err.response.data && typeof err.response.data.error === 'string'
+        ? err.response.data.error
+        : 'Failed to verify code. Please try again.';
+      setError(errorMessage);
+      throw err;
+    } finally {
+      setLoading(false);
+    }
+  };
+
   // Signup function
   const signup = async (name: string, email: string, password: string) => {
     setLoading(true);
@@ -83,6 +111,7 @@ export const AuthProvider = ({ children }: AuthProviderProps) => {
   // Logout function
   const logout = () => {
     authService.logout();
+    setMfaToken(null);
     setUser(null);
   };
 
@@ -96,7 +125,9 @@ export const AuthProvider = ({ children }: AuthProviderProps) => {
     user,
     loading,
     error,
+    mfaPending: mfaToken !== null,
     login,
+    verifyMfa,
     signup,
     logout,
     clearError,
@@ -6,7 +6,9 @@ export interface AuthContextType {
   user: User | null;
   loading: boolean;
   error: string | null;
+  mfaPending: boolean;
   login: (email: string, password: string) => Promise<void>;
+  verifyMfa: (code: string) => Promise<void>;
   signup: (name: string, email: string, password: string) => Promise<void>;
   logout: () => void;
   clearError: () => void;
@@ -17,7 +19,9 @@ export const AuthContext = createContext<AuthContextType>({
   user: null,
   loading: false,
   error: null,
+  mfaPending: false,
   login: async () => {},
+  verifyMfa: async () => {},
   signup: async () => {},
   logout: () => {},
   clearError: () => {},
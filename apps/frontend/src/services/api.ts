@@ -43,12 +43,56 @@ api.interceptors.request.use(
   }
 );
 
+// Exchange the stored refresh token for a new token pair. Concurrent 401s
+// share one request, since a refresh token can only be used once.
+let refreshPromise: Promise<string> | null = null;
+
+const refreshAccessToken = (): Promise<string> => {
+  if (!refreshPromise) {
+    const refreshToken = localStorage.getItem('refreshToken');
+    refreshPromise = (refreshToken
+      ? api.post<{ token: string; refresh_token: string }>('/api/auth/refresh', { refresh_token: refreshToken })
+      : Promise.reject(new Error('No refresh token'))
+    )
+      .then((response) => {
+        localStorage.setItem('token', response.data.token);
+        localStorage.setItem('refreshToken', response.data.refresh_token);
+        api.defaults.headers.common['Authorization'] = `Bearer ${response.data.token}`;
+        return response.data.token;
+      })
+      .finally(() => {
+        refreshPromise = null;
+      });
+  }
+  return refreshPromise;
+};
+
 // Add a response interceptor for error handling
 api.interceptors.response.use(
   (response) => {
     return response;
   },
-  (error) => {
+  async (error) => {
+    // Access tokens are short-lived, so retry once with a refreshed token
+    const original = error.config;
+    if (
+      error.response?.status === 401 &&
+      original &&
+      !original._retried &&
+      !['/api/auth/login', '/api/auth/signup', '/api/auth/refresh', '/api/auth/logout'].some((url) => original.url?.includes(url))
+    ) {
+      original._retried = true;
+      try {
+        const token = await refreshAccessToken();
+        original.headers.Authorization = `Bearer ${token}`;
+        return api(original);
+      } catch {
+        localStorage.removeItem('token');
+        localStorage.removeItem('refreshToken');
+        delete api.defaults.headers.common['Authorization'];
+      }
+    }
+
     // Handle common errors here
     if (error.response) {
       // The request was made and the server responded with a status code
@@ -1,16 +1,20 @@
 import api from './api';
-import { User, AuthResponse, LoginCredentials, SignupCredentials } from '../types/auth';
+import { User, AuthResponse, MfaChallenge, LoginCredentials, SignupCredentials } from '../types/auth';
 
-// Store token in localStorage
-const setToken = (token: string) => {
+// Store tokens in localStorage
+export const setToken = (token: string, refreshToken?: string) => {
   localStorage.setItem('token', token);
+  if (refreshToken) {
+    localStorage.setItem('refreshToken', refreshToken);
+  }
   // Update axios headers for future requests
   api.defaults.headers.common['Authorization'] = `Bearer ${token}`;
 };
 
-// Remove token from localStorage
+// Remove tokens from localStorage
 const removeToken = () => {
   localStorage.removeItem('token');
+  localStorage.removeItem('refreshToken');
   delete api.defaults.headers.common['Authorization'];
 };
 
@@ -25,27 +29,65 @@ export const signup = async (name: string, email: string, password: string): Pro
   const response = await api.post<AuthResponse>('/api/auth/signup', credentials);
   
   // Store token and update headers
-  setToken(response.data.token);
+  setToken(response.data.token, response.data.refresh_token);
   
   return response.data;
 };
 
-// Login user
-export const login = async (email: string, password: string): Promise<AuthResponse> => {
+// Login user. With two-factor authentication enabled this returns a challenge
+// that must be completed with verifyMfa.
+export const login = async (email: string, password: string): Promise<AuthResponse | MfaChallenge> => {
   const credentials: LoginCredentials = { email, password };
-  const response = await api.post<AuthResponse>('/api/auth/login', credentials);
+  const response = await api.post<AuthResponse | MfaChallenge>('/api/auth/login', credentials);
   
+  if ('mfa_required' in response.data) {
+    return response.data;
+  }
+
   // Store token and update headers
-  setToken(response.data.token);
+  setToken(response.data.token, response.data.refresh_token);
   
   return response.data;
 };
 
-// Logout user
+// Complete a two-factor login with an authenticator or recovery code
+export const verifyMfa = async (mfaToken: string, code: string): Promise<AuthResponse> => {
+  // Recovery codes are longer than the six-digit authenticator codes
+  const body = code.replace(/\s/g, '').length > 6
+    ? { mfa_token: mfaToken, recovery_code: code }
+    : { mfa_token: mfaToken, code };
+  const response = await api.post<AuthResponse>('/api/auth/mfa/verify', body);
+
+  // Store token and update headers
+  setToken(response.data.token, response.data.refresh_token);
+
+  return response.data;
+};
+
+// Logout user, revoking the refresh token on the server
 export const logout = (): void => {
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (refreshToken) {
+    api.post('/api/auth/logout', { refresh_token: refreshToken }).catch(() => {});
+  }
   removeToken();
 };
 
+// Request a password reset email
+export const forgotPassword = async (email: string): Promise<{ message: string }> => {
+  const response = await api.post<{ message: string }>('/api/auth/forgot-password', { email });
+  return response.data;
+};
+
+// Set a new password with the token from a reset email
+export const resetPassword = async (token: string, newPassword: string): Promise<{ message: string }> => {
+  const response = await api.post<{ message: string }>('/api/auth/reset-password', {
+    token,
+    new_password: newPassword,
+  });
+  return response.data;
+};
+
 // Get current user
 export const getCurrentUser = async (): Promise<User> => {
   try {
@@ -74,7 +116,10 @@ export const initializeAuth = (): void => {
 export default {
   signup,
   login,
+  verifyMfa,
   logout,
+  forgotPassword,
+  resetPassword,
   getCurrentUser,
   isLoggedIn,
   initializeAuth,
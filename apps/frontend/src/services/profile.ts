@@ -1,16 +1,24 @@
 import api from './api';
+import { setToken } from './auth';
 
 // Types
 export interface Profile {
   id: number;
   name: string;
   email: string;
+  email_verified: boolean;
+  base_currency: string;
   created_at: string;
 }
 
+// Monetary amounts are exact decimal strings such as "1234.56"
+// Totals are converted into the base currency
 export interface ProfileStats {
-  total_debt: number;
-  total_income: number;
+  currency: string;
+  total_debt: string;
+  total_income: string;
+  debt_by_currency: Record<string, string>;
+  income_by_currency: Record<string, string>;
   debt_count: number;
   income_sources_count: number;
   debt_to_income_ratio: number;
@@ -30,10 +38,14 @@ export const updateProfile = async (name: string): Promise<Profile> => {
 
 // Change password
 export const changePassword = async (currentPassword: string, newPassword: string): Promise<{ message: string }> => {
-  const response = await api.put<{ message: string }>('/api/profile/password', {
+  const response = await api.put<{ message: string; token: string; refresh_token: string }>('/api/profile/password', {
     current_password: currentPassword,
     new_password: newPassword,
   });
+
+  // Changing the password revokes every older token, including the current one
+  setToken(response.data.token, response.data.refresh_token);
+
   return response.data;
 };
 
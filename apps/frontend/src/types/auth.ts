@@ -3,6 +3,7 @@ export interface User {
   id: number;
   name: string;
   email: string;
+  email_verified?: boolean;
   created_at?: string;
   updated_at?: string;
 }
@@ -10,10 +11,19 @@ export interface User {
 // Define auth response types
 export interface AuthResponse {
   token: string;
+  refresh_token: string;
+  expires_in: number;
   user: User;
   message?: string;
 }
 
+// Returned by login instead of tokens when two-factor authentication is enabled
+export interface MfaChallenge {
+  mfa_required: true;
+  mfa_token: string;
+  message?: string;
+}
+
 // Define login credentials
 export interface LoginCredentials {
   email: string;
@@ -1,16 +1,26 @@
+// Monetary amounts and interest rates are exact decimal strings such as
+// "1234.56", never floats.
+export type Decimal = string;
+
+// ISO 4217 currency code such as "USD"
+export type Currency = string;
+
 export interface User {
     id: number;
     name: string;
     email: string;
+    emailVerified: boolean;
+    baseCurrency: Currency;
   }
   
   export interface Debt {
     id: number;
     userId: number;
     creditorName: string;
-    amount: number;
-    interestRate: number;
-    minimumPayment: number;
+    amount: Decimal;
+    currency: Currency;
+    interestRate: Decimal;
+    minimumPayment: Decimal;
     dueDate: string;
     status: 'active' | 'paid_off';
     createdAt: string;
@@ -20,9 +30,12 @@ export interface User {
     id: number;
     userId: number;
     sourceName: string;
-    amount: number;
+    amount: Decimal;
+    currency: Currency;
     frequency: 'weekly' | 'biweekly' | 'monthly' | 'irregular';
     nextPayDate: string;
+    // Day of the month monthly sources are paid on, absent for other frequencies
+    payDay?: number;
     createdAt: string;
   }
   
@@ -30,7 +43,8 @@ export interface User {
     id: number;
     userId: number;
     debtId: number;
-    amount: number;
+    amount: Decimal;
+    currency: Currency;
     paymentDate: string;
     method: 'bank_transfer' | 'credit_card' | 'cash' | 'other';
   }
@@ -39,9 +53,12 @@ export interface User {
     id: number;
     userId: number;
     debtId: number;
-    recommendedAmount: number;
+    recommendedAmount: Decimal;
+    currency: Currency;
     scheduledDate: string;
     status: 'pending' | 'completed' | 'skipped';
+    // The payment that completed it, absent until then
+    paymentId?: number;
     createdAt: string;
   }
   
\ No newline at end of file